@@ -6,17 +6,19 @@ import (
 	"embed"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/crhntr/clice"
+	"github.com/crhntr/clice/expression"
 )
 
 var (
@@ -30,17 +32,29 @@ func main() {
 	table := clice.NewTable(10, 10)
 	flag.IntVar(&table.ColumnLen, "columns", table.ColumnLen, "the number of table columns")
 	flag.IntVar(&table.RowLen, "rows", table.RowLen, "the number of table rows")
+	flag.IntVar(&table.Workers, "workers", table.Workers, "the number of goroutines used to evaluate independent cells")
+	flag.TextVar(&table.Dialect, "dialect", table.Dialect, "the expression syntax: go or formula")
+	flag.TextVar(&table.Numeric.Mode, "numeric", table.Numeric.Mode, "the number model: exact, float or decimal")
+	flag.IntVar(&table.Numeric.Scale, "scale", table.Numeric.Scale, "the digits after the decimal point of decimal numbers")
+	flag.TextVar(&table.Numeric.Rounding, "rounding", table.Numeric.Rounding, "the rounding of decimal numbers: half-up, half-even, down, floor or ceiling")
+	flag.Float64Var(&table.Numeric.Tolerance, "tolerance", table.Numeric.Tolerance, "the accuracy of IRR and RATE (default 1e-10)")
+	flag.IntVar(&table.Numeric.MaxIterations, "max-iterations", table.Numeric.MaxIterations, "the iterations IRR and RATE may use (default 100)")
+	flag.BoolVar(&table.Iterative, "iterative", table.Iterative, "calculate circular references iteratively instead of rejecting them")
+	flag.Float64Var(&table.Tolerance, "iterative-tolerance", table.Tolerance, "the accuracy of iterative calculation (default 1e-10)")
+	flag.IntVar(&table.MaxIterations, "iterative-max-iterations", table.MaxIterations, "the iterations iterative calculation may use (default 100)")
 	flag.Parse()
+	if scale := table.Numeric.Scale; scale < 0 || scale > expression.MaxScale {
+		log.Fatalf("scale must be between 0 and %d, got %d", expression.MaxScale, scale)
+	}
 	s := server{
-		table: table,
+		table: clice.NewSyncTable(table),
 	}
 	log.Println("starting server")
 	log.Fatal(http.ListenAndServe(":"+cmp.Or(os.Getenv("PORT"), "8080"), s.ServeMux()))
 }
 
 type server struct {
-	table clice.Table
-	mut   sync.RWMutex
+	table *clice.SyncTable
 }
 
 func (server *server) ServeMux() *http.ServeMux {
@@ -49,6 +63,7 @@ func (server *server) ServeMux() *http.ServeMux {
 	mux.HandleFunc("GET /", server.index)
 	mux.HandleFunc("GET /table.json", server.getTableJSON)
 	mux.HandleFunc("POST /table.json", server.postTableJSON)
+	mux.HandleFunc("GET /table.csv", server.getTableCSV)
 	mux.HandleFunc("GET /cell/{id}/edit", server.getCellEdit)
 	mux.HandleFunc("PATCH /table", server.patchTable)
 
@@ -56,25 +71,21 @@ func (server *server) ServeMux() *http.ServeMux {
 }
 
 func (server *server) index(res http.ResponseWriter, _ *http.Request) {
-	server.mut.RLock()
-	defer server.mut.RUnlock()
+	table := server.table.Snapshot()
 
 	renderHTML(res, func(w io.Writer) error {
-		return templates.ExecuteTemplate(w, "index.html.template", &server.table)
+		return templates.ExecuteTemplate(w, "index.html.template", table)
 	})
 }
 
 func (server *server) getCellEdit(res http.ResponseWriter, req *http.Request) {
-	server.mut.RLock()
-	defer server.mut.RUnlock()
-
 	column, row, err := clice.CellID(req.PathValue("id"))
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cell := server.table.Cell(column, row)
+	cell := server.table.Snapshot().Cell(column, row)
 
 	renderHTML(res, func(w io.Writer) error {
 		return templates.ExecuteTemplate(w, "edit-cell", cell)
@@ -82,19 +93,17 @@ func (server *server) getCellEdit(res http.ResponseWriter, req *http.Request) {
 }
 
 func (server *server) getTableJSON(res http.ResponseWriter, _ *http.Request) {
-	server.mut.RLock()
-	defer server.mut.RUnlock()
+	renderJSON(res, server.table.Snapshot())
+}
 
-	filtered := server.table.Cells[:0]
-	for _, cell := range server.table.Cells {
-		if !cell.HasExpression() {
-			continue
-		}
-		filtered = append(filtered, cell)
+func (server *server) getTableCSV(res http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+	if err := server.table.Snapshot().WriteCSV(&buf); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	server.table.Cells = filtered
-
-	renderJSON(res, server.table)
+	res.Header().Set("content-disposition", `attachment; filename="table.csv"`)
+	writeResponse(res, http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
 }
 
 func (server *server) postTableJSON(res http.ResponseWriter, req *http.Request) {
@@ -118,20 +127,19 @@ func (server *server) postTableJSON(res http.ResponseWriter, req *http.Request)
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
-	var table clice.Table
+	table := clice.Table{Workers: server.table.Snapshot().Workers}
 	if err = json.Unmarshal(tableJSON, &table); err != nil {
-		log.Fatal(err)
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
 	}
 	if err := table.Evaluate(); err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
-	server.mut.Lock()
-	defer server.mut.Unlock()
-	server.table = table
+	snapshot := server.table.Store(table)
 
 	renderHTML(res, func(w io.Writer) error {
-		return templates.ExecuteTemplate(w, "table", &server.table)
+		return templates.ExecuteTemplate(w, "table", snapshot)
 	})
 }
 
@@ -140,20 +148,84 @@ func (server *server) patchTable(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
-	server.mut.Lock()
-	defer server.mut.Unlock()
-	var assignments []clice.Assignment
-	const prefix = "cell-"
+	type cellFormat struct {
+		column, row int
+		format      clice.NumberFormat
+	}
+	var (
+		assignments []clice.Assignment
+		formats     []cellFormat
+		functions   []clice.Function
+	)
+	const cellPrefix, formatPrefix, functionPrefix = "cell-", "format-", "function-"
+	if name := req.Form.Get("new-function-name"); name != "" {
+		functions = append(functions, clice.Function{Name: name, Expression: req.Form.Get("new-function")})
+	}
 	for key, value := range req.Form {
-		if !strings.HasPrefix(key, prefix) {
-			continue
+		switch {
+		case strings.HasPrefix(key, functionPrefix):
+			functions = append(functions, clice.Function{
+				Name:       key[len(functionPrefix):],
+				Expression: value[0],
+			})
+		case strings.HasPrefix(key, cellPrefix):
+			assignments = append(assignments, clice.Assignment{
+				Identifier: key[len(cellPrefix):],
+				Expression: value[0],
+			})
+		case strings.HasPrefix(key, formatPrefix):
+			column, row, err := clice.CellID(key[len(formatPrefix):])
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			format, err := clice.ParseNumberFormat(value[0])
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			formats = append(formats, cellFormat{column: column, row: row, format: format})
+		}
+	}
+	slices.SortFunc(functions, func(a, b clice.Function) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	rates, setRates := req.Form["exchange-rates"]
+	// Invalid rates, functions and expressions discard the whole edit, while
+	// evaluation errors are shown on the cells.
+	table, err := server.table.Update(func(table *clice.Table) error {
+		if setRates {
+			if err := table.SetExchangeRates(rates[0]); err != nil {
+				return &clice.DiscardError{Err: err}
+			}
+		}
+		for _, f := range functions {
+			if err := table.Define(f.Name, f.Expression); err != nil {
+				return &clice.DiscardError{Err: err}
+			}
+		}
+		err := table.Apply(assignments...)
+		var expressionErr *clice.ExpressionError
+		if errors.As(err, &expressionErr) {
+			return &clice.DiscardError{Err: err}
 		}
-		assignments = append(assignments, clice.Assignment{
-			Identifier: key[len(prefix):],
-			Expression: value[0],
+		for _, f := range formats {
+			if _, ok := table.Lookup(f.column, f.row); ok || !f.format.IsZero() {
+				table.SetCellFormat(f.column, f.row, f.format)
+			}
+		}
+		return err
+	})
+	var expressionErr *clice.ExpressionError
+	if errors.As(err, &expressionErr) {
+		cell := expressionErr.Cell()
+		res.Header().Set("HX-Retarget", "#cell-"+cell.ID())
+		res.Header().Set("HX-Reswap", "outerHTML")
+		renderHTMLWithStatus(res, http.StatusUnprocessableEntity, func(w io.Writer) error {
+			return templates.ExecuteTemplate(w, "edit-cell", cell)
 		})
+		return
 	}
-	err := server.table.Apply(assignments...)
 	if err != nil {
 		log.Println(err)
 		http.Error(res, err.Error(), http.StatusBadRequest)
@@ -161,17 +233,21 @@ func (server *server) patchTable(res http.ResponseWriter, req *http.Request) {
 	}
 
 	renderHTML(res, func(w io.Writer) error {
-		return templates.ExecuteTemplate(w, "table", &server.table)
+		return templates.ExecuteTemplate(w, "table", table)
 	})
 }
 
 func renderHTML(res http.ResponseWriter, execute func(w io.Writer) error) {
+	renderHTMLWithStatus(res, http.StatusOK, execute)
+}
+
+func renderHTMLWithStatus(res http.ResponseWriter, code int, execute func(w io.Writer) error) {
 	var buf bytes.Buffer
 	if err := execute(&buf); err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeResponse(res, http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	writeResponse(res, code, "text/html; charset=utf-8", buf.Bytes())
 }
 
 func renderJSON(res http.ResponseWriter, data any) {
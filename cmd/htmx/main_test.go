@@ -24,7 +24,7 @@ import (
 func TestServer(t *testing.T) {
 	setup := func(columns, rows int) *server {
 		return &server{
-			table: clice.NewTable(columns, rows),
+			table: clice.NewSyncTable(clice.NewTable(columns, rows)),
 		}
 	}
 
@@ -89,6 +89,45 @@ func TestServer(t *testing.T) {
 				assert.NotZero(t, input.GetAttribute("aria-label"))
 			}
 		})
+		t.Run("syntax error", func(t *testing.T) {
+			s := setup(1, 1)
+			mux := s.ServeMux()
+
+			rec := setCellExpressionRequest(t, mux, "A0", "(1 + 2")
+			res := rec.Result()
+			assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+			assert.Equal(t, "#cell-A0", res.Header.Get("HX-Retarget"))
+
+			fragment := domtest.ParseResponseDocumentFragment(t, res, atom.Tr)
+			cell := fragment.FirstElementChild()
+			require.NotNil(t, cell)
+			assert.Equal(t, "cell-A0", cell.GetAttribute("id"))
+			if input := cell.QuerySelector(`input[type="text"]`); assert.NotNil(t, input) {
+				assert.Equal(t, "(1 + 2", input.GetAttribute("value"))
+			}
+			if mark := cell.QuerySelector(".error-source mark"); assert.NotNil(t, mark) {
+				assert.Equal(t, "(", mark.TextContent())
+			}
+			assert.Contains(t, cell.TextContent(), "missing closing parenthesis")
+		})
+		t.Run("evaluation error", func(t *testing.T) {
+			s := setup(2, 2)
+			mux := s.ServeMux()
+
+			rec := setCellExpressionRequest(t, mux, "A0", "1 + SUM(2, Z9)")
+			assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			document := domtest.ParseResponseDocument(t, rec.Result())
+			if mark := document.QuerySelector("#cell-A0 .error-source mark"); assert.NotNil(t, mark) {
+				assert.Equal(t, "Z9", mark.TextContent())
+			}
+			if cell := document.QuerySelector("#cell-A0"); assert.NotNil(t, cell) {
+				assert.Contains(t, cell.TextContent(), "unknown cell Z9")
+			}
+		})
 		t.Run("empty table no cells", func(t *testing.T) {
 			s := setup(1, 1)
 			mux := s.ServeMux()
@@ -267,7 +306,7 @@ func TestServer(t *testing.T) {
 				rec := setCellExpressionRequest(t, mux, "cell-A1", "A0")
 				res := rec.Result()
 				assert.Equal(t, http.StatusBadRequest, res.StatusCode)
-				assert.Contains(t, rec.Body.String(), "recursive reference to A1")
+				assert.Contains(t, rec.Body.String(), "recursive reference to A0")
 			}
 		})
 
@@ -336,6 +375,160 @@ func TestServer(t *testing.T) {
 		})
 	})
 
+	t.Run("number format", func(t *testing.T) {
+		s := setup(2, 1)
+		mux := s.ServeMux()
+
+		req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+			"cell-A0":   []string{"1234.5"},
+			"format-A0": []string{"$#,##0.00"},
+			"cell-B0":   []string{`"total"`},
+			"format-B0": []string{""},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		document := domtest.ParseResponseDocument(t, res)
+		if el := document.QuerySelector("#cell-A0"); assert.NotNil(t, el) {
+			assert.Equal(t, "$1,234.50", el.TextContent())
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/table.csv", nil)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res = rec.Result()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", res.Header.Get("content-type"))
+		assert.Equal(t, "\"$1,234.50\",total\n", rec.Body.String())
+
+		t.Run("invalid format", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+				"format-A0": []string{"abc"},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+			assert.Contains(t, rec.Body.String(), "no digit placeholder")
+		})
+	})
+
+	t.Run("spilled array", func(t *testing.T) {
+		s := setup(2, 2)
+		mux := s.ServeMux()
+
+		req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+			"cell-A0": []string{"SEQUENCE(2, 2, 1)"},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		document := domtest.ParseResponseDocument(t, res)
+		if el := document.QuerySelector("#cell-A0"); assert.NotNil(t, el) {
+			assert.Equal(t, "1", el.TextContent())
+			assert.Equal(t, "cell", el.GetAttribute("class"))
+		}
+		if el := document.QuerySelector("#cell-B1"); assert.NotNil(t, el) {
+			assert.Equal(t, "4", el.TextContent())
+			assert.Equal(t, "cell spilled", el.GetAttribute("class"))
+		}
+	})
+
+	t.Run("function", func(t *testing.T) {
+		s := setup(1, 1)
+		mux := s.ServeMux()
+
+		req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+			"new-function-name": []string{"DOUBLE"},
+			"new-function":      []string{"LAMBDA(x, x * 2)"},
+			"cell-A0":           []string{"DOUBLE(21)"},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		document := domtest.ParseResponseDocument(t, res)
+		if el := document.QuerySelector("#cell-A0"); assert.NotNil(t, el) {
+			assert.Equal(t, "42", el.TextContent())
+		}
+		if el := document.QuerySelector(`input[name="function-DOUBLE"]`); assert.NotNil(t, el) {
+			assert.Equal(t, "LAMBDA(x, x*2)", el.GetAttribute("value"))
+		}
+
+		t.Run("built-in name", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+				"function-SUM": []string{"LAMBDA(x, x)"},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+			assert.Contains(t, rec.Body.String(), "SUM is a built-in function")
+		})
+
+		t.Run("invalid function leaves the table unchanged", func(t *testing.T) {
+			before := s.table.Snapshot()
+			req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+				"exchange-rates":    []string{"A0:B0"},
+				"function-DOUBLE":   []string{"LAMBDA(x, x * 3)"},
+				"new-function-name": []string{"HALF"},
+				"new-function":      []string{"1 / 2"},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+			assert.Contains(t, rec.Body.String(), "function HALF must be defined with LAMBDA")
+
+			after := s.table.Snapshot()
+			assert.Same(t, before, after)
+			assert.Empty(t, after.ExchangeRates())
+			assert.Equal(t, []clice.Function{{Name: "DOUBLE", Expression: "LAMBDA(x, x*2)"}}, after.Functions())
+		})
+	})
+
+	t.Run("exchange rates", func(t *testing.T) {
+		s := setup(2, 3)
+		mux := s.ServeMux()
+
+		req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+			"exchange-rates": []string{"A1:B2"},
+			"cell-A0":        []string{`FX(4 * USD, "EUR")`},
+			"cell-A1":        []string{`"USD"`},
+			"cell-B1":        []string{"1"},
+			"cell-A2":        []string{`"EUR"`},
+			"cell-B2":        []string{"0.5"},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		document := domtest.ParseResponseDocument(t, res)
+		if el := document.QuerySelector("#cell-A0"); assert.NotNil(t, el) {
+			assert.Equal(t, "8 EUR", el.TextContent())
+		}
+		if el := document.QuerySelector(`input[name="exchange-rates"]`); assert.NotNil(t, el) {
+			assert.Equal(t, "A1:B2", el.GetAttribute("value"))
+		}
+
+		t.Run("invalid range", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/table", strings.NewReader(url.Values{
+				"exchange-rates": []string{"A1"},
+			}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+			assert.Contains(t, rec.Body.String(), "exchange rates must be a range")
+		})
+	})
+
 	t.Run("upload", func(t *testing.T) {
 		t.Run("example file", func(t *testing.T) {
 			const tableJSON =
@@ -412,6 +605,24 @@ func TestServer(t *testing.T) {
 				assert.JSONEq(t, tableJSON, string(body))
 			})
 		})
+		t.Run("invalid file", func(t *testing.T) {
+			for _, tt := range []struct {
+				Name      string
+				TableJSON string
+				Message   string
+			}{
+				{Name: "syntax", TableJSON: `{"rows": 2,`, Message: "unexpected end of JSON input"},
+				{Name: "scale", TableJSON: `{"rows": 2, "columns": 2, "numeric": {"scale": 1000}}`, Message: "scale must be between 0 and 100, got 1000"},
+			} {
+				t.Run(tt.Name, func(t *testing.T) {
+					s := setup(2, 2)
+					mux := s.ServeMux()
+					rec := uploadJSONTableRequest(t, mux, tt.TableJSON)
+					assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+					assert.Contains(t, rec.Body.String(), tt.Message)
+				})
+			}
+		})
 	})
 }
 
@@ -0,0 +1,50 @@
+package clice
+
+import (
+	"encoding/csv"
+	"errors"
+	"go/constant"
+	"io"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// WriteCSV writes one record per row with the displayed value of every
+// column. Text is written without quotes, cells where a lookup found nothing
+// are written as #N/A, cells whose array could not spill as #SPILL!, cells
+// with a range outside the table as #REF! and cells with other errors as
+// #ERROR.
+func (table *Table) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	record := make([]string, table.ColumnLen)
+	for row := range table.RowLen {
+		for column := range record {
+			record[column] = table.Cell(column, row).csv()
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func (cell *Cell) csv() string {
+	var notFound *expression.NotFoundError
+	var spill *SpillError
+	var outside *expression.RangeError
+	switch {
+	case errors.As(cell.err, &notFound):
+		return "#N/A"
+	case errors.As(cell.err, &spill):
+		return "#SPILL!"
+	case errors.As(cell.err, &outside):
+		return "#REF!"
+	case cell.err != nil:
+		return "#ERROR"
+	}
+	if v, ok := cell.value.(constant.Value); ok && v.Kind() == constant.String {
+		return constant.StringVal(v)
+	}
+	return cell.String()
+}
@@ -0,0 +1,96 @@
+package clice
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"strings"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// SetExchangeRates sets the range, two columns wide, that FX reads exchange
+// rates from, for example "H0:I9". Each row has a currency code on the left,
+// as text or the name of the currency, and the value of one unit of that
+// currency in a currency shared by every row on the right. An empty range
+// removes the exchange rates. Like Define it does not evaluate the table.
+func (table *Table) SetExchangeRates(input string) error {
+	input = strings.ToUpper(strings.TrimSpace(input))
+	if input == "" {
+		table.rates = nil
+		return nil
+	}
+	start, end, ok := strings.Cut(input, ":")
+	if !ok || !cellNamePattern.MatchString(start) || !cellNamePattern.MatchString(end) {
+		return fmt.Errorf("exchange rates must be a range such as H0:I9, got %q", input)
+	}
+	column, row, err := CellID(start)
+	if err != nil {
+		return err
+	}
+	endColumn, endRow, err := CellID(end)
+	if err != nil {
+		return err
+	}
+	if endColumn != column+1 || endRow < row {
+		return fmt.Errorf("exchange rates %s must be two columns wide", input)
+	}
+	table.rates = &expression.Reference{
+		Kind:      expression.RangeReference,
+		Name:      input,
+		Column:    column,
+		Row:       row,
+		EndColumn: endColumn,
+		EndRow:    endRow,
+	}
+	return nil
+}
+
+// ExchangeRates returns the range set with SetExchangeRates.
+func (table *Table) ExchangeRates() string {
+	if table.rates == nil {
+		return ""
+	}
+	return table.rates.Name
+}
+
+// ExchangeRate finds a currency in the left column of the exchange rates and
+// returns the number to its right. It is used by FX.
+func (s *Scope) ExchangeRate(currency string) (constant.Value, error) {
+	rates := s.Table.rates
+	if rates == nil {
+		return nil, errors.New("the table has no exchange rates")
+	}
+	for row := rates.Row; row <= rates.EndRow; row++ {
+		code, err := s.ResolveCell(rates.Column, row)
+		if err != nil {
+			return nil, err
+		}
+		switch code := code.(type) {
+		case constant.Value:
+			if code.Kind() != constant.String || !strings.EqualFold(strings.TrimSpace(constant.StringVal(code)), currency) {
+				continue
+			}
+		case expression.Quantity:
+			if code.Unit().String() != currency {
+				continue
+			}
+		default:
+			continue
+		}
+		v, err := s.ResolveCell(rates.EndColumn, row)
+		if err != nil {
+			return nil, err
+		}
+		cell := expression.CellName(rates.EndColumn, row)
+		if _, ok := v.(expression.Blank); ok {
+			return nil, fmt.Errorf("the exchange rate for %s in %s is empty", currency, cell)
+		}
+		rate, ok := v.(constant.Value)
+		if !ok || (rate.Kind() != constant.Int && rate.Kind() != constant.Float) || constant.Sign(rate) <= 0 {
+			return nil, fmt.Errorf("the exchange rate for %s in %s is %s, not a positive number", currency, cell, v)
+		}
+		return rate, nil
+	}
+	return nil, fmt.Errorf("there is no exchange rate for %s in %s", currency, rates.Name)
+}
@@ -0,0 +1,71 @@
+package clice_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice"
+)
+
+func TestTable_exchangeRates(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 3,
+  "rows": 4,
+  "dialect": "formula",
+  "rates": "B0:C2",
+  "cells": [
+    {"id": "A0", "ex": "=FX(100 EUR, \"USD\")"},
+    {"id": "A1", "ex": "=A0 + 10 USD"},
+    {"id": "A2", "ex": "=FX(A1, \"GBP\")"},
+    {"id": "A3", "ex": "=FX(1 JPY, \"USD\")"},
+    {"id": "B0", "ex": "=\"USD\""},
+    {"id": "B1", "ex": "=EUR"},
+    {"id": "B2", "ex": "=\"GBP\""},
+    {"id": "C0", "ex": "=1"},
+    {"id": "C1", "ex": "=1.25"},
+    {"id": "C2", "ex": "=1.6"}
+  ]
+}`
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var table clice.Table
+			table.Workers = workers
+			require.Error(t, json.Unmarshal([]byte(tableJSON), &table))
+			assert.Equal(t, "125 USD", table.Cell(0, 0).String())
+			assert.Equal(t, "135 USD", table.Cell(0, 1).String())
+			assert.Equal(t, "84.375 GBP", table.Cell(0, 2).String())
+			assert.Equal(t, "FX: there is no exchange rate for JPY in B0:C2", table.Cell(0, 3).Error())
+			assert.Equal(t, "B0:C2", table.ExchangeRates())
+
+			out, err := json.Marshal(&table)
+			require.NoError(t, err)
+			assert.JSONEq(t, tableJSON, string(out))
+
+			require.Error(t, table.Apply(clice.Assignment{Identifier: "C1", Expression: "=2"}))
+			assert.Equal(t, "200 USD", table.Cell(0, 0).String())
+
+			require.Error(t, table.Apply(clice.Assignment{Identifier: "C1", Expression: `="two"`}))
+			assert.Equal(t, `FX: the exchange rate for EUR in C1 is "two", not a positive number`, table.Cell(0, 0).Error())
+
+			require.Error(t, table.Apply(clice.Assignment{Identifier: "C1", Expression: ""}))
+			assert.Equal(t, "FX: the exchange rate for EUR in C1 is empty", table.Cell(0, 0).Error())
+
+			require.NoError(t, table.SetExchangeRates(""))
+			require.Error(t, table.Evaluate())
+			assert.Equal(t, "FX: the table has no exchange rates", table.Cell(0, 0).Error())
+		})
+	}
+
+	table := clice.NewTable(3, 3)
+	assert.EqualError(t, table.SetExchangeRates("A0"), `exchange rates must be a range such as H0:I9, got "A0"`)
+	assert.EqualError(t, table.SetExchangeRates("A0:A2"), "exchange rates A0:A2 must be two columns wide")
+	assert.EqualError(t, table.SetExchangeRates("A2:B0"), "exchange rates A2:B0 must be two columns wide")
+	require.NoError(t, table.SetExchangeRates("b0:c2"))
+	assert.Equal(t, "B0:C2", table.ExchangeRates())
+}
@@ -0,0 +1,326 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// Array is a rectangle of values. A range used outside of a function
+// argument, an operator applied to an array and the functions SEQUENCE,
+// SORT, FILTER and UNIQUE evaluate to arrays. A table spills an array into
+// the cells to the right of and below the cell that computes it.
+type Array struct {
+	columns int
+	values  []Value // in row-major order
+}
+
+// Columns returns the width of the array.
+func (a Array) Columns() int { return a.columns }
+
+// Rows returns the height of the array.
+func (a Array) Rows() int {
+	if a.columns == 0 {
+		return 0
+	}
+	return len(a.values) / a.columns
+}
+
+// At returns the value at a zero-based column and row.
+func (a Array) At(column, row int) Value {
+	return a.values[row*a.columns+column]
+}
+
+// String separates the values in a row with commas and the rows with
+// semicolons: {1, 2; 3, 4}.
+func (a Array) String() string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range a.values {
+		switch {
+		case i == 0:
+		case i%a.columns == 0:
+			sb.WriteString("; ")
+		default:
+			sb.WriteString(", ")
+		}
+		sb.WriteString(v.String())
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func (a Array) row(i int) []Value {
+	return a.values[i*a.columns : (i+1)*a.columns]
+}
+
+// transpose swaps the rows and columns.
+func (a Array) transpose() Array {
+	rows := a.Rows()
+	result := Array{columns: rows, values: make([]Value, len(a.values))}
+	for i, v := range a.values {
+		result.values[(i%a.columns)*rows+i/a.columns] = v
+	}
+	return result
+}
+
+// array returns the values of the cells in a range. Blank cells are zero.
+func (ev *evaluation) array(r cellRange) (Array, error) {
+	values, err := ev.resolveRange(r)
+	if err != nil {
+		return Array{}, err
+	}
+	for i, v := range values {
+		values[i] = zeroIfBlank(v)
+	}
+	return Array{columns: r.columns(), values: values}, nil
+}
+
+// arrayOp applies an operator to each element of the arrays. An operand that
+// is not an array, or is an array with a single element, is combined with
+// every element of the other.
+func arrayOp(x Value, op func(x, y Value) (Value, error), y Value) (Value, error) {
+	a, aok := x.(Array)
+	b, bok := y.(Array)
+	switch {
+	case aok && bok && len(a.values) == 1:
+		return arrayOp(a.values[0], op, b)
+	case aok && bok && len(b.values) == 1:
+		return arrayOp(a, op, b.values[0])
+	case aok && bok && (a.columns != b.columns || a.Rows() != b.Rows()):
+		return nil, fmt.Errorf("the arrays have different sizes, %s and %s", a.size(), b.size())
+	}
+	shape := a
+	if !aok {
+		shape = b
+	}
+	result := Array{columns: shape.columns, values: make([]Value, len(shape.values))}
+	for i := range result.values {
+		xi, yi := x, y
+		if aok {
+			xi = a.values[i]
+		}
+		if bok {
+			yi = b.values[i]
+		}
+		v, err := op(xi, yi)
+		if err != nil {
+			return nil, err
+		}
+		result.values[i] = v
+	}
+	return result, nil
+}
+
+func (a Array) size() string {
+	return fmt.Sprintf("%d×%d", a.Rows(), a.columns)
+}
+
+// arrayArg returns an argument as an array. Other values are an array of one
+// element.
+func arrayArg(args []Value, i int) Array {
+	if a, ok := args[i].(Array); ok {
+		return a
+	}
+	return Array{columns: 1, values: []Value{args[i]}}
+}
+
+// boolArg returns an optional boolean argument.
+func boolArg(args []Value, i int) (bool, error) {
+	if len(args) <= i {
+		return false, nil
+	}
+	if !isBool(args[i]) {
+		return false, fmt.Errorf("argument %d is %s, not a boolean", i+1, exactString(args[i]))
+	}
+	return constant.BoolVal(args[i].(constant.Value)), nil
+}
+
+// sequence returns an array of numbers counting by step from start, which
+// defaults to 0, across each row and then down: SEQUENCE(rows, [columns],
+// [start], [step]).
+func sequence(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, columns := nums[0], constant.MakeInt64(1)
+	if len(nums) > 1 {
+		columns = nums[1]
+	}
+	n, ok := integer(rows)
+	m, mok := integer(columns)
+	if !ok || !mok || n < 1 || m < 1 {
+		return nil, fmt.Errorf("rows and columns must be whole numbers of at least 1, got %s and %s", rows.ExactString(), columns.ExactString())
+	}
+	if n*m > maxArrayLen {
+		return nil, fmt.Errorf("%d×%d is more than %d values", n, m, maxArrayLen)
+	}
+	v, step := Value(constant.MakeInt64(0)), Value(constant.MakeInt64(1))
+	if len(nums) > 2 {
+		v = nums[2]
+	}
+	if len(nums) > 3 {
+		step = nums[3]
+	}
+	result := Array{columns: int(m), values: make([]Value, n*m)}
+	for i := range result.values {
+		result.values[i] = v
+		if v, err = binaryOp(v, token.ADD, step); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// maxArrayLen limits the arrays built by SEQUENCE.
+const maxArrayLen = 1 << 20
+
+// sortArray sorts the rows of an array by the values in a zero-based column:
+// SORT(array, [column], [order], [by column]). The order is 1 for ascending
+// and -1 for descending. When the fourth argument is true the columns are
+// sorted by the values in a row instead. Numbers sort before text and text
+// before booleans; text is compared without regard to case.
+func sortArray(args []Value) (Value, error) {
+	a := arrayArg(args, 0)
+	byColumn, err := boolArg(args, 3)
+	if err != nil {
+		return nil, err
+	}
+	if byColumn {
+		a = a.transpose()
+	}
+	index, order := 0, 1
+	if len(args) > 1 {
+		if index, err = integerArg(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 2 {
+		if order, err = integerArg(args, 2); err != nil {
+			return nil, err
+		}
+	}
+	if index < 0 || index >= a.columns {
+		return nil, fmt.Errorf("sort index %d is outside the array, which has %d %s", index, a.columns, plural(a.columns, "value"))
+	}
+	if order != 1 && order != -1 {
+		return nil, fmt.Errorf("sort order must be 1 or -1, got %d", order)
+	}
+	rows := make([][]Value, a.Rows())
+	for i := range rows {
+		rows[i] = a.row(i)
+	}
+	slices.SortStableFunc(rows, func(x, y []Value) int {
+		return order * sortOrder(x[index], y[index])
+	})
+	result := Array{columns: a.columns, values: slices.Concat(rows...)}
+	if byColumn {
+		result = result.transpose()
+	}
+	return result, nil
+}
+
+// sortOrder compares values of any kind for SORT.
+func sortOrder(x, y Value) int {
+	rank := func(v Value) int {
+		switch {
+		case isText(v):
+			return 1
+		case isBool(v):
+			return 2
+		default:
+			return 0
+		}
+	}
+	if c, ok := compareValues(x, y); ok {
+		return c
+	}
+	return rank(x) - rank(y)
+}
+
+// filter returns the rows of an array where a column of booleans is true,
+// or the columns where a row of booleans is true: FILTER(array, include,
+// [if empty]). The third argument is returned when nothing is included.
+func filter(args []Value) (Value, error) {
+	a, include := arrayArg(args, 0), arrayArg(args, 1)
+	byColumn := include.Rows() == 1 && include.columns > 1
+	if byColumn {
+		a, include = a.transpose(), include.transpose()
+	}
+	if include.columns != 1 || include.Rows() != a.Rows() {
+		return nil, fmt.Errorf("include must be one column with a value for each row or one row with a value for each column of the array, got %s for %s", include.size(), a.size())
+	}
+	var values []Value
+	for i, v := range include.values {
+		if !isBool(v) {
+			return nil, fmt.Errorf("include has %s, not a boolean", exactString(v))
+		}
+		if constant.BoolVal(v.(constant.Value)) {
+			values = append(values, a.row(i)...)
+		}
+	}
+	if len(values) == 0 {
+		if len(args) > 2 {
+			return args[2], nil
+		}
+		return nil, errors.New("nothing is included")
+	}
+	result := Array{columns: a.columns, values: values}
+	if byColumn {
+		result = result.transpose()
+	}
+	return result, nil
+}
+
+// unique returns the distinct rows of an array in the order they first
+// appear: UNIQUE(array, [by column], [exactly once]). Text is compared
+// without regard to case. When the third argument is true only the rows that
+// appear once are returned.
+func unique(args []Value) (Value, error) {
+	a := arrayArg(args, 0)
+	byColumn, err := boolArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	once, err := boolArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if byColumn {
+		a = a.transpose()
+	}
+	var distinct [][]Value
+	var counts []int
+	for i := range a.Rows() {
+		row := a.row(i)
+		j := slices.IndexFunc(distinct, func(d []Value) bool {
+			return slices.EqualFunc(d, row, func(x, y Value) bool {
+				c, ok := compareValues(x, y)
+				return ok && c == 0
+			})
+		})
+		if j < 0 {
+			distinct, counts = append(distinct, row), append(counts, 0)
+			j = len(distinct) - 1
+		}
+		counts[j]++
+	}
+	var values []Value
+	for i, row := range distinct {
+		if !once || counts[i] == 1 {
+			values = append(values, row...)
+		}
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no row appears exactly once")
+	}
+	result := Array{columns: a.columns, values: values}
+	if byColumn {
+		result = result.transpose()
+	}
+	return result, nil
+}
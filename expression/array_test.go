@@ -0,0 +1,140 @@
+package expression_test
+
+import (
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// fruit has names in A0:A4 and quantities in B0:B4:
+//
+//	   A          B
+//	0  "pear"     3
+//	1  "apple"    7
+//	2  "Pear"     1
+//	3  "fig"      7
+//	4  "apple"    2
+func fruit() fakeLookup {
+	return cellLookup(map[string]expression.Value{
+		"A0": constant.MakeString("pear"), "B0": constant.MakeInt64(3),
+		"A1": constant.MakeString("apple"), "B1": constant.MakeInt64(7),
+		"A2": constant.MakeString("Pear"), "B2": constant.MakeInt64(1),
+		"A3": constant.MakeString("fig"), "B3": constant.MakeInt64(7),
+		"A4": constant.MakeString("apple"), "B4": constant.MakeInt64(2),
+	})
+}
+
+func TestArrays(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "range", Expression: "=A0:B1", Result: `{"pear", 3; "apple", 7}`},
+		{Name: "blank cells are zero", Expression: "=B4:C5", Result: "{2, 0; 0, 0}"},
+		{Name: "element-wise", Expression: "=B0:B2 * B2:B4", Result: "{3; 49; 2}"},
+		{Name: "scalar", Expression: "=B0:B2 * 10 + 1", Result: "{31; 71; 11}"},
+		{Name: "comparison", Expression: "=B0:B2 > 2", Result: "{true; true; false}"},
+		{Name: "negation", Expression: "=-B0:B1", Result: "{-3; -7}"},
+		{Name: "concatenation", Expression: `=A0:A1 + "s"`, Result: `{"pears"; "apples"}`},
+		{Name: "sum of products", Expression: "=SUM(B0:B4 * B0:B4)", Result: "112"},
+		{Name: "sequence", Expression: "=SEQUENCE(3)", Result: "{0; 1; 2}"},
+		{Name: "sequence grid", Expression: "=SEQUENCE(2, 3, 1)", Result: "{1, 2, 3; 4, 5, 6}"},
+		{Name: "sequence step", Expression: "=SEQUENCE(1, 3, 10, -2.5)", Result: "{10, 7.5, 5}"},
+		{Name: "sum of a sequence", Expression: "=SUM(SEQUENCE(10))", Result: "45"},
+		{Name: "sort", Expression: "=SORT(B0:B4)", Result: "{1; 2; 3; 7; 7}"},
+		{Name: "sort text", Expression: "=SORT(A0:A4)", Result: `{"apple"; "apple"; "fig"; "pear"; "Pear"}`},
+		{Name: "sort descending by column", Expression: "=SORT(A0:B4, 1, -1)", Result: `{"apple", 7; "fig", 7; "pear", 3; "apple", 2; "Pear", 1}`},
+		{Name: "sort columns", Expression: "=SORT(SEQUENCE(2, 3), 0, -1, TRUE)", Result: "{2, 1, 0; 5, 4, 3}"},
+		{Name: "sort mixed", Expression: "=SORT(IF(TRUE, A0:B0), 0, 1, TRUE)", Result: `{3, "pear"}`},
+		{Name: "filter", Expression: "=FILTER(A0:A4, B0:B4 > 2)", Result: `{"pear"; "apple"; "fig"}`},
+		{Name: "filter rows", Expression: `=FILTER(A0:B4, A0:A4 = "apple")`, Result: `{"apple", 7; "apple", 2}`},
+		{Name: "filter columns", Expression: "=FILTER(SEQUENCE(2, 3), SEQUENCE(1, 3) <> 1)", Result: "{0, 2; 3, 5}"},
+		{Name: "filter if empty", Expression: `=FILTER(A0:A4, B0:B4 > 10, "none")`, Result: `"none"`},
+		{Name: "unique", Expression: "=UNIQUE(A0:A4)", Result: `{"pear"; "apple"; "fig"}`},
+		{Name: "unique rows", Expression: "=UNIQUE(B0:B4)", Result: "{3; 7; 1; 2}"},
+		{Name: "unique once", Expression: "=UNIQUE(B0:B4, FALSE, TRUE)", Result: "{3; 1; 2}"},
+		{Name: "unique columns", Expression: "=UNIQUE(SEQUENCE(1, 4) * 0, TRUE)", Result: "{0}"},
+		{Name: "sorted unique filter", Expression: "=SORT(UNIQUE(FILTER(A0:A4, B0:B4 < 5)))", Result: `{"apple"; "pear"}`},
+		{Name: "count of unique", Expression: "=COUNTA(UNIQUE(A0:A4))", Result: "3"},
+		{Name: "offset", Expression: "=OFFSET(B0, 1, 0, 2) * 2", Result: "{14; 2}"},
+		{Name: "match in an array", Expression: `=MATCH("fig", SORT(A0:A4))`, Result: "2"},
+		{Name: "vlookup in an array", Expression: `=VLOOKUP("fig", SORT(A0:B4), 1)`, Result: "7"},
+		{Name: "hlookup in an array", Expression: "=HLOOKUP(2, SEQUENCE(2, 3), 1)", Result: "5"},
+		{Name: "xlookup in arrays", Expression: `=XLOOKUP("fig", UNIQUE(A0:A4), SEQUENCE(3))`, Result: "2"},
+		{Name: "percentile of an array", Expression: "=PERCENTILE(SEQUENCE(5), 0.5)", Result: "2"},
+		{Name: "quartile of an array", Expression: "=QUARTILE(SORT(B0:B4), 1)", Result: "2"},
+		{Name: "rank in an array", Expression: "=RANK(7, B0:B4 * 1)", Result: "1"},
+		{Name: "correlation of arrays", Expression: "=CORREL(SEQUENCE(4), SEQUENCE(4) * -2)", Result: "-1"},
+		{Name: "irr of an array", Expression: "=ROUND(IRR(SEQUENCE(3, 1, -10, 11)), 4)", Result: "0.1466"},
+		{Name: "countif of an array", Expression: `=COUNTIF(UNIQUE(B0:B4), ">2")`, Result: "2"},
+		{Name: "sumif of arrays", Expression: `=SUMIF(A0:A4, "apple", B0:B4 * 10)`, Result: "90"},
+		{Name: "percentile of a name", Expression: "=LET(x, FILTER(B0:B4, B0:B4 > 2), PERCENTILE(x, 0))", Result: "3"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestArrays_errors(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "=A0:A2 + B0:B1", Error: "the arrays have different sizes, 3×1 and 2×1"},
+		{Expression: "=A0:A1 * 2", Error: `cannot apply * to "pear" (text) and 2 (number)`},
+		{Expression: "=SEQUENCE(0)", Error: "SEQUENCE: rows and columns must be whole numbers of at least 1, got 0 and 1"},
+		{Expression: "=SEQUENCE(2000, 2000)", Error: "SEQUENCE: 2000×2000 is more than 1048576 values"},
+		{Expression: "=SORT(A0:B4, 2)", Error: "SORT: sort index 2 is outside the array, which has 2 values"},
+		{Expression: "=SORT(A0:B4, 0, 0)", Error: "SORT: sort order must be 1 or -1, got 0"},
+		{Expression: "=FILTER(A0:A4, B0:B2 > 1)", Error: "FILTER: include must be one column with a value for each row or one row with a value for each column of the array, got 3×1 for 5×1"},
+		{Expression: "=FILTER(A0:A4, B0:B4)", Error: "FILTER: include has 3, not a boolean"},
+		{Expression: "=FILTER(A0:A4, B0:B4 > 10)", Error: "FILTER: nothing is included"},
+		{Expression: "=UNIQUE(A0:A4, 1)", Error: "UNIQUE: argument 2 is 1, not a boolean"},
+		{Expression: "=UNIQUE(B0:B1 * 0, FALSE, TRUE)", Error: "UNIQUE: no row appears exactly once"},
+		{Expression: "=ROWS(SEQUENCE(3))", Error: "ROWS: argument 1 is {0; 1; 2}, not a range"},
+		{Expression: "=INDEX(B0:B4 * 2, 1)", Error: "expected a cell or a range"},
+		{Expression: "=MATCH(1, SEQUENCE(2, 2))", Error: "MATCH: argument 2 must be one row or one column, got {0, 1; 2, 3}"},
+		{Expression: "=PERCENTILE(B0 * 2, 0.5)", Error: "expected a cell, a range or an array"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+}
+
+func TestReturnsArray(t *testing.T) {
+	for expr, expected := range map[string]bool{
+		"=A0:A3":                true,
+		"=A0:A3 * 2":            true,
+		"=-(A0:A3)":             true,
+		"=SORT(A0:A3)":          true,
+		"=sequence(3)":          true,
+		"=OFFSET(A0, 1, 1)":     true,
+		"=IF(A0, B0:B3, 0)":     true,
+		"=SUM(A0:A3)":           false,
+		"=SUM(SEQUENCE(3)) + 1": false,
+		"=IF(A0, 1, 0)":         false,
+		"=VLOOKUP(1, A0:B3, 1)": false,
+		"=A0 + 1":               false,
+	} {
+		node, err := expression.FormulaDialect.Parse(expr)
+		require.NoError(t, err)
+		assert.Equal(t, expected, expression.ReturnsArray(node), expr)
+	}
+}
@@ -0,0 +1,188 @@
+package expression
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"strings"
+)
+
+// maxShift limits the shift count of << and >> so a shift can not build an
+// enormous number.
+const maxShift = 1024
+
+// maxDigits limits the length that DEC2HEX and BASE pad their results to.
+const maxDigits = 255
+
+// wholeNumber converts a number with an integer value to an integer. The
+// float and decimal number models may give fractions such as 4.0.
+func wholeNumber(x Value) (constant.Value, bool) {
+	if !isNumber(x) {
+		return nil, false
+	}
+	n := constant.ToInt(x.(constant.Value))
+	return n, n.Kind() == constant.Int
+}
+
+// bitwiseOp applies &, |, ^, &^, << or >> to whole numbers. Negative numbers
+// behave as two's complement numbers with an unlimited number of bits.
+func bitwiseOp(x constant.Value, op token.Token, y constant.Value) (Value, error) {
+	a, aok := wholeNumber(x)
+	b, bok := wholeNumber(y)
+	if !aok || !bok {
+		return nil, &TypeError{Op: op, X: x, Y: y}
+	}
+	if op != token.SHL && op != token.SHR {
+		return constant.BinaryOp(a, op, b), nil
+	}
+	if constant.Sign(b) < 0 {
+		return nil, fmt.Errorf("negative shift count %s", b.ExactString())
+	}
+	if s, exact := constant.Uint64Val(b); exact && s <= maxShift {
+		return constant.Shift(a, op, uint(s)), nil
+	}
+	return nil, fmt.Errorf("shift count %s is more than %d", b.ExactString(), maxShift)
+}
+
+// bitwise returns a function that applies a bitwise operator or a shift to
+// its two arguments: BITAND, BITOR, BITXOR, BITLSHIFT and BITRSHIFT.
+func bitwise(op token.Token) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		nums, err := numbers(args)
+		if err != nil {
+			return nil, err
+		}
+		return bitwiseOp(nums[0], op, nums[1])
+	}
+}
+
+// naturals checks that every argument is a whole number that is not
+// negative.
+func naturals(args []Value) ([]*big.Int, error) {
+	result := make([]*big.Int, len(args))
+	for i, arg := range args {
+		n, ok := wholeNumber(arg)
+		if !ok || constant.Sign(n) < 0 {
+			return nil, fmt.Errorf("argument %d is %s, not a non-negative whole number", i+1, exactString(arg))
+		}
+		switch v := constant.Val(n).(type) {
+		case int64:
+			result[i] = big.NewInt(v)
+		case *big.Int:
+			result[i] = new(big.Int).Set(v)
+		}
+	}
+	return result, nil
+}
+
+// gcd returns the greatest common divisor of its arguments: GCD(number,
+// ...). It is zero when every argument is zero.
+func gcd(args []Value) (Value, error) {
+	nums, err := naturals(args)
+	if err != nil {
+		return nil, err
+	}
+	result := new(big.Int)
+	for _, n := range nums {
+		result.GCD(nil, nil, result, n)
+	}
+	return constant.Make(result), nil
+}
+
+// lcm returns the least common multiple of its arguments: LCM(number, ...).
+// It is zero when any argument is zero.
+func lcm(args []Value) (Value, error) {
+	nums, err := naturals(args)
+	if err != nil {
+		return nil, err
+	}
+	result := big.NewInt(1)
+	for _, n := range nums {
+		if n.Sign() == 0 {
+			return constant.MakeInt64(0), nil
+		}
+		d := new(big.Int).GCD(nil, nil, result, n)
+		result.Mul(result, n.Quo(n, d))
+	}
+	return constant.Make(result), nil
+}
+
+// hex2dec converts hexadecimal text, which may start with 0x, to a number:
+// HEX2DEC(text). Unlike spreadsheets that read ten digits as a signed 40-bit
+// number, the digits are read without a limit.
+func hex2dec(args []Value) (Value, error) {
+	s := strings.TrimSpace(text(args[0]))
+	if len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X") {
+		s = s[2:]
+	}
+	return parseBase(s, 16)
+}
+
+// decimal converts text in a radix from 2 to 36 to a number: DECIMAL(text,
+// radix). Letters are digits from 10 and are not case-sensitive.
+func decimal(args []Value) (Value, error) {
+	radix, err := radixArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return parseBase(strings.TrimSpace(text(args[0])), radix)
+}
+
+func parseBase(s string, radix int) (Value, error) {
+	n, ok := new(big.Int).SetString(s, radix)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a base %d number", s, radix)
+	}
+	return constant.Make(n), nil
+}
+
+// dec2hex converts a number to upper case hexadecimal text padded with zeros
+// to an optional number of digits: DEC2HEX(number, [digits]).
+func dec2hex(args []Value) (Value, error) {
+	return formatBase(args, 16, 1)
+}
+
+// base converts a number to text in a radix from 2 to 36 padded with zeros
+// to an optional number of digits: BASE(number, radix, [digits]).
+func base(args []Value) (Value, error) {
+	radix, err := radixArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return formatBase(args, radix, 2)
+}
+
+// formatBase formats the first argument, which must not be negative. The
+// optional number of digits is the argument at index digits.
+func formatBase(args []Value, radix int, digits int) (Value, error) {
+	nums, err := naturals(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	s := strings.ToUpper(nums[0].Text(radix))
+	if len(args) > digits {
+		n, err := integerArg(args, digits)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > maxDigits {
+			return nil, fmt.Errorf("digits must be between 0 and %d, got %d", maxDigits, n)
+		}
+		if len(s) < n {
+			s = strings.Repeat("0", n-len(s)) + s
+		}
+	}
+	return constant.MakeString(s), nil
+}
+
+func radixArg(args []Value, i int) (int, error) {
+	radix, err := integerArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+	if radix < 2 || radix > 36 {
+		return 0, fmt.Errorf("radix must be between 2 and 36, got %d", radix)
+	}
+	return radix, nil
+}
@@ -0,0 +1,77 @@
+package expression_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestIntegerFunctions(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "gcd", Expression: "=GCD(24, 36, 60)", Result: "12"},
+		{Name: "gcd of a range", Expression: "=GCD(B0:B1, 21)", Result: "1"},
+		{Name: "gcd of zero", Expression: "=GCD(0, 0)", Result: "0"},
+		{Name: "lcm", Expression: "=LCM(4, 6, 10)", Result: "60"},
+		{Name: "lcm with zero", Expression: "=LCM(4, 0)", Result: "0"},
+		{Name: "large lcm", Expression: "=LCM(2^64, 3)", Result: "55340232221128654848"},
+		{Name: "bitand", Expression: "=BITAND(B1, 5)", Result: "5"},
+		{Name: "bitor", Expression: "=BITOR(8, 1)", Result: "9"},
+		{Name: "bitxor", Expression: "=BITXOR(15, 5)", Result: "10"},
+		{Name: "bitlshift", Expression: "=BITLSHIFT(3, 4)", Result: "48"},
+		{Name: "bitrshift", Expression: "=BITRSHIFT(48, 4)", Result: "3"},
+		{Name: "hex2dec", Expression: `=HEX2DEC("ff")`, Result: "255"},
+		{Name: "hex2dec prefix", Expression: `=HEX2DEC(" 0x1F ")`, Result: "31"},
+		{Name: "hex2dec large", Expression: `=HEX2DEC("FFFFFFFFFFFFFFFFFF")`, Result: "4722366482869645213695"},
+		{Name: "dec2hex", Expression: "=DEC2HEX(255)", Result: `"FF"`},
+		{Name: "dec2hex digits", Expression: "=DEC2HEX(10, 4)", Result: `"000A"`},
+		{Name: "dec2hex round trip", Expression: `=HEX2DEC(DEC2HEX(123456789))`, Result: "123456789"},
+		{Name: "base", Expression: "=BASE(B1, 2)", Result: `"111"`},
+		{Name: "base digits", Expression: "=BASE(5, 2, 8)", Result: `"00000101"`},
+		{Name: "base 36", Expression: "=BASE(1295, 36)", Result: `"ZZ"`},
+		{Name: "decimal", Expression: `=DECIMAL("zz", 36)`, Result: "1295"},
+		{Name: "decimal binary", Expression: `=DECIMAL("1010", 2)`, Result: "10"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestIntegerFunctions_errors(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "=GCD(4, -2)", Error: "GCD: argument 2 is -2, not a non-negative whole number"},
+		{Expression: "=LCM(1.5)", Error: "LCM: argument 1 is 3/2, not a non-negative whole number"},
+		{Expression: "=BITAND(1.5, 1)", Error: "BITAND: cannot apply & to 1.5 (number) and 1 (number)"},
+		{Expression: `=BITOR("a", 1)`, Error: `BITOR: argument 1 is "a", not a number`},
+		{Expression: "=BITLSHIFT(1, -1)", Error: "BITLSHIFT: negative shift count -1"},
+		{Expression: `=HEX2DEC("xyz")`, Error: `HEX2DEC: "xyz" is not a base 16 number`},
+		{Expression: `=HEX2DEC("")`, Error: `HEX2DEC: "" is not a base 16 number`},
+		{Expression: "=DEC2HEX(-1)", Error: "DEC2HEX: argument 1 is -1, not a non-negative whole number"},
+		{Expression: "=DEC2HEX(1, 300)", Error: "DEC2HEX: digits must be between 0 and 255, got 300"},
+		{Expression: "=BASE(1, 1)", Error: "BASE: radix must be between 2 and 36, got 1"},
+		{Expression: `=DECIMAL("12", 2)`, Error: `DECIMAL: "12" is not a base 2 number`},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package expression
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// Check reports the problems that would prevent expr from being compiled or
+// evaluated: unsupported node types, calls to built-in functions with the
+// wrong number of arguments, names that can not be bound and calls to
+// functions that are neither built in, bound by LET or LAMBDA nor defined.
+// Unlike Compile it does not stop at the first problem. A nil defined means
+// no other functions are defined.
+func Check(expr ast.Expr, defined func(name string) bool) []*Diagnostic {
+	var result []*Diagnostic
+	var check func(node ast.Node, bound []string)
+	check = func(node ast.Node, bound []string) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch e := node.(type) {
+			case nil:
+				return false
+			case *ast.BasicLit, *ast.Ident, *ast.ParenExpr, *ast.UnaryExpr, *ast.BinaryExpr:
+				return true
+			case *ast.FuncLit:
+				if names, body, d := funcLitLambda(e); d != nil {
+					result = append(result, d)
+				} else {
+					check(body, append(slices.Clip(bound), names...))
+				}
+				return false
+			case *ast.CallExpr:
+				if !calledBuiltin(e) {
+					ident, ok := e.Fun.(*ast.Ident)
+					if ok && !slices.Contains(bound, ident.Name) && (defined == nil || !defined(ident.Name)) {
+						result = append(result, newDiagnostic(ident, fmt.Errorf("unknown function %s", ident.Name)))
+					}
+					return true
+				}
+				_, fn, d := resolveCall(e)
+				if d == nil && fn.bind != nil {
+					var names []string
+					if names, _, d = bindingNames(e, fn); d == nil {
+						for _, arg := range e.Args {
+							check(arg, append(slices.Clip(bound), names...))
+						}
+						return false
+					}
+				}
+				if d != nil {
+					result = append(result, d)
+				}
+				return true
+			default:
+				result = append(result, newDiagnostic(node, &UnsupportedError{Expr: node.(ast.Expr)}))
+				return false
+			}
+		})
+	}
+	check(expr, nil)
+	return result
+}
+
+type ReferenceKind int
+
+const (
+	CellReference ReferenceKind = iota
+	RangeReference
+	NameReference
+
+	// DynamicReference is a call to a function such as OFFSET or INDIRECT
+	// that refers to cells only known when it is evaluated.
+	DynamicReference
+
+	// RelativeReference is a call to REL with literal arguments. Its columns
+	// and rows are offsets from the cell the expression belongs to.
+	RelativeReference
+)
+
+// Reference is a cell, range or other name used by an expression.
+type Reference struct {
+	Kind ReferenceKind
+
+	// Name is the identifier as written. For ranges it is both corners
+	// separated by a colon.
+	Name string
+
+	// Column and Row locate a cell reference. For ranges they locate the top
+	// left corner and EndColumn and EndRow the bottom right corner.
+	Column, Row       int
+	EndColumn, EndRow int
+
+	// Start and End are byte offsets of the reference in the source.
+	Start, End int
+}
+
+// Contains reports whether the cell at column and row is referenced.
+func (ref Reference) Contains(column, row int) bool {
+	switch ref.Kind {
+	case CellReference:
+		return ref.Column == column && ref.Row == row
+	case RangeReference:
+		return ref.Column <= column && column <= ref.EndColumn && ref.Row <= row && row <= ref.EndRow
+	default:
+		return false
+	}
+}
+
+// References returns every reference in expr in source order. Function
+// names and the boolean literals true and false are not references. Ranges
+// are binary expressions using the token.COLON operator with a cell
+// identifier on each side. Calls to REL with literal arguments are relative
+// references. Calls to OFFSET, INDIRECT, REL with other arguments and
+// functions that are not built in are dynamic references, since the cells
+// used by a LAMBDA are only known when it is called.
+func References(expr ast.Expr) []Reference {
+	var result []Reference
+	var visit func(node ast.Expr)
+	visit = func(node ast.Expr) {
+		switch e := node.(type) {
+		case *ast.Ident:
+			if ref, ok := identReference(e); ok {
+				result = append(result, ref)
+			}
+		case *ast.ParenExpr:
+			visit(e.X)
+		case *ast.UnaryExpr:
+			visit(e.X)
+		case *ast.BinaryExpr:
+			if ref, ok := rangeReference(e); ok {
+				result = append(result, ref)
+				return
+			}
+			visit(e.X)
+			visit(e.Y)
+		case *ast.CallExpr:
+			name := "LAMBDA"
+			ident, isIdent := e.Fun.(*ast.Ident)
+			if isIdent {
+				name = strings.ToUpper(ident.Name)
+			}
+			fn, builtin := functions[name]
+			relative, isRelative := Reference{}, false
+			if isIdent && name == "REL" {
+				relative, isRelative = relativeReference(e)
+			}
+			if isRelative {
+				result = append(result, relative)
+			} else if !isIdent || !builtin || fn.dynamic {
+				result = append(result, Reference{
+					Kind:  DynamicReference,
+					Name:  name,
+					Start: offset(e.Pos()),
+					End:   offset(e.End()),
+				})
+			}
+			if !isIdent {
+				visit(e.Fun)
+			}
+			for _, arg := range e.Args {
+				visit(arg)
+			}
+		case *ast.FuncLit:
+			if _, body, d := funcLitLambda(e); d == nil {
+				visit(body)
+			}
+		}
+	}
+	if expr != nil {
+		visit(expr)
+	}
+	return result
+}
+
+// ReturnsArray reports whether expr may evaluate to an Array: ranges outside
+// of function arguments, calls to array functions such as SORT, calls to
+// OFFSET, INDIRECT and functions that are not built in, and operators,
+// conditionals and LET with such an operand. Other expressions never
+// evaluate to an array.
+func ReturnsArray(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return ReturnsArray(e.X)
+	case *ast.UnaryExpr:
+		return ReturnsArray(e.X)
+	case *ast.BinaryExpr:
+		if _, ok := rangeReference(e); ok {
+			return true
+		}
+		return ReturnsArray(e.X) || ReturnsArray(e.Y)
+	case *ast.CallExpr:
+		if !calledBuiltin(e) {
+			return true
+		}
+		fn := functions[strings.ToUpper(e.Fun.(*ast.Ident).Name)]
+		switch {
+		case fn.arrays || fn.dynamic:
+			return true
+		case fn.compile != nil || fn.bind != nil:
+			return slices.ContainsFunc(e.Args, ReturnsArray)
+		}
+	}
+	return false
+}
+
+func identReference(ident *ast.Ident) (Reference, bool) {
+	switch ident.Name {
+	case "true", "false":
+		return Reference{}, false
+	}
+	ref := Reference{
+		Kind:  NameReference,
+		Name:  ident.Name,
+		Start: offset(ident.Pos()),
+		End:   offset(ident.End()),
+	}
+	if column, row, ok := parseCellName(ident.Name); ok {
+		ref.Kind = CellReference
+		ref.Column, ref.Row = column, row
+		ref.EndColumn, ref.EndRow = column, row
+	}
+	return ref, true
+}
+
+func rangeReference(e *ast.BinaryExpr) (Reference, bool) {
+	if e.Op != token.COLON {
+		return Reference{}, false
+	}
+	from, ok := e.X.(*ast.Ident)
+	if !ok {
+		return Reference{}, false
+	}
+	to, ok := e.Y.(*ast.Ident)
+	if !ok {
+		return Reference{}, false
+	}
+	c0, r0, ok := parseCellName(from.Name)
+	if !ok {
+		return Reference{}, false
+	}
+	c1, r1, ok := parseCellName(to.Name)
+	if !ok {
+		return Reference{}, false
+	}
+	return Reference{
+		Kind:      RangeReference,
+		Name:      fmt.Sprintf("%s:%s", from.Name, to.Name),
+		Column:    min(c0, c1),
+		Row:       min(r0, r1),
+		EndColumn: max(c0, c1),
+		EndRow:    max(r0, r1),
+		Start:     offset(e.Pos()),
+		End:       offset(e.End()),
+	}, true
+}
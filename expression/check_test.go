@@ -0,0 +1,123 @@
+package expression_test
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestReferences(t *testing.T) {
+	t.Run("cells and names", func(t *testing.T) {
+		const source = "SUM(A1, B22 * iota, A1) + true"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		refs := expression.References(node)
+		require.Len(t, refs, 4)
+
+		assert.Equal(t, expression.Reference{Kind: expression.CellReference, Name: "A1", Column: 0, Row: 1, EndColumn: 0, EndRow: 1, Start: 4, End: 6}, refs[0])
+		assert.Equal(t, expression.CellReference, refs[1].Kind)
+		assert.Equal(t, "B22", source[refs[1].Start:refs[1].End])
+		assert.Equal(t, [2]int{1, 22}, [2]int{refs[1].Column, refs[1].Row})
+		assert.Equal(t, expression.Reference{Kind: expression.NameReference, Name: "iota", Start: 14, End: 18}, refs[2])
+		assert.Equal(t, 20, refs[3].Start)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		node := &ast.BinaryExpr{
+			X:  &ast.Ident{Name: "C5"},
+			Op: token.COLON,
+			Y:  &ast.Ident{Name: "A2"},
+		}
+
+		refs := expression.References(node)
+		require.Len(t, refs, 1)
+		ref := refs[0]
+		assert.Equal(t, expression.RangeReference, ref.Kind)
+		assert.Equal(t, "C5:A2", ref.Name)
+		assert.Equal(t, [4]int{0, 2, 2, 5}, [4]int{ref.Column, ref.Row, ref.EndColumn, ref.EndRow})
+		assert.True(t, ref.Contains(1, 3))
+		assert.False(t, ref.Contains(3, 3))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Empty(t, expression.References(nil))
+	})
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		node, err := expression.New("IF(A0, sum(1, 2), -MAX(B1, 3))")
+		require.NoError(t, err)
+		assert.Empty(t, expression.Check(node, nil))
+	})
+
+	t.Run("every problem is reported", func(t *testing.T) {
+		const source = "LET(1, 2, 3) + ABS(1, 2) + x.y + SUM()"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		diagnostics := expression.Check(node, nil)
+		require.Len(t, diagnostics, 4)
+
+		assert.EqualError(t, diagnostics[0], "expected a name")
+		assert.Equal(t, "1", source[diagnostics[0].Start:diagnostics[0].End])
+
+		assert.EqualError(t, diagnostics[1], "ABS expects 1 argument, got 2")
+		assert.Equal(t, "ABS(1, 2)", source[diagnostics[1].Start:diagnostics[1].End])
+
+		assert.EqualError(t, diagnostics[2], "unsupported expression type: *ast.SelectorExpr")
+		var unsupported *expression.UnsupportedError
+		assert.True(t, errors.As(diagnostics[2], &unsupported))
+		assert.Equal(t, "x.y", source[diagnostics[2].Start:diagnostics[2].End])
+
+		assert.EqualError(t, diagnostics[3], "SUM expects at least 1 argument, got 0")
+	})
+
+	t.Run("unknown functions", func(t *testing.T) {
+		const source = "MODD(1, 2) + SUMM(A0)"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		diagnostics := expression.Check(node, nil)
+		require.Len(t, diagnostics, 2)
+		assert.EqualError(t, diagnostics[0], "unknown function MODD")
+		assert.Equal(t, "MODD", source[diagnostics[0].Start:diagnostics[0].End])
+		assert.EqualError(t, diagnostics[1], "unknown function SUMM")
+		assert.Equal(t, "SUMM", source[diagnostics[1].Start:diagnostics[1].End])
+
+		diagnostics = expression.Check(node, func(name string) bool { return name == "SUMM" })
+		require.Len(t, diagnostics, 1)
+		assert.EqualError(t, diagnostics[0], "unknown function MODD")
+	})
+
+	t.Run("bound functions", func(t *testing.T) {
+		node, err := expression.New("LET(f, LAMBDA(x, x * 2), f(1)) + LAMBDA(g, g(1))(ABS) + func(h int) int { return h(2) }(ABS)")
+		require.NoError(t, err)
+		assert.Empty(t, expression.Check(node, nil))
+
+		node, err = expression.New("LET(f, 1, 2) + f(1)")
+		require.NoError(t, err)
+		diagnostics := expression.Check(node, nil)
+		require.Len(t, diagnostics, 1)
+		assert.EqualError(t, diagnostics[0], "unknown function f")
+	})
+
+	t.Run("compile reports the same diagnostic", func(t *testing.T) {
+		node, err := expression.New("1 + IF(true)")
+		require.NoError(t, err)
+
+		_, err = expression.Compile(node)
+		var d *expression.Diagnostic
+		require.True(t, errors.As(err, &d))
+		assert.Equal(t, 4, d.Start)
+		assert.Equal(t, 12, d.End)
+		assert.EqualError(t, err, "IF expects at least 2 arguments, got 1")
+	})
+}
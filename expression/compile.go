@@ -0,0 +1,343 @@
+package expression
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strconv"
+)
+
+// Lookup is the value source for a compiled Program. Identifiers that are cell
+// names, such as B7, are parsed when compiling and resolved by position with
+// ResolveCell; every other identifier is passed to Resolve. ResolveCell may
+// return Blank for empty cells.
+type Lookup interface {
+	Scope
+	ResolveCell(column, row int) (Value, error)
+}
+
+// Program is a compiled expression. It may be evaluated any number of times
+// and from multiple goroutines.
+type Program struct {
+	eval evalFunc
+}
+
+type evalFunc func(*evaluation) (Value, error)
+
+// evaluation is the state shared by the nodes of a program during one call
+// to Evaluate. The optional interfaces of scope are only asserted by the
+// functions that use them.
+type evaluation struct {
+	Lookup
+	scope    Scope
+	numeric  Numeric
+	bindings *binding
+	depth    int // of LAMBDA calls
+}
+
+func Compile(expr ast.Expr) (Program, error) {
+	eval, err := compile(expr)
+	if err != nil {
+		return Program{}, err
+	}
+	return Program{eval: eval}, nil
+}
+
+// Evaluate runs the program. When scope does not implement Lookup, cell
+// references are passed to Resolve by name. When it implements NumericScope
+// the results of operations use its number model and when it implements
+// ClockScope NOW and TODAY use its clock. TEXT uses the formats of a
+// FormatScope, ROW, COLUMN and REL the position of a PositionScope, FX the
+// rates of an ExchangeRateScope and calls to functions that are not built in
+// use the functions of a FunctionScope. The result is rounded to the number
+// model.
+func (p Program) Evaluate(scope Scope) (Value, error) {
+	ev := &evaluation{scope: scope}
+	if lookup, ok := scope.(Lookup); ok {
+		ev.Lookup = lookup
+	} else {
+		ev.Lookup = scopeLookup{Scope: scope}
+	}
+	if numeric, ok := scope.(NumericScope); ok {
+		ev.numeric = numeric.Numeric()
+	}
+	v, err := p.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+	return ev.numeric.convert(v)
+}
+
+func compile(expr ast.Expr) (evalFunc, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return numberFunc(constant.MakeFromLiteral(e.Value, e.Kind, 0)), nil
+	case *ast.UnaryExpr:
+		x, err := compile(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := e.X.(*ast.BasicLit); ok {
+			v, err := unaryOp(e.Op, constant.MakeFromLiteral(lit.Value, lit.Kind, 0))
+			if err != nil {
+				return nil, newDiagnostic(e, err)
+			}
+			return numberFunc(v), nil
+		}
+		return func(ev *evaluation) (Value, error) {
+			v, err := x(ev)
+			if err != nil {
+				return nil, err
+			}
+			v, err = unaryOp(e.Op, v)
+			if err != nil {
+				return nil, newDiagnostic(e, err)
+			}
+			return v, nil
+		}, nil
+	case *ast.BinaryExpr:
+		if ref, ok := rangeReference(e); ok {
+			r := referenceRange(ref)
+			return func(ev *evaluation) (Value, error) {
+				a, err := ev.array(r)
+				if err != nil {
+					return nil, newDiagnostic(e, err)
+				}
+				return a, nil
+			}, nil
+		}
+		x, err := compile(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compile(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		return compileBinary(e, x, y), nil
+	case *ast.ParenExpr:
+		return compile(e.X)
+	case *ast.CallExpr:
+		call, err := compileCall(e)
+		if err != nil {
+			return nil, err
+		}
+		return dereference(e, call), nil
+	case *ast.FuncLit:
+		return compileFuncLit(e)
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return constantFunc(constant.MakeBool(true)), nil
+		case "false":
+			return constantFunc(constant.MakeBool(false)), nil
+		}
+		// Errors from referenced cells carry spans in the other cell's
+		// source so they are always replaced with the span of the reference.
+		if column, row, ok := parseCellName(e.Name); ok {
+			return func(ev *evaluation) (Value, error) {
+				v, err := ev.ResolveCell(column, row)
+				if err != nil {
+					return nil, newDiagnostic(e, err)
+				}
+				return zeroIfBlank(v), nil
+			}, nil
+		}
+		// Names of units are quantities of one unless bound by LET.
+		name := e.Name
+		unit, isUnit := namedUnit(name)
+		return func(ev *evaluation) (Value, error) {
+			if v, ok := ev.bindings.lookup(name); ok {
+				return v, nil
+			}
+			if isUnit {
+				return Quantity{number: constant.MakeInt64(1), unit: unit}, nil
+			}
+			v, err := ev.Resolve(name)
+			if err != nil {
+				return nil, newDiagnostic(e, err)
+			}
+			return v, nil
+		}, nil
+	default:
+		return nil, newDiagnostic(expr, &UnsupportedError{Expr: expr})
+	}
+}
+
+func compileBinary(e *ast.BinaryExpr, x, y evalFunc) evalFunc {
+	op := e.Op
+	binary := func(ev *evaluation, leftValue, rightValue Value) (Value, error) {
+		if a, ok := int64Of(leftValue); ok {
+			if b, ok := int64Of(rightValue); ok {
+				if v, ok := intOp(a, op, b); ok {
+					return v, nil
+				}
+			}
+		}
+		v, err := binaryOp(leftValue, op, rightValue)
+		if err == nil {
+			v, err = ev.numeric.normalize(v)
+		}
+		if err != nil {
+			return nil, newDiagnostic(e, err)
+		}
+		return v, nil
+	}
+	// Integer literals, such as the 7 in A0 % 7, are converted once.
+	if b, ok := int64Literal(e.Y); ok {
+		rightValue := constant.MakeInt64(b)
+		return func(ev *evaluation) (Value, error) {
+			leftValue, err := x(ev)
+			if err != nil {
+				return nil, err
+			}
+			if a, ok := int64Of(leftValue); ok {
+				if v, ok := intOp(a, op, b); ok {
+					return v, nil
+				}
+			}
+			return binary(ev, leftValue, rightValue)
+		}
+	}
+	if a, ok := int64Literal(e.X); ok {
+		leftValue := constant.MakeInt64(a)
+		return func(ev *evaluation) (Value, error) {
+			rightValue, err := y(ev)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := int64Of(rightValue); ok {
+				if v, ok := intOp(a, op, b); ok {
+					return v, nil
+				}
+			}
+			return binary(ev, leftValue, rightValue)
+		}
+	}
+	return func(ev *evaluation) (Value, error) {
+		leftValue, err := x(ev)
+		if err != nil {
+			return nil, err
+		}
+		if (op == token.LAND || op == token.LOR) && isBool(leftValue) {
+			left := constant.BoolVal(leftValue.(constant.Value))
+			switch op {
+			case token.LAND:
+				if !left {
+					return constant.MakeBool(false), nil
+				}
+			case token.LOR:
+				if left {
+					return constant.MakeBool(true), nil
+				}
+			}
+		}
+		rightValue, err := y(ev)
+		if err != nil {
+			return nil, err
+		}
+		return binary(ev, leftValue, rightValue)
+	}
+}
+
+// numberFunc returns a literal converted to the number model of the
+// evaluation.
+func numberFunc(v Value) evalFunc {
+	if c, ok := v.(constant.Value); !ok || c.Kind() != constant.Float {
+		return constantFunc(v)
+	}
+	return func(ev *evaluation) (Value, error) {
+		return ev.numeric.normalize(v)
+	}
+}
+
+func constantFunc(v Value) evalFunc {
+	return func(*evaluation) (Value, error) {
+		return v, nil
+	}
+}
+
+// compileRange evaluates the cells of a range in row-major order.
+func compileRange(ref Reference) func(*evaluation) ([]Value, error) {
+	r := referenceRange(ref)
+	return func(ev *evaluation) ([]Value, error) {
+		values, err := ev.resolveRange(r)
+		if err != nil {
+			return nil, &Diagnostic{Start: ref.Start, End: ref.End, Err: err}
+		}
+		return values, nil
+	}
+}
+
+// compileArgument compiles a function argument. Unlike compile, the ranges
+// returned by calls are passed on to the function.
+func compileArgument(expr ast.Expr) (evalFunc, error) {
+	if e, ok := expr.(*ast.CallExpr); ok {
+		return compileCall(e)
+	}
+	return compile(expr)
+}
+
+// dereference replaces a range returned by a call with the value of the cell
+// when it has one cell and with an array otherwise.
+func dereference(e ast.Expr, call evalFunc) evalFunc {
+	return func(ev *evaluation) (Value, error) {
+		v, err := call(ev)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := v.(cellRange)
+		if !ok {
+			return v, nil
+		}
+		if r.columns() > 1 || r.rows() > 1 {
+			a, err := ev.array(r)
+			if err != nil {
+				return nil, newDiagnostic(e, err)
+			}
+			return a, nil
+		}
+		v, err = ev.ResolveCell(r.column, r.row)
+		if err != nil {
+			return nil, newDiagnostic(e, err)
+		}
+		return zeroIfBlank(v), nil
+	}
+}
+
+type scopeLookup struct {
+	Scope
+}
+
+func (s scopeLookup) ResolveCell(column, row int) (Value, error) {
+	return s.Resolve(CellName(column, row))
+}
+
+// CellName returns the identifier for the zero-indexed column and row, for
+// example CellName(1, 7) is "B7".
+func CellName(column, row int) string {
+	label := ""
+	for n := column; n >= 0; n = n/26 - 1 {
+		label = string(rune('A'+n%26)) + label
+	}
+	return label + strconv.Itoa(row)
+}
+
+// parseCellName parses names in the form returned by CellName. Row numbers
+// with leading zeros are not cell names since they would not round trip.
+func parseCellName(name string) (column, row int, ok bool) {
+	i := 0
+	for i < len(name) && 'A' <= name[i] && name[i] <= 'Z' {
+		column = column*26 + int(name[i]-'A') + 1
+		i++
+	}
+	digits := name[i:]
+	if i == 0 || digits == "" || (len(digits) > 1 && digits[0] == '0') {
+		return 0, 0, false
+	}
+	row, err := strconv.Atoi(digits)
+	if err != nil || row < 0 {
+		return 0, 0, false
+	}
+	return column - 1, row, true
+}
@@ -0,0 +1,218 @@
+package expression_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestCompile(t *testing.T) {
+	t.Run("cell references use ResolveCell", func(t *testing.T) {
+		node, err := expression.New("B7 * 2 + A01 + iota")
+		require.NoError(t, err)
+		program, err := expression.Compile(node)
+		require.NoError(t, err)
+
+		var cells, names []string
+		lookup := fakeLookup{
+			resolve: func(s string) (constant.Value, error) {
+				names = append(names, s)
+				return constant.MakeInt64(1), nil
+			},
+			resolveCell: func(column, row int) (expression.Value, error) {
+				cells = append(cells, fmt.Sprintf("%d,%d", column, row))
+				return constant.MakeInt64(10), nil
+			},
+		}
+
+		v, err := program.Evaluate(lookup)
+		require.NoError(t, err)
+		assert.Equal(t, "22", v.String())
+		assert.Equal(t, []string{"1,7"}, cells)
+		assert.Equal(t, []string{"A01", "iota"}, names)
+	})
+
+	t.Run("scope without ResolveCell gets cell names", func(t *testing.T) {
+		node, err := expression.New("AB12 + 1")
+		require.NoError(t, err)
+		program, err := expression.Compile(node)
+		require.NoError(t, err)
+
+		var names []string
+		v, err := program.Evaluate(fakeScopeFunc(func(s string) (constant.Value, error) {
+			names = append(names, s)
+			return constant.MakeInt64(1), nil
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, "2", v.String())
+		assert.Equal(t, []string{"AB12"}, names)
+	})
+
+	t.Run("programs can be evaluated repeatedly", func(t *testing.T) {
+		node, err := expression.New("-2 * x")
+		require.NoError(t, err)
+		program, err := expression.Compile(node)
+		require.NoError(t, err)
+
+		for i := range int64(3) {
+			v, err := program.Evaluate(fakeScopeFunc(func(string) (constant.Value, error) {
+				return constant.MakeInt64(i), nil
+			}))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprint(-2*i), v.String())
+		}
+	})
+
+	t.Run("unsupported node", func(t *testing.T) {
+		node, err := expression.New("x.y")
+		require.NoError(t, err)
+		_, err = expression.Compile(node)
+		assert.ErrorContains(t, err, "unsupported expression type: *ast.SelectorExpr")
+	})
+}
+
+func TestCellName(t *testing.T) {
+	for _, tt := range []struct {
+		Column, Row int
+		Name        string
+	}{
+		{Column: 0, Row: 0, Name: "A0"},
+		{Column: 1, Row: 7, Name: "B7"},
+		{Column: 25, Row: 10, Name: "Z10"},
+		{Column: 26, Row: 3, Name: "AA3"},
+		{Column: 701, Row: 99, Name: "ZZ99"},
+		{Column: 702, Row: 1, Name: "AAA1"},
+	} {
+		assert.Equal(t, tt.Name, expression.CellName(tt.Column, tt.Row))
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	var sb strings.Builder
+	for i := range 50 {
+		if i > 0 {
+			sb.WriteString(" + ")
+		}
+		fmt.Fprintf(&sb, "(A%d * %d - 3) %% 7", i, i+1)
+	}
+	node, err := expression.New(sb.String())
+	require.NoError(b, err)
+
+	lookup := fakeLookup{
+		// Both evaluators see the same values: walk resolves cells by name.
+		resolve: func(s string) (constant.Value, error) {
+			row, err := strconv.Atoi(s[1:])
+			return constant.MakeInt64(int64(row)), err
+		},
+		resolveCell: func(column, row int) (expression.Value, error) {
+			return constant.MakeInt64(int64(row)), nil
+		},
+	}
+
+	b.Run("ast", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := walk(lookup, node); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("program", func(b *testing.B) {
+		program, err := expression.Compile(node)
+		require.NoError(b, err)
+		for b.Loop() {
+			if _, err := program.Evaluate(lookup); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// walk is the tree walking evaluator Compile replaced. It is kept so the
+// benchmark compares programs with it rather than with Evaluate, which now
+// compiles the expression first.
+func walk(scope expression.Scope, expr ast.Expr) (constant.Value, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0), nil
+	case *ast.UnaryExpr:
+		v, err := walk(scope, e.X)
+		if err != nil {
+			return nil, err
+		}
+		return constant.UnaryOp(e.Op, v, 0), nil
+	case *ast.BinaryExpr:
+		leftValue, err := walk(scope, e.X)
+		if err != nil {
+			return nil, err
+		}
+		if leftValue.Kind() == constant.Bool {
+			left := constant.BoolVal(leftValue)
+			switch e.Op {
+			case token.LAND:
+				if !left {
+					return constant.MakeBool(false), nil
+				}
+			case token.LOR:
+				if left {
+					return constant.MakeBool(true), nil
+				}
+			}
+		}
+		rightValue, err := walk(scope, e.Y)
+		if err != nil {
+			return nil, err
+		}
+		return constant.BinaryOp(leftValue, e.Op, rightValue), nil
+	case *ast.ParenExpr:
+		return walk(scope, e.X)
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return constant.MakeBool(true), nil
+		case "false":
+			return constant.MakeBool(false), nil
+		default:
+			return scope.Resolve(e.Name)
+		}
+	default:
+		return nil, &expression.UnsupportedError{Expr: expr}
+	}
+}
+
+type fakeLookup struct {
+	resolve     func(string) (constant.Value, error)
+	resolveCell func(column, row int) (expression.Value, error)
+}
+
+func (f fakeLookup) Resolve(s string) (constant.Value, error) {
+	return f.resolve(s)
+}
+
+func (f fakeLookup) ResolveCell(column, row int) (expression.Value, error) {
+	return f.resolveCell(column, row)
+}
+
+// cellLookup returns a fakeLookup for the values of cells keyed by name such
+// as "A0". Other cells are blank and names can not be resolved.
+func cellLookup(cells map[string]expression.Value) fakeLookup {
+	return fakeLookup{
+		resolve: func(s string) (constant.Value, error) {
+			return nil, fmt.Errorf("unexpected name %s", s)
+		},
+		resolveCell: func(column, row int) (expression.Value, error) {
+			if v, ok := cells[expression.CellName(column, row)]; ok {
+				return v, nil
+			}
+			return expression.Blank{}, nil
+		},
+	}
+}
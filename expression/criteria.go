@@ -0,0 +1,281 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// maxCriteria is the number of range and criterion pairs SUMIFS and COUNTIFS
+// accept.
+const maxCriteria = 127
+
+// criterion selects cells for the conditional aggregation functions. Text
+// criteria may start with a comparison operator, =, <>, <, <=, > or >=, and
+// without an operator or with = and <> may use the wildcards * and ?. A ~
+// escapes a wildcard. Other values select the cells equal to them.
+type criterion struct {
+	op      token.Token
+	value   Value
+	pattern *regexp.Regexp
+}
+
+var criterionOperators = []struct {
+	prefix string
+	op     token.Token
+}{
+	// Two character operators come first so "<=" is not read as "<".
+	{"<=", token.LEQ}, {">=", token.GEQ}, {"<>", token.NEQ},
+	{"<", token.LSS}, {">", token.GTR}, {"=", token.EQL},
+}
+
+func parseCriterion(v Value) (criterion, error) {
+	if !isText(v) {
+		return criterion{op: token.EQL, value: v}, nil
+	}
+	s := constant.StringVal(v.(constant.Value))
+	c := criterion{op: token.EQL}
+	for _, o := range criterionOperators {
+		if rest, ok := strings.CutPrefix(s, o.prefix); ok {
+			c.op, s = o.op, rest
+			break
+		}
+	}
+	switch upper := strings.ToUpper(strings.TrimSpace(s)); {
+	case s == "":
+		if c.op != token.EQL && c.op != token.NEQ {
+			return criterion{}, fmt.Errorf("criterion %q has nothing to compare with", constant.StringVal(v.(constant.Value)))
+		}
+		c.value = Blank{}
+	case upper == "TRUE" || upper == "FALSE":
+		c.value = constant.MakeBool(upper == "TRUE")
+	default:
+		if n, ok := parseNumber(s); ok {
+			c.value = n
+		} else if t, err := dateValue([]Value{constant.MakeString(strings.TrimSpace(s))}); err == nil {
+			c.value = t
+		} else {
+			c.value = constant.MakeString(s)
+			if (c.op == token.EQL || c.op == token.NEQ) && strings.ContainsAny(s, "*?") {
+				pattern, err := compilePattern(wildcardPattern(s))
+				if err != nil {
+					return criterion{}, err
+				}
+				c.pattern = pattern
+			}
+		}
+	}
+	return c, nil
+}
+
+// wildcardPattern translates a wildcard pattern into a regular expression
+// that matches the whole text without regard to case.
+func wildcardPattern(s string) string {
+	var b strings.Builder
+	b.WriteString(`(?is)^`)
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '~':
+			escaped = true
+		case r == '*':
+			b.WriteString(`.*`)
+		case r == '?':
+			b.WriteString(`.`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		b.WriteString(`~`)
+	}
+	b.WriteString(`$`)
+	return b.String()
+}
+
+// matches reports whether a cell value meets the criterion. Blank cells
+// only match "=" and "<>" followed by something, and values that cannot be
+// compared with the criterion only match "<>".
+func (c criterion) matches(v Value) bool {
+	switch {
+	case isBlank(c.value):
+		return isBlank(v) == (c.op == token.EQL)
+	case isBlank(v):
+		return c.op == token.NEQ
+	case c.pattern != nil:
+		return isText(v) && c.pattern.MatchString(text(v)) == (c.op == token.EQL)
+	}
+	order, ok := compareValues(v, c.value)
+	if !ok {
+		return c.op == token.NEQ
+	}
+	switch c.op {
+	case token.EQL:
+		return order == 0
+	case token.NEQ:
+		return order != 0
+	case token.LSS:
+		return order < 0
+	case token.LEQ:
+		return order <= 0
+	case token.GTR:
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// criteriaRanges returns the positions of the ranges in the arguments of
+// SUMIFS and COUNTIFS. The arguments before first are ranges and the ones
+// from first alternate between ranges and criteria.
+func criteriaRanges(first int) []int {
+	positions := make([]int, 0, first+maxCriteria)
+	for i := range first {
+		positions = append(positions, i)
+	}
+	for i := range maxCriteria {
+		positions = append(positions, first+2*i)
+	}
+	return positions
+}
+
+// selectCells returns the positions, in row-major order, of the cells that
+// meet every criterion. The arguments alternate between ranges and
+// criteria, and the ranges must all have the size of size.
+func (ev *evaluation) selectCells(size area, args []Value, offset int) ([]int, error) {
+	if len(args)%2 != 0 {
+		return nil, errors.New("every range needs a criterion")
+	}
+	if size.array == nil {
+		if err := ev.checkRange(size.r); err != nil {
+			return nil, err
+		}
+	}
+	selected := make([]bool, size.columns()*size.rows())
+	for i := range selected {
+		selected[i] = true
+	}
+	for i := 0; i < len(args); i += 2 {
+		r, ok := toArea(args[i])
+		if !ok {
+			return nil, fmt.Errorf("argument %d is %s, not a range or an array", offset+i+1, exactString(args[i]))
+		}
+		if r.columns() != size.columns() || r.rows() != size.rows() {
+			return nil, fmt.Errorf("the ranges %s and %s have different sizes", size, r)
+		}
+		c, err := parseCriterion(args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		values, err := ev.values(r)
+		if err != nil {
+			return nil, err
+		}
+		for j, v := range values {
+			selected[j] = selected[j] && c.matches(v)
+		}
+	}
+	var positions []int
+	for i, ok := range selected {
+		if ok {
+			positions = append(positions, i)
+		}
+	}
+	return positions, nil
+}
+
+// selectedNumbers returns the numbers at the selected positions of a range.
+// Blank cells and cells that are not numbers are skipped.
+func (ev *evaluation) selectedNumbers(a area, positions []int) ([]constant.Value, error) {
+	values, err := ev.values(a)
+	if err != nil {
+		return nil, err
+	}
+	var nums []constant.Value
+	for _, i := range positions {
+		if isNumber(values[i]) {
+			nums = append(nums, values[i].(constant.Value))
+		}
+	}
+	return nums, nil
+}
+
+// conditionalArgs returns the numbers SUMIF and AVERAGEIF aggregate. They
+// come from the optional third range, or the first, at the positions where
+// the first range meets the criterion.
+func (ev *evaluation) conditionalArgs(args []Value) ([]constant.Value, error) {
+	r, err := areaArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	values := r
+	if len(args) > 2 {
+		if values, err = areaArg(args, 2); err != nil {
+			return nil, err
+		}
+	}
+	positions, err := ev.selectCells(values, args[:2], 0)
+	if err != nil {
+		return nil, err
+	}
+	return ev.selectedNumbers(values, positions)
+}
+
+// sumIf adds the numbers in the cells selected by a criterion.
+func sumIf(ev *evaluation, args []Value) (Value, error) {
+	nums, err := ev.conditionalArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return sumOf(nums), nil
+}
+
+// averageIf averages the numbers in the cells selected by a criterion.
+func averageIf(ev *evaluation, args []Value) (Value, error) {
+	nums, err := ev.conditionalArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return meanOf(nums), nil
+}
+
+// sumIfs adds the numbers in the first range at the positions where every
+// following range meets its criterion.
+func sumIfs(ev *evaluation, args []Value) (Value, error) {
+	r, err := areaArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := ev.selectCells(r, args[1:], 1)
+	if err != nil {
+		return nil, err
+	}
+	nums, err := ev.selectedNumbers(r, positions)
+	if err != nil {
+		return nil, err
+	}
+	return sumOf(nums), nil
+}
+
+// countIfs counts the positions where every range meets its criterion. It
+// also implements COUNTIF.
+func countIfs(ev *evaluation, args []Value) (Value, error) {
+	r, err := areaArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := ev.selectCells(r, args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(len(positions))), nil
+}
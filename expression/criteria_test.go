@@ -0,0 +1,94 @@
+package expression_test
+
+import (
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// tickets is a table of support tickets:
+//
+//	   A         B        C
+//	0  "Open"    "web"    120
+//	1  "Closed"  "mobile" 80
+//	2  "open"    "web"    30
+//	3  "Pending" "api"    250
+//	4            "web"
+//	5  "Closed"  "web*"   100
+func tickets() fakeLookup {
+	return cellLookup(map[string]expression.Value{
+		"A0": constant.MakeString("Open"), "B0": constant.MakeString("web"), "C0": constant.MakeInt64(120),
+		"A1": constant.MakeString("Closed"), "B1": constant.MakeString("mobile"), "C1": constant.MakeInt64(80),
+		"A2": constant.MakeString("open"), "B2": constant.MakeString("web"), "C2": constant.MakeInt64(30),
+		"A3": constant.MakeString("Pending"), "B3": constant.MakeString("api"), "C3": constant.MakeInt64(250),
+		"B4": constant.MakeString("web"),
+		"A5": constant.MakeString("Closed"), "B5": constant.MakeString("web*"), "C5": constant.MakeInt64(100),
+		"D0": expression.MakeDate(2026, 1, 15), "D1": expression.MakeDate(2026, 3, 1),
+	})
+}
+
+func TestConditionalFunctions(t *testing.T) {
+	scope := tickets()
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "sumif equal", Expression: `=SUMIF(A0:A5, "Open", C0:C5)`, Result: "150"},
+		{Name: "sumif operator", Expression: `=SUMIF(A0:A5, "=closed", C0:C5)`, Result: "180"},
+		{Name: "sumif on itself", Expression: `=SUMIF(C0:C5, ">100")`, Result: "370"},
+		{Name: "sumif at least", Expression: `=SUMIF(C0:C5, ">=100")`, Result: "470"},
+		{Name: "sumif number", Expression: `=SUMIF(C0:C5, 80)`, Result: "80"},
+		{Name: "sumif built criterion", Expression: `=SUMIF(C0:C5, "<"&C2*4)`, Result: "210"},
+		{Name: "sumif wildcard", Expression: `=SUMIF(A0:A5, "*en*", C0:C5)`, Result: "400"},
+		{Name: "sumif single character", Expression: `=SUMIF(B0:B5, "we?", C0:C5)`, Result: "150"},
+		{Name: "sumif escaped wildcard", Expression: `=SUMIF(B0:B5, "web~*", C0:C5)`, Result: "100"},
+		{Name: "sumif not equal", Expression: `=SUMIF(A0:A5, "<>closed", C0:C5)`, Result: "400"},
+		{Name: "countif", Expression: `=COUNTIF(B0:B5, "web")`, Result: "3"},
+		{Name: "countif blank", Expression: `=COUNTIF(A0:A5, "")`, Result: "1"},
+		{Name: "countif not blank", Expression: `=COUNTIF(A0:A5, "<>")`, Result: "5"},
+		{Name: "countif text is not a number", Expression: `=COUNTIF(A0:C5, ">50")`, Result: "4"},
+		{Name: "countif dates", Expression: `=COUNTIF(D0:D1, ">2026-02-01")`, Result: "1"},
+		{Name: "countif date value", Expression: `=COUNTIF(D0:D1, DATE(2026, 1, 15))`, Result: "1"},
+		{Name: "averageif", Expression: `=AVERAGEIF(B0:B5, "web", C0:C5)`, Result: "75"},
+		{Name: "sumifs", Expression: `=SUMIFS(C0:C5, A0:A5, "open", B0:B5, "web")`, Result: "150"},
+		{Name: "sumifs range", Expression: `=SUMIFS(C0:C5, C0:C5, ">=50", C0:C5, "<=120")`, Result: "300"},
+		{Name: "countifs", Expression: `=COUNTIFS(A0:A5, "closed", C0:C5, ">90")`, Result: "1"},
+		{Name: "countifs one pair", Expression: `=COUNTIFS(B0:B5, "web*")`, Result: "4"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestConditionalFunctions_errors(t *testing.T) {
+	scope := tickets()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: `=SUMIF(A0:A5, "open", C0:C3)`, Error: "SUMIF: the ranges C0:C3 and A0:A5 have different sizes"},
+		{Expression: `=SUMIF(A0:A5, ">")`, Error: `SUMIF: criterion ">" has nothing to compare with`},
+		{Expression: `=AVERAGEIF(A0:A5, "none", C0:C5)`, Error: "AVERAGEIF: division by zero"},
+		{Expression: `=SUMIFS(C0:C5, A0:A5)`, Error: "SUMIFS expects at least 3 arguments, got 2"},
+		{Expression: `=SUMIFS(C0:C5, A0:A5, "open", B0:B5)`, Error: "SUMIFS: every range needs a criterion"},
+		{Expression: `=COUNTIFS(A0:A5, "open", "web", B0:B5)`, Error: "expected a cell, a range or an array"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+}
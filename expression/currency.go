@@ -0,0 +1,103 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// ExchangeRateScope is implemented by scopes with exchange rates for FX.
+// ExchangeRate returns the value of one unit of a currency in a currency
+// shared by every rate, so only the ratio of two rates matters.
+type ExchangeRateScope interface {
+	ExchangeRate(currency string) (constant.Value, error)
+}
+
+// currency returns the index of the only currency in a unit or -1 when the
+// unit has no currency or more than one.
+func (u Unit) currency() int {
+	index := -1
+	for i, t := range u.terms {
+		if !slices.Contains(currencies, t.symbol) {
+			continue
+		}
+		if index >= 0 {
+			return -1
+		}
+		index = i
+	}
+	return index
+}
+
+// isMoney reports whether v is a quantity with one currency in its unit.
+func isMoney(v Value) bool {
+	q, ok := v.(Quantity)
+	return ok && q.unit.currency() >= 0
+}
+
+// fx converts an amount of money to another currency with the exchange
+// rates of the scope: FX(amount, currency). The currency may be text or the
+// name of a currency and may be part of a unit, as in FX(40 USD/h, "EUR").
+func fx(ev *evaluation, args []Value) (Value, error) {
+	to, err := currencyArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := args[0].(Array); ok {
+		return arrayOp(args[0], func(amount, _ Value) (Value, error) {
+			return ev.exchange(amount, to)
+		}, nil)
+	}
+	return ev.exchange(args[0], to)
+}
+
+func (ev *evaluation) exchange(amount Value, to string) (Value, error) {
+	q, ok := amount.(Quantity)
+	i := q.unit.currency()
+	if !ok || i < 0 {
+		return nil, fmt.Errorf("%s is not an amount of money", describe(amount))
+	}
+	from := q.unit.terms[i]
+	if from.symbol == to {
+		return q, nil
+	}
+	rates, ok := ev.scope.(ExchangeRateScope)
+	if !ok {
+		return nil, errors.New("there are no exchange rates")
+	}
+	fromRate, err := rates.ExchangeRate(from.symbol)
+	if err != nil {
+		return nil, err
+	}
+	toRate, err := rates.ExchangeRate(to)
+	if err != nil {
+		return nil, err
+	}
+	ratio := constant.BinaryOp(fromRate, token.QUO, toRate)
+	unit := Unit{terms: slices.Clone(q.unit.terms)}
+	unit.terms[i].symbol = to
+	return Quantity{number: constant.BinaryOp(q.number, token.MUL, powerOf(ratio, from.power)), unit: unit}, nil
+}
+
+// currencyArg returns a currency code given as text or as the name of a
+// currency.
+func currencyArg(args []Value, i int) (string, error) {
+	switch v := args[i].(type) {
+	case Quantity:
+		if j := v.unit.currency(); j >= 0 && len(v.unit.terms) == 1 && v.unit.terms[j].power == 1 {
+			return v.unit.terms[j].symbol, nil
+		}
+	case constant.Value:
+		if v.Kind() == constant.String {
+			code := strings.ToUpper(strings.TrimSpace(constant.StringVal(v)))
+			if !slices.Contains(currencies, code) {
+				return "", fmt.Errorf("unknown currency %s", code)
+			}
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("argument %d is %s, not a currency", i+1, exactString(args[i]))
+}
@@ -0,0 +1,101 @@
+package expression_test
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// exchangeRates is the fruit table with the value of each currency in US
+// dollars.
+type exchangeRates struct {
+	fakeLookup
+	rates map[string]string
+}
+
+func (s exchangeRates) ExchangeRate(currency string) (constant.Value, error) {
+	rate, ok := s.rates[currency]
+	if !ok {
+		return nil, fmt.Errorf("there is no exchange rate for %s", currency)
+	}
+	return constant.MakeFromLiteral(rate, token.FLOAT, 0), nil
+}
+
+func TestFX(t *testing.T) {
+	scope := exchangeRates{
+		fakeLookup: fruit(),
+		rates:      map[string]string{"USD": "1", "EUR": "1.25", "GBP": "1.6"},
+	}
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "convert", Expression: `=FX(100 EUR, "USD")`, Result: "125 USD"},
+		{Name: "cross rate", Expression: `=FX(100 GBP, "EUR")`, Result: "128 EUR"},
+		{Name: "currency name", Expression: "=FX(10 USD, EUR)", Result: "8 EUR"},
+		{Name: "lower case", Expression: `=FX(10 USD, "eur")`, Result: "8 EUR"},
+		{Name: "same currency", Expression: `=FX(3 JPY, "JPY")`, Result: "3 JPY"},
+		{Name: "compound unit", Expression: `=FX(40 USD/h, "EUR")`, Result: "32 EUR/h"},
+		{Name: "per currency", Expression: `=FX(2 kg/EUR, "USD")`, Result: "1.6 kg/USD"},
+		{Name: "array", Expression: `=FX(B0:B1 * 1 EUR, "USD")`, Result: "{3.75 USD; 8.75 USD}"},
+		{Name: "add after converting", Expression: `=3 USD + FX(2 EUR, "USD")`, Result: "5.5 USD"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+
+	refs := expression.References(mustParse(t, `=FX(A0, "EUR")`))
+	require.NotEmpty(t, refs)
+	assert.Equal(t, expression.DynamicReference, refs[0].Kind)
+}
+
+func TestFX_errors(t *testing.T) {
+	scope := exchangeRates{
+		fakeLookup: fruit(),
+		rates:      map[string]string{"USD": "1", "EUR": "1.25"},
+	}
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: `=FX(100, "USD")`, Error: "FX: 100 (number) is not an amount of money"},
+		{Expression: `=FX(1 m, "USD")`, Error: "FX: 1 m (quantity) is not an amount of money"},
+		{Expression: `=FX(1 USD, "XYZ")`, Error: "FX: unknown currency XYZ"},
+		{Expression: `=FX(1 USD, 1)`, Error: "FX: argument 2 is 1, not a currency"},
+		{Expression: `=FX(1 USD, "GBP")`, Error: "FX: there is no exchange rate for GBP"},
+		{Expression: `=1 USD + 1 EUR`, Error: "cannot apply + to 1 USD and 1 EUR, which are in different currencies; convert one of them with FX"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			_, err := expression.Evaluate(scope, mustParse(t, tt.Expression))
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+
+	t.Run("without exchange rates", func(t *testing.T) {
+		_, err := expression.Evaluate(fruit(), mustParse(t, `=FX(1 USD, "EUR")`))
+		assert.EqualError(t, err, "FX: there are no exchange rates")
+		var d *expression.Diagnostic
+		assert.True(t, errors.As(err, &d))
+	})
+}
+
+func mustParse(t *testing.T, formula string) ast.Expr {
+	t.Helper()
+	node, err := expression.FormulaDialect.Parse(formula)
+	require.NoError(t, err)
+	return node
+}
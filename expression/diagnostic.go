@@ -0,0 +1,125 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// Diagnostic is an error found at a span of the expression source. Start and
+// End are byte offsets into the string passed to New.
+type Diagnostic struct {
+	Start, End int
+	Err        error
+}
+
+func newDiagnostic(node ast.Node, err error) *Diagnostic {
+	return &Diagnostic{
+		Start: offset(node.Pos()),
+		End:   offset(node.End()),
+		Err:   err,
+	}
+}
+
+func offset(pos token.Pos) int {
+	if !pos.IsValid() {
+		return 0
+	}
+	return int(pos) - 1
+}
+
+func (d *Diagnostic) Error() string { return d.Err.Error() }
+
+func (d *Diagnostic) Unwrap() error { return d.Err }
+
+// at attaches the span of node to an evaluation error. Errors that already
+// are a *Diagnostic come from a nested node with a more precise span.
+func at(node ast.Node, err error) error {
+	if _, ok := err.(*Diagnostic); ok || err == nil {
+		return err
+	}
+	return newDiagnostic(node, err)
+}
+
+// parseError converts the errors returned by go/parser into a Diagnostic
+// with a message that does not assume the user knows Go.
+func parseError(src string, err error) error {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) || len(list) == 0 {
+		return err
+	}
+	first := list[0]
+	d := &Diagnostic{
+		Start: min(first.Pos.Offset, len(src)),
+		End:   min(first.Pos.Offset+1, len(src)),
+	}
+	var found string
+	if i := strings.LastIndex(first.Msg, "found "); i >= 0 {
+		found = strings.TrimSpace(first.Msg[i+len("found "):])
+	}
+	atEnd := first.Pos.Offset >= len(strings.TrimRightFunc(src, isSpace))
+	switch msg := first.Msg; {
+	case strings.HasPrefix(src[d.Start:], ":"):
+		// Go syntax has no ranges, so A0:B1 is only valid in formulas.
+		d.Err = errors.New("ranges such as A0:B1 need the formula dialect")
+	case strings.HasPrefix(msg, "expected ')'"), strings.HasPrefix(msg, "missing ','") && atEnd:
+		d.Err = errors.New("missing closing parenthesis")
+		if open := unmatchedParen(src); open >= 0 {
+			d.Start, d.End = open, open+1
+		}
+	case strings.HasPrefix(msg, "expected operand") && atEnd:
+		d.Err = errors.New("the formula ends before the last operator has a value")
+		d.Start, d.End = len(strings.TrimRightFunc(src, isSpace)), len(src)
+	case strings.HasPrefix(msg, "expected operand"):
+		d.Err = fmt.Errorf("expected a value but found %s", found)
+	case strings.HasPrefix(msg, "expected 'EOF'") && found == "')'":
+		d.Err = errors.New("closing parenthesis without a matching opening parenthesis")
+	case strings.HasPrefix(msg, "expected 'EOF'"):
+		d.Err = fmt.Errorf("expected an operator before %s", found)
+		d.End = d.Start + len(strings.Trim(found, "'"))
+	case strings.HasPrefix(msg, "missing ','"):
+		d.Err = errors.New("missing comma between function arguments")
+	case strings.HasPrefix(msg, "expected '=='"):
+		d.Err = errors.New("use == to compare values")
+	case msg == "string literal not terminated":
+		d.Err = errors.New("missing closing quote")
+		d.End = len(src)
+	case strings.HasPrefix(msg, "illegal character"):
+		d.Err = fmt.Errorf("invalid character %s", msg[strings.LastIndex(msg, " ")+1:])
+	default:
+		d.Err = errors.New(strings.ReplaceAll(msg, "'EOF'", "the end of the formula"))
+	}
+	return d
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// unmatchedParen returns the offset of the last opening parenthesis that is
+// not closed or -1.
+func unmatchedParen(src string) int {
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, []byte(src), nil, 0)
+	var open []int
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			if len(open) == 0 {
+				return -1
+			}
+			return open[len(open)-1]
+		case token.LPAREN:
+			open = append(open, file.Offset(pos))
+		case token.RPAREN:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
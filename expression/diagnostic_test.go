@@ -0,0 +1,91 @@
+package expression_test
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestNew_diagnostics(t *testing.T) {
+	for _, tt := range []struct {
+		Expression string
+		Message    string
+		Span       string
+	}{
+		{Expression: "(1 + (2 * 3)", Message: "missing closing parenthesis", Span: "("},
+		{Expression: "SUM(1, (2)", Message: "missing closing parenthesis", Span: "("},
+		{Expression: "1 + ", Message: "the formula ends before the last operator has a value", Span: " "},
+		{Expression: "1 + )", Message: "expected a value but found ')'", Span: ")"},
+		{Expression: "(1 + 2))", Message: "closing parenthesis without a matching opening parenthesis", Span: ")"},
+		{Expression: "1 23", Message: "expected an operator before 23", Span: "23"},
+		{Expression: "SUM(1 2)", Message: "missing comma between function arguments", Span: "2"},
+		{Expression: "SUM(A0:A2)", Message: "ranges such as A0:B1 need the formula dialect", Span: ":"},
+		{Expression: "A0 : A2 * 2", Message: "ranges such as A0:B1 need the formula dialect", Span: ":"},
+		{Expression: "A1 = 2", Message: "use == to compare values", Span: "="},
+		{Expression: `"abc`, Message: "missing closing quote", Span: `"abc`},
+		{Expression: "1 + $A1", Message: "invalid character '$'", Span: "$"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			_, err := expression.New(tt.Expression)
+			var d *expression.Diagnostic
+			require.True(t, errors.As(err, &d), "expected a diagnostic got %v", err)
+			assert.EqualError(t, err, tt.Message)
+			assert.Equal(t, tt.Span, tt.Expression[d.Start:d.End])
+		})
+	}
+}
+
+func TestEvaluate_diagnostics(t *testing.T) {
+	t.Run("resolve error", func(t *testing.T) {
+		const source = "1 + SUM(2, Z9)"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		_, err = expression.Evaluate(fakeScopeFunc(func(s string) (constant.Value, error) {
+			return nil, fmt.Errorf("unknown cell %s", s)
+		}), node)
+
+		var d *expression.Diagnostic
+		require.True(t, errors.As(err, &d))
+		assert.EqualError(t, err, "unknown cell Z9")
+		assert.Equal(t, "Z9", source[d.Start:d.End])
+	})
+
+	t.Run("function error", func(t *testing.T) {
+		const source = "1 + SUM(2, x)"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		_, err = expression.Evaluate(fakeScopeFunc(func(s string) (constant.Value, error) {
+			return constant.MakeString("x"), nil
+		}), node)
+
+		var d *expression.Diagnostic
+		require.True(t, errors.As(err, &d))
+		assert.Equal(t, "SUM(2, x)", source[d.Start:d.End])
+	})
+
+	t.Run("errors from other formulas are replaced", func(t *testing.T) {
+		const source = "A1 + B2"
+		node, err := expression.New(source)
+		require.NoError(t, err)
+
+		_, err = expression.Evaluate(fakeScopeFunc(func(s string) (constant.Value, error) {
+			if s == "B2" {
+				return nil, &expression.Diagnostic{Start: 0, End: 1, Err: errors.New("banana")}
+			}
+			return constant.MakeInt64(1), nil
+		}), node)
+
+		var d *expression.Diagnostic
+		require.True(t, errors.As(err, &d))
+		assert.Equal(t, "B2", source[d.Start:d.End])
+		assert.EqualError(t, err, "banana")
+	})
+}
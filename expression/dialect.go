@@ -0,0 +1,153 @@
+package expression
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the syntax read by Parse and written by Format.
+type Dialect int
+
+const (
+	// GoDialect is Go expression syntax, for example SUM(A0, B0) * 2. It has
+	// no range syntax, so ranges come from functions such as INDIRECT.
+	GoDialect Dialect = iota
+
+	// FormulaDialect is spreadsheet formula syntax, for example
+	// =SUM(A0:B1)^2 & " total". The leading = is optional.
+	FormulaDialect
+)
+
+var dialectNames = []string{"go", "formula"}
+
+func (d Dialect) String() string { return enumString(dialectNames, int(d), "Dialect") }
+
+func (d Dialect) MarshalText() ([]byte, error) {
+	return enumMarshal(dialectNames, int(d), "dialect")
+}
+
+func (d *Dialect) UnmarshalText(text []byte) error {
+	return enumUnmarshal(dialectNames, (*int)(d), text, "dialect")
+}
+
+// Parse parses in using the syntax of dialect. Empty input returns a nil
+// expression and syntax errors are returned as a *Diagnostic.
+func (d Dialect) Parse(in string) (ast.Expr, error) {
+	switch d {
+	case GoDialect:
+		return New(in)
+	case FormulaDialect:
+		return parseFormula(in)
+	default:
+		return nil, fmt.Errorf("unknown dialect %d", int(d))
+	}
+}
+
+// Format prints expr using the syntax of dialect.
+func (d Dialect) Format(expr ast.Expr) (string, error) {
+	switch d {
+	case GoDialect:
+		return String(expr)
+	case FormulaDialect:
+		if expr == nil {
+			return "", nil
+		}
+		var sb strings.Builder
+		sb.WriteByte('=')
+		if err := formatFormula(&sb, expr); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	default:
+		return "", fmt.Errorf("unknown dialect %d", int(d))
+	}
+}
+
+var formulaOperators = map[token.Token]string{
+	token.EQL: "=",
+	token.NEQ: "<>",
+}
+
+func formatFormula(sb *strings.Builder, expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			sb.WriteString(e.Value)
+			return nil
+		}
+		s, err := strconv.Unquote(e.Value)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(`"` + strings.ReplaceAll(s, `"`, `""`) + `"`)
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			sb.WriteString(strings.ToUpper(e.Name))
+		default:
+			sb.WriteString(e.Name)
+		}
+	case *ast.ParenExpr:
+		sb.WriteByte('(')
+		if err := formatFormula(sb, e.X); err != nil {
+			return err
+		}
+		sb.WriteByte(')')
+	case *ast.UnaryExpr:
+		sb.WriteString(e.Op.String())
+		return formatFormula(sb, e.X)
+	case *ast.BinaryExpr:
+		if err := formatFormula(sb, e.X); err != nil {
+			return err
+		}
+		op, ok := formulaOperators[e.Op]
+		if !ok {
+			op = e.Op.String()
+		}
+		switch {
+		case e.Op == token.COLON:
+			sb.WriteString(op)
+		case !e.OpPos.IsValid() && e.Op == token.MUL:
+			sb.WriteByte(' ')
+		default:
+			sb.WriteString(" " + op + " ")
+		}
+		return formatFormula(sb, e.Y)
+	case *ast.CallExpr:
+		switch fun := e.Fun.(type) {
+		case *ast.Ident:
+			if !e.Lparen.IsValid() && len(e.Args) == 2 {
+				if op, ok := map[string]string{"POWER": "^", "CONCAT": "&"}[fun.Name]; ok {
+					if err := formatFormula(sb, e.Args[0]); err != nil {
+						return err
+					}
+					sb.WriteString(" " + op + " ")
+					return formatFormula(sb, e.Args[1])
+				}
+			}
+			sb.WriteString(fun.Name)
+		case *ast.CallExpr:
+			if err := formatFormula(sb, fun); err != nil {
+				return err
+			}
+		default:
+			return &UnsupportedError{Expr: e}
+		}
+		sb.WriteByte('(')
+		for i, arg := range e.Args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if err := formatFormula(sb, arg); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(')')
+	default:
+		return &UnsupportedError{Expr: expr}
+	}
+	return nil
+}
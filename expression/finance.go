@@ -0,0 +1,273 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+)
+
+// The financial functions use the sign convention of other spreadsheets:
+// money paid out is negative and money received is positive. Payments are
+// made at the end of each period, or at the beginning when the optional type
+// argument is 1. They are computed with exact arithmetic when the number of
+// periods is a whole number and the result is converted to the number model
+// like the result of an operator.
+
+// ConvergenceError is returned by IRR and RATE when an iterative solution
+// does not settle within the tolerance.
+type ConvergenceError struct {
+	Iterations int
+	Tolerance  float64
+}
+
+func (e *ConvergenceError) Error() string {
+	return fmt.Sprintf("did not converge to within %g in %d iterations", e.Tolerance, e.Iterations)
+}
+
+var one = constant.MakeInt64(1)
+
+func add(x, y constant.Value) constant.Value { return constant.BinaryOp(x, token.ADD, y) }
+func sub(x, y constant.Value) constant.Value { return constant.BinaryOp(x, token.SUB, y) }
+func mul(x, y constant.Value) constant.Value { return constant.BinaryOp(x, token.MUL, y) }
+
+func quo(x, y constant.Value) (constant.Value, error) {
+	if constant.Sign(y) == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return constant.BinaryOp(x, token.QUO, y), nil
+}
+
+// growth returns (1 + rate) ^ periods.
+func growth(rate, periods constant.Value) (constant.Value, error) {
+	v, err := power([]Value{add(one, rate), periods})
+	if err != nil {
+		return nil, err
+	}
+	return v.(constant.Value), nil
+}
+
+// financeArgs returns the numeric arguments with the missing optional ones
+// set to zero, and checks that the payment type at index due is 0 or 1.
+func financeArgs(args []Value, n, due int) ([]constant.Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	for len(nums) < n {
+		nums = append(nums, constant.MakeInt64(0))
+	}
+	if t, ok := integer(nums[due]); !ok || t != 0 && t != 1 {
+		return nil, fmt.Errorf("the payment type must be 0 or 1, got %s", nums[due].ExactString())
+	}
+	return nums, nil
+}
+
+// annuity returns the value at the end of the periods of a payment made
+// every period: pmt * (1 + rate * type) * ((1 + rate) ^ periods - 1) / rate.
+func annuity(rate, periods, payment, due, g constant.Value) (constant.Value, error) {
+	if constant.Sign(rate) == 0 {
+		return mul(payment, periods), nil
+	}
+	return quo(mul(mul(payment, add(one, mul(rate, due))), sub(g, one)), rate)
+}
+
+// futureValue returns the value after the periods of a present value and
+// payments. Zero means the cash flows balance.
+func futureValue(rate, periods, payment, present, due constant.Value) (constant.Value, error) {
+	g, err := growth(rate, periods)
+	if err != nil {
+		return nil, err
+	}
+	a, err := annuity(rate, periods, payment, due, g)
+	if err != nil {
+		return nil, err
+	}
+	return add(mul(present, g), a), nil
+}
+
+// fv returns the future value of an investment: FV(rate, periods, payment,
+// [present value], [type]).
+func fv(args []Value) (Value, error) {
+	nums, err := financeArgs(args, 5, 4)
+	if err != nil {
+		return nil, err
+	}
+	v, err := futureValue(nums[0], nums[1], nums[2], nums[3], nums[4])
+	if err != nil {
+		return nil, err
+	}
+	return constant.UnaryOp(token.SUB, v, 0), nil
+}
+
+// pv returns the present value of an investment: PV(rate, periods, payment,
+// [future value], [type]).
+func pv(args []Value) (Value, error) {
+	nums, err := financeArgs(args, 5, 4)
+	if err != nil {
+		return nil, err
+	}
+	rate, periods, payment, future, due := nums[0], nums[1], nums[2], nums[3], nums[4]
+	g, err := growth(rate, periods)
+	if err != nil {
+		return nil, err
+	}
+	a, err := annuity(rate, periods, payment, due, g)
+	if err != nil {
+		return nil, err
+	}
+	return quo(constant.UnaryOp(token.SUB, add(future, a), 0), g)
+}
+
+// pmt returns the payment each period that pays off a loan: PMT(rate,
+// periods, present value, [future value], [type]).
+func pmt(args []Value) (Value, error) {
+	nums, err := financeArgs(args, 5, 4)
+	if err != nil {
+		return nil, err
+	}
+	rate, periods, present, future, due := nums[0], nums[1], nums[2], nums[3], nums[4]
+	if constant.Sign(rate) == 0 {
+		return quo(constant.UnaryOp(token.SUB, add(present, future), 0), periods)
+	}
+	g, err := growth(rate, periods)
+	if err != nil {
+		return nil, err
+	}
+	// The annuity of a payment of 1 is the factor the payment is multiplied by.
+	a, err := annuity(rate, periods, one, due, g)
+	if err != nil {
+		return nil, err
+	}
+	return quo(constant.UnaryOp(token.SUB, add(mul(present, g), future), 0), a)
+}
+
+// npv returns the value at the start of the first period of cash flows at
+// the end of each period: NPV(rate, cash flows...). Blank cells are skipped.
+func npv(args []Value) (Value, error) {
+	nums, err := numbers(skipBlanks(args))
+	if err != nil {
+		return nil, err
+	}
+	return presentValue(nums[0], nums[1:])
+}
+
+// presentValue discounts the cash flows at the end of each period.
+func presentValue(rate constant.Value, flows []constant.Value) (constant.Value, error) {
+	factor := add(one, rate)
+	discount := factor
+	total := constant.MakeInt64(0)
+	for _, flow := range flows {
+		v, err := quo(flow, discount)
+		if err != nil {
+			return nil, err
+		}
+		total, discount = add(total, v), mul(discount, factor)
+	}
+	return total, nil
+}
+
+// irr returns the rate at which the net present value of the cash flows in
+// a range is zero, where the first cash flow is at the start: IRR(cash
+// flows, [guess]).
+func irr(ev *evaluation, args []Value) (Value, error) {
+	flows, err := ev.rangeNumbers(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	guess, err := guessArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	positive, negative := false, false
+	for _, flow := range flows {
+		positive = positive || constant.Sign(flow) > 0
+		negative = negative || constant.Sign(flow) < 0
+	}
+	if !positive || !negative {
+		return nil, errors.New("the cash flows need at least one payment and one receipt")
+	}
+	return ev.solve(guess, func(rate constant.Value) (constant.Value, error) {
+		v, err := presentValue(rate, flows[1:])
+		if err != nil {
+			return nil, err
+		}
+		return add(flows[0], v), nil
+	})
+}
+
+// interestRate returns the interest rate per period of an annuity:
+// RATE(periods, payment, present value, [future value], [type], [guess]).
+func interestRate(ev *evaluation, args []Value) (Value, error) {
+	guess, err := guessArg(args, 5)
+	if err != nil {
+		return nil, err
+	}
+	nums, err := financeArgs(args[:min(len(args), 5)], 5, 4)
+	if err != nil {
+		return nil, err
+	}
+	periods, payment, present, future, due := nums[0], nums[1], nums[2], nums[3], nums[4]
+	return ev.solve(guess, func(rate constant.Value) (constant.Value, error) {
+		v, err := futureValue(rate, periods, payment, present, due)
+		if err != nil {
+			return nil, err
+		}
+		return add(v, future), nil
+	})
+}
+
+func guessArg(args []Value, i int) (constant.Value, error) {
+	if len(args) <= i {
+		return constant.MakeFromLiteral("0.1", token.FLOAT, 0), nil
+	}
+	if !isNumber(args[i]) {
+		return nil, fmt.Errorf("argument %d is %s, not a number", i+1, exactString(args[i]))
+	}
+	return args[i].(constant.Value), nil
+}
+
+// solve finds a zero of f near the guess with the secant method. Every
+// estimate is rounded to a few more decimal digits than the tolerance needs
+// so that exact arithmetic does not build ever larger fractions.
+func (ev *evaluation) solve(guess constant.Value, f func(constant.Value) (constant.Value, error)) (constant.Value, error) {
+	tolerance := positiveOr(ev.numeric.Tolerance, DefaultTolerance)
+	iterations := positiveOr(ev.numeric.MaxIterations, DefaultMaxIterations)
+	digits := min(int(math.Ceil(-math.Log10(tolerance)))+2, maxRoundingDigits)
+	limit := constant.MakeFloat64(tolerance)
+
+	x0, x1 := guess, add(guess, constant.MakeFromLiteral("0.01", token.FLOAT, 0))
+	f0, err := f(x0)
+	if err != nil {
+		return nil, err
+	}
+	for range iterations {
+		f1, err := f(x1)
+		if err != nil {
+			return nil, err
+		}
+		if constant.Sign(f1) == 0 {
+			return x1, nil
+		}
+		slope := sub(f1, f0)
+		if constant.Sign(slope) == 0 {
+			break
+		}
+		step, _ := quo(mul(f1, sub(x1, x0)), slope)
+		x2 := round(sub(x1, step), digits, RoundHalfEven)
+		if d := sub(x2, x1); constant.Compare(d, token.LEQ, limit) && constant.Compare(d, token.GEQ, constant.UnaryOp(token.SUB, limit, 0)) {
+			return x2, nil
+		}
+		x0, f0, x1 = x1, f1, x2
+	}
+	return nil, &ConvergenceError{Iterations: iterations, Tolerance: tolerance}
+}
+
+// positiveOr returns v, or fallback when v is not positive.
+func positiveOr[T int | float64](v, fallback T) T {
+	if v <= 0 {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+package expression_test
+
+import (
+	"errors"
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// cashFlows has the cash flows -70000, 12000, 15000, 18000, 21000 and 26000
+// in A0:A5.
+type cashFlows struct {
+	fakeLookup
+	numeric expression.Numeric
+}
+
+func (s cashFlows) Numeric() expression.Numeric { return s.numeric }
+
+func newCashFlows(numeric expression.Numeric) cashFlows {
+	return cashFlows{
+		numeric: numeric,
+		fakeLookup: cellLookup(map[string]expression.Value{
+			"A0": constant.MakeInt64(-70000),
+			"A1": constant.MakeInt64(12000),
+			"A2": constant.MakeInt64(15000),
+			"A3": constant.MakeInt64(18000),
+			"A4": constant.MakeInt64(21000),
+			"A5": constant.MakeInt64(26000),
+		}),
+	}
+}
+
+func TestFinancialFunctions(t *testing.T) {
+	var (
+		exact = expression.Numeric{}
+		float = expression.Numeric{Mode: expression.Float}
+		cents = expression.Numeric{Mode: expression.Decimal, Scale: 2}
+	)
+	for _, tt := range []struct {
+		Name       string
+		Numeric    expression.Numeric
+		Expression string
+		Result     string
+	}{
+		{Name: "pmt", Numeric: exact, Expression: "=ROUND(PMT(0.05/12, 360, 200000), 2)", Result: "-1073.64"},
+		{Name: "pmt in decimal", Numeric: cents, Expression: "=PMT(0.05/12, 360, 200000)", Result: "-1073.64"},
+		{Name: "pmt without interest", Numeric: exact, Expression: "=PMT(0, 10, 1000)", Result: "-100"},
+		{Name: "pmt at the start", Numeric: exact, Expression: "=ROUND(PMT(0.08/12, 10, 10000, 0, 1), 2)", Result: "-1030.16"},
+		{Name: "pmt saving", Numeric: exact, Expression: "=ROUND(PMT(0.06/12, 18*12, 0, 50000), 2)", Result: "-129.08"},
+		{Name: "pmt is exact", Numeric: exact, Expression: "=PMT(1/2, 2, -9)", Result: "8.1"},
+		{Name: "fv", Numeric: exact, Expression: "=ROUND(FV(0.06/12, 10, -200, -500, 1), 2)", Result: "2581.4"},
+		{Name: "fv without interest", Numeric: exact, Expression: "=FV(0, 12, -100)", Result: "1200"},
+		{Name: "pv", Numeric: exact, Expression: "=ROUND(PV(0.08/12, 12*20, 500), 2)", Result: "-59777.15"},
+		{Name: "npv", Numeric: exact, Expression: "=ROUND(NPV(0.1, -10000, 3000, 4200, 6800), 2)", Result: "1188.44"},
+		{Name: "npv of a range", Numeric: exact, Expression: "=ROUND(NPV(0.08, A1:A9) + A0, 2)", Result: "1390.96"},
+		{Name: "npv is exact", Numeric: exact, Expression: "=NPV(1, 2, 4)", Result: "2"},
+		{Name: "irr", Numeric: exact, Expression: "=IRR(A0:A5)", Result: "0.086630948"},
+		{Name: "irr with blanks", Numeric: exact, Expression: "=ROUND(IRR(A0:A9), 4)", Result: "0.0866"},
+		{Name: "irr negative", Numeric: float, Expression: "=ROUND(IRR(A0:A4), 4)", Result: "-0.0212"},
+		{Name: "irr with guess", Numeric: exact, Expression: "=ROUND(IRR(A0:A2, -0.4), 4)", Result: "-0.4435"},
+		{Name: "irr in decimal", Numeric: cents, Expression: "=IRR(A0:A5) * 100", Result: "8.66"},
+		{Name: "rate", Numeric: exact, Expression: "=RATE(48, -200, 8000)", Result: "0.0077014725"},
+		{Name: "rate in decimal", Numeric: cents, Expression: "=RATE(360, -1073.64, 200000) * 12 * 100", Result: "5.00"},
+		{Name: "rate of a saving", Numeric: exact, Expression: "=ROUND(RATE(10, 0, -1000, 2000), 6)", Result: "0.071773"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(newCashFlows(tt.Numeric), node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, tt.Numeric.Format(v))
+		})
+	}
+}
+
+func TestFinancialFunctions_exactResults(t *testing.T) {
+	node, err := expression.FormulaDialect.Parse("=IRR(A0:A5)")
+	require.NoError(t, err)
+	v, err := expression.Evaluate(newCashFlows(expression.Numeric{}), node)
+	require.NoError(t, err)
+	// The rate is a short decimal, not the expansion of a float64.
+	assert.Equal(t, "86630948037/1000000000000", v.(constant.Value).ExactString())
+}
+
+func TestFinancialFunctions_errors(t *testing.T) {
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "=PMT(0.1, 10, 1000, 0, 2)", Error: "PMT: the payment type must be 0 or 1, got 2"},
+		{Expression: "=PMT(0, 0, 1000)", Error: "PMT: division by zero"},
+		{Expression: `=FV("5%", 10, 100)`, Error: `FV: argument 1 is "5%", not a number`},
+		{Expression: "=IRR(A1:A5)", Error: "IRR: the cash flows need at least one payment and one receipt"},
+		{Expression: "=IRR(A0:A5, TRUE)", Error: "IRR: argument 2 is true, not a number"},
+		{Expression: "=RATE(10, 100, 1000)", Error: "RATE: did not converge to within 1e-10 in 100 iterations"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(newCashFlows(expression.Numeric{}), node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+
+	t.Run("convergence settings", func(t *testing.T) {
+		node, err := expression.FormulaDialect.Parse("=IRR(A0:A5, 5)")
+		require.NoError(t, err)
+		_, err = expression.Evaluate(newCashFlows(expression.Numeric{Tolerance: 1e-6, MaxIterations: 3}), node)
+		var convergence *expression.ConvergenceError
+		require.True(t, errors.As(err, &convergence))
+		assert.Equal(t, &expression.ConvergenceError{Iterations: 3, Tolerance: 1e-6}, convergence)
+	})
+}
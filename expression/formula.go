@@ -0,0 +1,420 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// parseFormula parses the spreadsheet formula dialect. The result uses the
+// same node types as the Go dialect:
+//
+//   - ranges such as A1:B2 are binary expressions with the token.COLON operator
+//   - = and <> compare with token.EQL and token.NEQ
+//   - x ^ y and x & y become calls to POWER and CONCAT; these calls have no
+//     parenthesis positions so Format can print them as operators again
+//   - TRUE and FALSE become the identifiers true and false
+//   - a number followed by the name of a unit, as in 5 km, multiplies the
+//     number by the unit; the operator has no position so Format can print
+//     it without the *
+func parseFormula(src string) (ast.Expr, error) {
+	p := formulaParser{lexer: formulaLexer{src: src}}
+	p.next()
+	if p.tok.kind == '=' {
+		p.next()
+	}
+	if p.tok.kind == formulaEOF {
+		return nil, nil
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != formulaEOF {
+		return nil, p.unexpected()
+	}
+	return expr, nil
+}
+
+type formulaTokenKind rune
+
+const (
+	formulaEOF formulaTokenKind = -(iota + 1)
+	formulaNumber
+	formulaString
+	formulaName
+	formulaNotEqual
+	formulaLessEqual
+	formulaGreaterEqual
+)
+
+type formulaToken struct {
+	kind       formulaTokenKind
+	start, end int
+	text       string
+}
+
+type formulaLexer struct {
+	src    string
+	offset int
+}
+
+func (l *formulaLexer) next() (formulaToken, error) {
+	for l.offset < len(l.src) && isSpace(rune(l.src[l.offset])) {
+		l.offset++
+	}
+	start := l.offset
+	if start >= len(l.src) {
+		return formulaToken{kind: formulaEOF, start: start, end: start}, nil
+	}
+	c, size := utf8.DecodeRuneInString(l.src[start:])
+	token := func(kind formulaTokenKind, end int) (formulaToken, error) {
+		l.offset = end
+		return formulaToken{kind: kind, start: start, end: end, text: l.src[start:end]}, nil
+	}
+	switch {
+	case c == '<' && strings.HasPrefix(l.src[start:], "<>"):
+		return token(formulaNotEqual, start+2)
+	case c == '<' && strings.HasPrefix(l.src[start:], "<="):
+		return token(formulaLessEqual, start+2)
+	case c == '>' && strings.HasPrefix(l.src[start:], ">="):
+		return token(formulaGreaterEqual, start+2)
+	case strings.ContainsRune("+-*/^&=<>(),:", c):
+		return token(formulaTokenKind(c), start+1)
+	case c == '"':
+		end := start + 1
+		for {
+			i := strings.IndexByte(l.src[end:], '"')
+			if i < 0 {
+				return formulaToken{}, &Diagnostic{Start: start, End: len(l.src), Err: errors.New("missing closing quote")}
+			}
+			end += i + 1
+			if end < len(l.src) && l.src[end] == '"' {
+				end++
+				continue
+			}
+			return token(formulaString, end)
+		}
+	case '0' <= c && c <= '9' || c == '.':
+		end := start
+		for end < len(l.src) && ('0' <= l.src[end] && l.src[end] <= '9' || l.src[end] == '.') {
+			end++
+		}
+		if end < len(l.src) && (l.src[end] == 'e' || l.src[end] == 'E') {
+			exp := end + 1
+			if exp < len(l.src) && (l.src[exp] == '+' || l.src[exp] == '-') {
+				exp++
+			}
+			if exp < len(l.src) && '0' <= l.src[exp] && l.src[exp] <= '9' {
+				end = exp
+				for end < len(l.src) && '0' <= l.src[end] && l.src[end] <= '9' {
+					end++
+				}
+			}
+		}
+		return token(formulaNumber, end)
+	case unicode.IsLetter(c) || c == '_':
+		end := start + size
+		for end < len(l.src) {
+			r, n := utf8.DecodeRuneInString(l.src[end:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+				break
+			}
+			end += n
+		}
+		return token(formulaName, end)
+	default:
+		return formulaToken{}, &Diagnostic{Start: start, End: start + size, Err: fmt.Errorf("invalid character %q", c)}
+	}
+}
+
+type formulaParser struct {
+	lexer formulaLexer
+	tok   formulaToken
+	err   error
+
+	// open holds the offsets of the parentheses that are not yet closed.
+	open []int
+}
+
+func (p *formulaParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lexer.next()
+}
+
+func pos(offset int) token.Pos { return token.Pos(offset + 1) }
+
+func (p *formulaParser) unexpected() error {
+	if p.err != nil {
+		return p.err
+	}
+	switch p.tok.kind {
+	case formulaEOF:
+		if len(p.open) > 0 {
+			start := p.open[len(p.open)-1]
+			return &Diagnostic{Start: start, End: start + 1, Err: errors.New("missing closing parenthesis")}
+		}
+		return &Diagnostic{Start: len(strings.TrimRightFunc(p.lexer.src, isSpace)), End: len(p.lexer.src), Err: errors.New("the formula ends before the last operator has a value")}
+	case ')':
+		if len(p.open) == 0 {
+			return &Diagnostic{Start: p.tok.start, End: p.tok.end, Err: errors.New("closing parenthesis without a matching opening parenthesis")}
+		}
+	}
+	return &Diagnostic{Start: p.tok.start, End: p.tok.end, Err: fmt.Errorf("unexpected %s", p.tok.text)}
+}
+
+var formulaComparisons = map[formulaTokenKind]token.Token{
+	'=':                 token.EQL,
+	formulaNotEqual:     token.NEQ,
+	'<':                 token.LSS,
+	'>':                 token.GTR,
+	formulaLessEqual:    token.LEQ,
+	formulaGreaterEqual: token.GEQ,
+}
+
+// parseExpr parses comparisons, the lowest precedence level.
+func (p *formulaParser) parseExpr() (ast.Expr, error) {
+	x, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := formulaComparisons[p.tok.kind]
+		if !ok {
+			return x, nil
+		}
+		opPos := pos(p.tok.start)
+		p.next()
+		y, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		x = &ast.BinaryExpr{X: x, OpPos: opPos, Op: op, Y: y}
+	}
+}
+
+func (p *formulaParser) parseConcat() (ast.Expr, error) {
+	return p.parseOperatorCall('&', "CONCAT", p.parseAdditive)
+}
+
+func (p *formulaParser) parseAdditive() (ast.Expr, error) {
+	return p.parseBinary(map[formulaTokenKind]token.Token{'+': token.ADD, '-': token.SUB}, p.parseMultiplicative)
+}
+
+func (p *formulaParser) parseMultiplicative() (ast.Expr, error) {
+	return p.parseBinary(map[formulaTokenKind]token.Token{'*': token.MUL, '/': token.QUO}, p.parsePower)
+}
+
+func (p *formulaParser) parsePower() (ast.Expr, error) {
+	return p.parseOperatorCall('^', "POWER", p.parseUnary)
+}
+
+func (p *formulaParser) parseBinary(ops map[formulaTokenKind]token.Token, operand func() (ast.Expr, error)) (ast.Expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := ops[p.tok.kind]
+		if !ok {
+			return x, nil
+		}
+		opPos := pos(p.tok.start)
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &ast.BinaryExpr{X: x, OpPos: opPos, Op: op, Y: y}
+	}
+}
+
+// parseOperatorCall parses a left associative operator that is evaluated by
+// calling a function.
+func (p *formulaParser) parseOperatorCall(kind formulaTokenKind, name string, operand func() (ast.Expr, error)) (ast.Expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == kind {
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: x.Pos(), Name: name},
+			Args:   []ast.Expr{x, y},
+			Rparen: y.End() - 1,
+		}
+	}
+	return x, nil
+}
+
+func (p *formulaParser) parseUnary() (ast.Expr, error) {
+	switch p.tok.kind {
+	case '-', '+':
+		op := token.SUB
+		if p.tok.kind == '+' {
+			op = token.ADD
+		}
+		opPos := pos(p.tok.start)
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.UnaryExpr{OpPos: opPos, Op: op, X: x}, nil
+	default:
+		return p.parseOperand()
+	}
+}
+
+func (p *formulaParser) parseOperand() (ast.Expr, error) {
+	tok := p.tok
+	switch tok.kind {
+	case formulaNumber:
+		kind := token.INT
+		if strings.ContainsAny(tok.text, ".eE") {
+			kind = token.FLOAT
+		}
+		if strings.Count(tok.text, ".") > 1 || tok.text == "." {
+			return nil, &Diagnostic{Start: tok.start, End: tok.end, Err: fmt.Errorf("invalid number %s", tok.text)}
+		}
+		p.next()
+		lit := &ast.BasicLit{ValuePos: pos(tok.start), Kind: kind, Value: tok.text}
+		if _, ok := namedUnit(p.tok.text); ok && p.tok.kind == formulaName {
+			return p.parseUnit(lit)
+		}
+		return lit, nil
+	case formulaString:
+		p.next()
+		value := strings.ReplaceAll(tok.text[1:len(tok.text)-1], `""`, `"`)
+		return &ast.BasicLit{ValuePos: pos(tok.start), Kind: token.STRING, Value: strconv.Quote(value)}, nil
+	case '(':
+		p.open = append(p.open, tok.start)
+		p.next()
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != ')' {
+			return nil, p.unexpected()
+		}
+		p.open = p.open[:len(p.open)-1]
+		rparen := pos(p.tok.start)
+		p.next()
+		return &ast.ParenExpr{Lparen: pos(tok.start), X: x, Rparen: rparen}, nil
+	case formulaName:
+		p.next()
+		if p.tok.kind == '(' {
+			return p.parseCall(&ast.Ident{NamePos: pos(tok.start), Name: tok.text})
+		}
+		return p.parseReference(tok)
+	default:
+		if p.err != nil || tok.kind == formulaEOF || tok.kind == ')' && len(p.open) == 0 {
+			return nil, p.unexpected()
+		}
+		return nil, &Diagnostic{Start: tok.start, End: tok.end, Err: fmt.Errorf("expected a value but found %s", tok.text)}
+	}
+}
+
+// parseUnit parses the unit after a number. The unit may be raised to a
+// power, so 5 m^2 is five square metres.
+func (p *formulaParser) parseUnit(number ast.Expr) (ast.Expr, error) {
+	var unit ast.Expr = &ast.Ident{NamePos: pos(p.tok.start), Name: p.tok.text}
+	p.next()
+	if p.tok.kind == '^' {
+		p.next()
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		unit = &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: unit.Pos(), Name: "POWER"},
+			Args:   []ast.Expr{unit, exponent},
+			Rparen: exponent.End() - 1,
+		}
+	}
+	return &ast.BinaryExpr{X: number, Op: token.MUL, Y: unit}, nil
+}
+
+func (p *formulaParser) parseReference(tok formulaToken) (ast.Expr, error) {
+	ident := formulaIdent(tok)
+	if p.tok.kind != ':' {
+		return ident, nil
+	}
+	colon := p.tok
+	p.next()
+	if p.tok.kind != formulaName {
+		return nil, &Diagnostic{Start: colon.start, End: colon.end, Err: errors.New("a range needs a cell on both sides of the colon")}
+	}
+	end := formulaIdent(p.tok)
+	p.next()
+	for _, corner := range []*ast.Ident{ident, end} {
+		if _, _, ok := parseCellName(corner.Name); !ok {
+			return nil, newDiagnostic(corner, fmt.Errorf("%s is not a cell name", corner.Name))
+		}
+	}
+	return &ast.BinaryExpr{X: ident, OpPos: pos(colon.start), Op: token.COLON, Y: end}, nil
+}
+
+// formulaIdent converts a name token to an identifier. Cell names and the
+// boolean literals are case-insensitive.
+func formulaIdent(tok formulaToken) *ast.Ident {
+	name := tok.text
+	switch upper := strings.ToUpper(name); {
+	case upper == "TRUE" || upper == "FALSE":
+		name = strings.ToLower(name)
+	default:
+		if _, _, ok := parseCellName(upper); ok {
+			name = upper
+		}
+	}
+	return &ast.Ident{NamePos: pos(tok.start), Name: name}
+}
+
+// parseCall parses the arguments of a call. A call may be followed by more
+// arguments to call the LAMBDA it returns: LAMBDA(x, x * 2)(21).
+func (p *formulaParser) parseCall(fun ast.Expr) (ast.Expr, error) {
+	call := &ast.CallExpr{
+		Fun:    fun,
+		Lparen: pos(p.tok.start),
+	}
+	p.open = append(p.open, p.tok.start)
+	p.next()
+	if p.tok.kind != ')' {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.tok.kind != ',' {
+				break
+			}
+			p.next()
+		}
+	}
+	switch p.tok.kind {
+	case ')':
+	case formulaNumber, formulaString, formulaName, '(':
+		return nil, &Diagnostic{Start: p.tok.start, End: p.tok.end, Err: errors.New("missing comma between function arguments")}
+	default:
+		return nil, p.unexpected()
+	}
+	p.open = p.open[:len(p.open)-1]
+	call.Rparen = pos(p.tok.start)
+	p.next()
+	if p.tok.kind == '(' {
+		return p.parseCall(call)
+	}
+	return call, nil
+}
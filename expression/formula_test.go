@@ -0,0 +1,155 @@
+package expression_test
+
+import (
+	"errors"
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestFormulaDialect(t *testing.T) {
+	lookup := fakeLookup{
+		resolve: func(s string) (constant.Value, error) {
+			return constant.MakeInt64(int64(len(s))), nil
+		},
+		resolveCell: func(column, row int) (expression.Value, error) {
+			return constant.MakeInt64(int64(10*column + row)), nil
+		},
+	}
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Formatted  string
+		Result     string
+	}{
+		{Name: "number", Expression: "=1", Formatted: "=1", Result: "1"},
+		{Name: "without equals sign", Expression: "1+2", Formatted: "=1 + 2", Result: "3"},
+		{Name: "range", Expression: "=SUM(A1:B2)", Formatted: "=SUM(A1:B2)", Result: "26"},
+		{Name: "reversed range", Expression: "=SUM(B2:A1)", Formatted: "=SUM(B2:A1)", Result: "26"},
+		{Name: "lower case cells", Expression: "=sum(a1:a2)", Formatted: "=sum(A1:A2)", Result: "3"},
+		{Name: "power", Expression: "=2^10", Formatted: "=2 ^ 10", Result: "1024"},
+		{Name: "power is left associative", Expression: "=2^3^2", Formatted: "=2 ^ 3 ^ 2", Result: "64"},
+		{Name: "negation binds tighter than power", Expression: "=-2^2", Formatted: "=-2 ^ 2", Result: "4"},
+		{Name: "power binds tighter than multiplication", Expression: "=3*2^2", Formatted: "=3 * 2 ^ 2", Result: "12"},
+		{Name: "negative exponent", Expression: "=2^-2", Formatted: "=2 ^ -2", Result: "1/4"},
+		{Name: "fractional exponent", Expression: "=4^0.5", Formatted: "=4 ^ 0.5", Result: "2"},
+		{Name: "concatenation", Expression: `="a"&B1&TRUE`, Formatted: `="a" & B1 & TRUE`, Result: `"a11TRUE"`},
+		{Name: "addition binds tighter than concatenation", Expression: `=1+2&"x"`, Formatted: `=1 + 2 & "x"`, Result: `"3x"`},
+		{Name: "escaped quote", Expression: `="say ""hi"""`, Formatted: `="say ""hi"""`, Result: `"say \"hi\""`},
+		{Name: "parentheses", Expression: "=(1+2)*3", Formatted: "=(1 + 2) * 3", Result: "9"},
+		{Name: "boolean", Expression: "=true", Formatted: "=TRUE", Result: "true"},
+		{Name: "name", Expression: "=abc", Formatted: "=abc", Result: "3"},
+		{Name: "float", Expression: "=1.5e1", Formatted: "=1.5e1", Result: "15"},
+		{Name: "IF", Expression: "=IF(TRUE, A1, 0)", Formatted: "=IF(TRUE, A1, 0)", Result: "1"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+
+			formatted, err := expression.FormulaDialect.Format(node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Formatted, formatted)
+
+			reparsed, err := expression.FormulaDialect.Parse(formatted)
+			require.NoError(t, err)
+			again, err := expression.FormulaDialect.Format(reparsed)
+			require.NoError(t, err)
+			assert.Equal(t, formatted, again)
+
+			v, err := expression.Evaluate(lookup, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.(constant.Value).ExactString())
+		})
+	}
+
+	t.Run("comparisons", func(t *testing.T) {
+		node, err := expression.FormulaDialect.Parse("=A1<>B1 = (1<=2)")
+		require.NoError(t, err)
+		formatted, err := expression.FormulaDialect.Format(node)
+		require.NoError(t, err)
+		assert.Equal(t, "=A1 <> B1 = (1 <= 2)", formatted)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		for _, in := range []string{"", "=", " = "} {
+			node, err := expression.FormulaDialect.Parse(in)
+			require.NoError(t, err)
+			assert.Nil(t, node)
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		const source = "=SUM(A1:B2) + C3"
+		node, err := expression.FormulaDialect.Parse(source)
+		require.NoError(t, err)
+		refs := expression.References(node)
+		require.Len(t, refs, 2)
+		assert.Equal(t, "A1:B2", source[refs[0].Start:refs[0].End])
+		assert.Equal(t, "C3", source[refs[1].Start:refs[1].End])
+	})
+
+	t.Run("range outside of a function call", func(t *testing.T) {
+		node, err := expression.FormulaDialect.Parse("=A1:B2 + 1")
+		require.NoError(t, err)
+		v, err := expression.Evaluate(lookup, node)
+		require.NoError(t, err)
+		assert.Equal(t, "{2, 12; 3, 13}", v.String())
+	})
+
+	t.Run("power error", func(t *testing.T) {
+		const source = "=1 + (-1)^0.5"
+		node, err := expression.FormulaDialect.Parse(source)
+		require.NoError(t, err)
+		_, err = expression.Evaluate(lookup, node)
+		var d *expression.Diagnostic
+		require.True(t, errors.As(err, &d))
+		assert.EqualError(t, err, "POWER: -1 ^ 0.5 is not a real number")
+		assert.Equal(t, "(-1)^0.5", source[d.Start:d.End])
+	})
+}
+
+func TestFormulaDialect_diagnostics(t *testing.T) {
+	for _, tt := range []struct {
+		Expression string
+		Message    string
+		Span       string
+	}{
+		{Expression: "=(1 + (2 * 3)", Message: "missing closing parenthesis", Span: "("},
+		{Expression: "=SUM(1, (2)", Message: "missing closing parenthesis", Span: "("},
+		{Expression: "=1 + ", Message: "the formula ends before the last operator has a value", Span: " "},
+		{Expression: "=1 + )", Message: "closing parenthesis without a matching opening parenthesis", Span: ")"},
+		{Expression: "=SUM(1, )", Message: "expected a value but found )", Span: ")"},
+		{Expression: "=(1 + 2))", Message: "closing parenthesis without a matching opening parenthesis", Span: ")"},
+		{Expression: "=1 23", Message: "unexpected 23", Span: "23"},
+		{Expression: "=SUM(1 2)", Message: "missing comma between function arguments", Span: "2"},
+		{Expression: `="abc`, Message: "missing closing quote", Span: `"abc`},
+		{Expression: "=1 + $A1", Message: "invalid character '$'", Span: "$"},
+		{Expression: "=SUM(A1:)", Message: "a range needs a cell on both sides of the colon", Span: ":"},
+		{Expression: "=SUM(A1:x)", Message: "x is not a cell name", Span: "x"},
+		{Expression: "=1..2", Message: "invalid number 1..2", Span: "1..2"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			_, err := expression.FormulaDialect.Parse(tt.Expression)
+			var d *expression.Diagnostic
+			require.True(t, errors.As(err, &d), "expected a diagnostic got %v", err)
+			assert.EqualError(t, err, tt.Message)
+			assert.Equal(t, tt.Span, tt.Expression[d.Start:d.End])
+		})
+	}
+}
+
+func TestDialect_text(t *testing.T) {
+	for _, d := range []expression.Dialect{expression.GoDialect, expression.FormulaDialect} {
+		text, err := d.MarshalText()
+		require.NoError(t, err)
+		var got expression.Dialect
+		require.NoError(t, got.UnmarshalText(text))
+		assert.Equal(t, d, got)
+	}
+	var d expression.Dialect
+	assert.Error(t, d.UnmarshalText([]byte("lisp")))
+}
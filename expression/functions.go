@@ -0,0 +1,566 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+type function struct {
+	minArgs, maxArgs int // maxArgs is -1 for variadic functions
+
+	// call receives the evaluated arguments.
+	call func(args []Value) (Value, error)
+
+	// compile is set instead of call by functions that decide when, or
+	// whether, their arguments are evaluated.
+	compile func(args []evalFunc) evalFunc
+
+	// lookup is set instead of call by functions that resolve cells
+	// themselves. The arguments at the positions in ranges are passed as
+	// cell ranges; the others are evaluated.
+	lookup func(ev *evaluation, args []Value) (Value, error)
+	ranges []int
+
+	// cells is set for lookup functions that use the position of their
+	// ranges, such as ROW and OFFSET. Other lookup functions also accept
+	// arrays where they read the values of a range.
+	cells bool
+
+	// dynamic is set for functions that return ranges that are only known
+	// when the function is evaluated.
+	dynamic bool
+
+	// blanks is set for functions called with Blank for the empty cells in
+	// ranges. Other functions receive zero.
+	blanks bool
+
+	// ignoreText is set for aggregate functions, such as SUM and AVERAGE,
+	// that skip the text and booleans in ranges and arrays, including the
+	// ranges returned by OFFSET. Text and booleans passed directly are
+	// still errors.
+	ignoreText bool
+
+	// arrays is set for functions that receive ranges and arrays as one
+	// Array argument instead of one argument per value. They may return
+	// arrays.
+	arrays bool
+
+	// bind is set instead of call by functions that bind names, such as
+	// LET. The arguments at the positions returned by names are the names
+	// and the others are passed to bind compiled.
+	bind  func(names []string, args []evalFunc) evalFunc
+	names func(n int) ([]int, error)
+}
+
+var functions = map[string]function{
+	"ABS":          {minArgs: 1, maxArgs: 1, call: abs},
+	"ADDRESS":      {minArgs: 2, maxArgs: 2, call: address},
+	"AVERAGE":      {minArgs: 1, maxArgs: -1, call: average, blanks: true, ignoreText: true},
+	"AVERAGEIF":    {minArgs: 2, maxArgs: 3, lookup: averageIf, ranges: []int{0, 2}},
+	"BASE":         {minArgs: 2, maxArgs: 3, call: base},
+	"BITAND":       {minArgs: 2, maxArgs: 2, call: bitwise(token.AND)},
+	"BITLSHIFT":    {minArgs: 2, maxArgs: 2, call: bitwise(token.SHL)},
+	"BITOR":        {minArgs: 2, maxArgs: 2, call: bitwise(token.OR)},
+	"BITRSHIFT":    {minArgs: 2, maxArgs: 2, call: bitwise(token.SHR)},
+	"BITXOR":       {minArgs: 2, maxArgs: 2, call: bitwise(token.XOR)},
+	"CEIL":         {minArgs: 1, maxArgs: 2, call: rounding(RoundCeiling)},
+	"COLUMN":       {minArgs: 0, maxArgs: 1, lookup: column, ranges: []int{0}, cells: true},
+	"COLUMNS":      {minArgs: 1, maxArgs: 1, lookup: columns, ranges: []int{0}, cells: true},
+	"CONCAT":       {minArgs: 1, maxArgs: -1, call: concat, blanks: true},
+	"CONVERT":      {minArgs: 2, maxArgs: 2, call: convert},
+	"CORREL":       {minArgs: 2, maxArgs: 2, lookup: correl, ranges: []int{0, 1}},
+	"COUNT":        {minArgs: 1, maxArgs: -1, call: count, blanks: true, ignoreText: true},
+	"COUNTA":       {minArgs: 1, maxArgs: -1, call: countA, blanks: true},
+	"COUNTIF":      {minArgs: 2, maxArgs: 2, lookup: countIfs, ranges: []int{0}},
+	"COUNTIFS":     {minArgs: 2, maxArgs: 2 * maxCriteria, lookup: countIfs, ranges: criteriaRanges(0)},
+	"DATE":         {minArgs: 3, maxArgs: 3, call: date},
+	"DATEVALUE":    {minArgs: 1, maxArgs: 1, call: dateValue},
+	"DAY":          {minArgs: 1, maxArgs: 1, call: timePart(time.Time.Day)},
+	"DEC2HEX":      {minArgs: 1, maxArgs: 2, call: dec2hex},
+	"DECIMAL":      {minArgs: 2, maxArgs: 2, call: decimal},
+	"EDATE":        {minArgs: 2, maxArgs: 2, call: edate},
+	"FILTER":       {minArgs: 2, maxArgs: 3, call: filter, arrays: true},
+	"FIND":         {minArgs: 2, maxArgs: 3, call: find},
+	"FLOOR":        {minArgs: 1, maxArgs: 2, call: rounding(RoundFloor)},
+	"FV":           {minArgs: 3, maxArgs: 5, call: fv},
+	"FX":           {minArgs: 2, maxArgs: 2, lookup: fx, dynamic: true},
+	"GCD":          {minArgs: 1, maxArgs: -1, call: gcd},
+	"HEX2DEC":      {minArgs: 1, maxArgs: 1, call: hex2dec},
+	"HLOOKUP":      {minArgs: 3, maxArgs: 4, lookup: hlookup, ranges: []int{1}},
+	"HOUR":         {minArgs: 1, maxArgs: 1, call: timePart(time.Time.Hour)},
+	"IF":           {minArgs: 2, maxArgs: 3, compile: compileIf},
+	"INDEX":        {minArgs: 2, maxArgs: 3, lookup: index, ranges: []int{0}, cells: true},
+	"INDIRECT":     {minArgs: 1, maxArgs: 1, lookup: indirect, dynamic: true},
+	"IRR":          {minArgs: 1, maxArgs: 2, lookup: irr, ranges: []int{0}},
+	"LAMBDA":       {minArgs: 1, maxArgs: -1, bind: lambda, names: lambdaNames},
+	"LCM":          {minArgs: 1, maxArgs: -1, call: lcm},
+	"LEN":          {minArgs: 1, maxArgs: 1, call: length},
+	"LET":          {minArgs: 3, maxArgs: -1, bind: let, names: letNames},
+	"LOWER":        {minArgs: 1, maxArgs: 1, call: lower},
+	"MATCH":        {minArgs: 2, maxArgs: 3, lookup: matchPosition, ranges: []int{1}},
+	"MAX":          {minArgs: 1, maxArgs: -1, call: extreme(token.GTR), blanks: true, ignoreText: true},
+	"MEDIAN":       {minArgs: 1, maxArgs: -1, call: median, blanks: true, ignoreText: true},
+	"MIN":          {minArgs: 1, maxArgs: -1, call: extreme(token.LSS), blanks: true, ignoreText: true},
+	"MINUTE":       {minArgs: 1, maxArgs: 1, call: timePart(time.Time.Minute)},
+	"MODE":         {minArgs: 1, maxArgs: -1, call: mode, blanks: true, ignoreText: true},
+	"MONTH":        {minArgs: 1, maxArgs: 1, call: timePart(func(t time.Time) int { return int(t.Month()) })},
+	"NETWORKDAYS":  {minArgs: 2, maxArgs: -1, call: networkDays},
+	"NOW":          {minArgs: 0, maxArgs: 0, compile: compileNow(false)},
+	"NPV":          {minArgs: 2, maxArgs: -1, call: npv, blanks: true, ignoreText: true},
+	"OFFSET":       {minArgs: 3, maxArgs: 5, lookup: offsetRange, ranges: []int{0}, cells: true, dynamic: true},
+	"PERCENTILE":   {minArgs: 2, maxArgs: 2, lookup: percentile, ranges: []int{0}},
+	"PMT":          {minArgs: 3, maxArgs: 5, call: pmt},
+	"POWER":        {minArgs: 2, maxArgs: 2, call: power},
+	"PV":           {minArgs: 3, maxArgs: 5, call: pv},
+	"QUARTILE":     {minArgs: 2, maxArgs: 2, lookup: quartile, ranges: []int{0}},
+	"RANK":         {minArgs: 2, maxArgs: 3, lookup: rank, ranges: []int{1}},
+	"RATE":         {minArgs: 3, maxArgs: 6, lookup: interestRate},
+	"REL":          {minArgs: 2, maxArgs: 4, lookup: relative, dynamic: true},
+	"REGEXEXTRACT": {minArgs: 2, maxArgs: 2, call: regexExtract},
+	"REGEXMATCH":   {minArgs: 2, maxArgs: 2, call: regexMatch},
+	"REGEXREPLACE": {minArgs: 3, maxArgs: 3, call: regexReplace},
+	"REPLACE":      {minArgs: 3, maxArgs: 4, call: replace},
+	"ROUND":        {minArgs: 1, maxArgs: 2, call: rounding(RoundHalfUp)},
+	"ROW":          {minArgs: 0, maxArgs: 1, lookup: row, ranges: []int{0}, cells: true},
+	"ROWS":         {minArgs: 1, maxArgs: 1, lookup: rows, ranges: []int{0}, cells: true},
+	"SECOND":       {minArgs: 1, maxArgs: 1, call: timePart(time.Time.Second)},
+	"SEQUENCE":     {minArgs: 1, maxArgs: 4, call: sequence, arrays: true},
+	"SORT":         {minArgs: 1, maxArgs: 4, call: sortArray, arrays: true},
+	"SPLIT":        {minArgs: 3, maxArgs: 3, call: split},
+	"STDEV":        {minArgs: 1, maxArgs: -1, call: standardDeviation(true), blanks: true, ignoreText: true},
+	"STDEVP":       {minArgs: 1, maxArgs: -1, call: standardDeviation(false), blanks: true, ignoreText: true},
+	"SUBSTR":       {minArgs: 2, maxArgs: 3, call: substr},
+	"SUM":          {minArgs: 1, maxArgs: -1, call: sum, ignoreText: true},
+	"SUMIF":        {minArgs: 2, maxArgs: 3, lookup: sumIf, ranges: []int{0, 2}},
+	"SUMIFS":       {minArgs: 3, maxArgs: 1 + 2*maxCriteria, lookup: sumIfs, ranges: criteriaRanges(1)},
+	"TEXT":         {minArgs: 2, maxArgs: 2, compile: compileText},
+	"TIME":         {minArgs: 3, maxArgs: 3, call: timeOfDay},
+	"TODAY":        {minArgs: 0, maxArgs: 0, compile: compileNow(true)},
+	"TRIM":         {minArgs: 1, maxArgs: 1, call: trim},
+	"TRUNC":        {minArgs: 1, maxArgs: 2, call: rounding(RoundDown)},
+	"UNIQUE":       {minArgs: 1, maxArgs: 3, call: unique, arrays: true},
+	"UPPER":        {minArgs: 1, maxArgs: 1, call: upper},
+	"VALUE":        {minArgs: 1, maxArgs: 1, call: value},
+	"VAR":          {minArgs: 1, maxArgs: -1, call: variance(true), blanks: true, ignoreText: true},
+	"VARP":         {minArgs: 1, maxArgs: -1, call: variance(false), blanks: true, ignoreText: true},
+	"VLOOKUP":      {minArgs: 3, maxArgs: 4, lookup: vlookup, ranges: []int{1}},
+	"WEEKDAY":      {minArgs: 1, maxArgs: 2, call: weekday},
+	"XLOOKUP":      {minArgs: 3, maxArgs: 5, lookup: xlookup, ranges: []int{1, 2}},
+	"YEAR":         {minArgs: 1, maxArgs: 1, call: timePart(time.Time.Year)},
+}
+
+func (fn function) checkArity(name string, n int) error {
+	switch {
+	case fn.minArgs == fn.maxArgs && n != fn.minArgs:
+		return fmt.Errorf("%s expects %d %s, got %d", name, fn.minArgs, plural(fn.minArgs, "argument"), n)
+	case n < fn.minArgs:
+		return fmt.Errorf("%s expects at least %d %s, got %d", name, fn.minArgs, plural(fn.minArgs, "argument"), n)
+	case fn.maxArgs >= 0 && n > fn.maxArgs:
+		return fmt.Errorf("%s expects at most %d %s, got %d", name, fn.maxArgs, plural(fn.maxArgs, "argument"), n)
+	}
+	return nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// resolveCall finds the function called by e and checks the number of
+// arguments.
+func resolveCall(e *ast.CallExpr) (string, function, *Diagnostic) {
+	ident, ok := e.Fun.(*ast.Ident)
+	if !ok {
+		return "", function{}, newDiagnostic(e, &UnsupportedError{Expr: e})
+	}
+	name := strings.ToUpper(ident.Name)
+	fn, ok := functions[name]
+	if !ok {
+		return "", function{}, newDiagnostic(ident, fmt.Errorf("unknown function %s", ident.Name))
+	}
+	if err := fn.checkArity(name, len(e.Args)); err != nil {
+		return "", function{}, newDiagnostic(e, err)
+	}
+	return name, fn, nil
+}
+
+func compileCall(e *ast.CallExpr) (evalFunc, error) {
+	if !calledBuiltin(e) {
+		return compileLambdaCall(e)
+	}
+	name, fn, d := resolveCall(e)
+	if d != nil {
+		return nil, d
+	}
+	if fn.bind != nil {
+		names, exprs, d := bindingNames(e, fn)
+		if d != nil {
+			return nil, d
+		}
+		args := make([]evalFunc, len(exprs))
+		for i, arg := range exprs {
+			var err error
+			args[i], err = compile(arg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return fn.bind(names, args), nil
+	}
+	if fn.compile != nil {
+		args := make([]evalFunc, len(e.Args))
+		for i, arg := range e.Args {
+			var err error
+			args[i], err = compile(arg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		call := fn.compile(args)
+		return func(ev *evaluation) (Value, error) {
+			v, err := call(ev)
+			return v, at(e, err)
+		}, nil
+	}
+	if fn.lookup != nil {
+		return compileLookup(e, name, fn)
+	}
+	// Ranges passed to functions that evaluate their arguments eagerly are
+	// expanded into one argument per cell, including ranges returned by
+	// functions such as OFFSET.
+	// Arrays are expanded the same way.
+	args := make([]func(*evaluation) ([]Value, error), len(e.Args))
+	for i, arg := range e.Args {
+		if fn.arrays {
+			eval, err := compile(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = func(ev *evaluation) ([]Value, error) {
+				v, err := eval(ev)
+				return []Value{v}, err
+			}
+			continue
+		}
+		if ref, ok := arg.(*ast.BinaryExpr); ok {
+			if ref, ok := rangeReference(ref); ok {
+				values := compileRange(ref)
+				args[i] = func(ev *evaluation) ([]Value, error) {
+					v, err := values(ev)
+					if err != nil {
+						return nil, err
+					}
+					return fn.rangeValues(v), nil
+				}
+				continue
+			}
+		}
+		eval, err := compileArgument(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = func(ev *evaluation) ([]Value, error) {
+			v, err := eval(ev)
+			if err != nil {
+				return nil, err
+			}
+			switch v := v.(type) {
+			case cellRange:
+				values, err := ev.resolveRange(v)
+				if err != nil {
+					return nil, newDiagnostic(arg, err)
+				}
+				return fn.rangeValues(values), nil
+			case Array:
+				return fn.rangeValues(slices.Clone(v.values)), nil
+			}
+			return []Value{v}, nil
+		}
+	}
+	return func(ev *evaluation) (Value, error) {
+		values := make([]Value, 0, len(args))
+		for _, arg := range args {
+			v, err := arg(ev)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+		if !fn.blanks {
+			for i, v := range values {
+				values[i] = zeroIfBlank(v)
+			}
+		}
+		result, err := fn.call(values)
+		if err == nil {
+			result, err = ev.numeric.normalize(result)
+		}
+		if err != nil {
+			return nil, newDiagnostic(e, fmt.Errorf("%s: %w", name, err))
+		}
+		return result, nil
+	}, nil
+}
+
+// rangeValues removes the text and booleans from the values of a range or
+// an array passed to a function that ignores them.
+func (fn function) rangeValues(values []Value) []Value {
+	if !fn.ignoreText {
+		return values
+	}
+	return skipText(values)
+}
+
+func skipText(values []Value) []Value {
+	return slices.DeleteFunc(values, func(v Value) bool {
+		return isText(v) || isBool(v)
+	})
+}
+
+func isNumber(v Value) bool {
+	_, ok := asNumber(v)
+	return ok
+}
+
+// asNumber returns v when it is a number.
+func asNumber(v Value) (constant.Value, bool) {
+	c, ok := v.(constant.Value)
+	if !ok {
+		return nil, false
+	}
+	switch c.Kind() {
+	case constant.Int, constant.Float:
+		return c, true
+	default:
+		return nil, false
+	}
+}
+
+// numbers checks that every argument is a number.
+func numbers(args []Value) ([]constant.Value, error) {
+	result := make([]constant.Value, len(args))
+	for i, arg := range args {
+		if !isNumber(arg) {
+			return nil, fmt.Errorf("argument %d is %s, not a number", i+1, exactString(arg))
+		}
+		result[i] = arg.(constant.Value)
+	}
+	return result, nil
+}
+
+// exactString is ExactString for constants and String for other values.
+func exactString(v Value) string {
+	if c, ok := v.(constant.Value); ok {
+		return c.ExactString()
+	}
+	return v.String()
+}
+
+// sum adds numbers, or quantities of the same dimension.
+func sum(args []Value) (Value, error) {
+	if slices.ContainsFunc(args, isQuantity) {
+		var total Value
+		for i, arg := range args {
+			if !isNumber(arg) && !isQuantity(arg) {
+				return nil, fmt.Errorf("argument %d is %s, not a number", i+1, exactString(arg))
+			}
+			if i == 0 {
+				total = arg
+				continue
+			}
+			var err error
+			if total, err = binaryOp(total, token.ADD, arg); err != nil {
+				return nil, err
+			}
+		}
+		return total, nil
+	}
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	return sumOf(nums), nil
+}
+
+func sumOf(nums []constant.Value) constant.Value {
+	total := constant.MakeInt64(0)
+	for _, n := range nums {
+		total = constant.BinaryOp(total, token.ADD, n)
+	}
+	return total
+}
+
+// average skips blank cells. The average of quantities is a quantity.
+func average(args []Value) (Value, error) {
+	args = skipBlanks(args)
+	if len(args) == 0 {
+		return nil, ErrDivisionByZero
+	}
+	total, err := sum(args)
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp(total, token.QUO, constant.MakeInt64(int64(len(args))))
+}
+
+// extreme returns the largest or smallest argument. The arguments must all
+// be numbers, all be times or all be durations. Blank cells are skipped and
+// the result is zero when every cell is blank.
+func extreme(op token.Token) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		args = skipBlanks(args)
+		if len(args) == 0 {
+			return constant.MakeInt64(0), nil
+		}
+		result := args[0]
+		for i, arg := range args {
+			if !isNumber(arg) && !isTemporal(arg) {
+				return nil, fmt.Errorf("argument %d is %s, not a number", i+1, exactString(arg))
+			}
+			if i == 0 {
+				continue
+			}
+			found, err := binaryOp(arg, op, result)
+			if err != nil {
+				return nil, err
+			}
+			if constant.BoolVal(found.(constant.Value)) {
+				result = arg
+			}
+		}
+		return result, nil
+	}
+}
+
+func abs(args []Value) (Value, error) {
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	if constant.Sign(nums[0]) < 0 {
+		return constant.UnaryOp(token.SUB, nums[0], 0), nil
+	}
+	return nums[0], nil
+}
+
+// rounding returns a function that rounds its first argument to the number
+// of digits after the decimal point given by the optional second argument.
+// Negative digits round to tens, hundreds and so on.
+func rounding(mode Rounding) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		nums, err := numbers(args)
+		if err != nil {
+			return nil, err
+		}
+		digits := int64(0)
+		if len(nums) > 1 {
+			var ok bool
+			digits, ok = integer(nums[1])
+			if !ok || digits < -maxRoundingDigits || digits > maxRoundingDigits {
+				return nil, fmt.Errorf("digits must be an integer between %d and %d, got %s", -maxRoundingDigits, maxRoundingDigits, nums[1].String())
+			}
+		}
+		return round(nums[0], int(digits), mode), nil
+	}
+}
+
+// integer returns the value of a number that is a whole int64.
+func integer(v constant.Value) (int64, bool) {
+	n := constant.ToInt(v)
+	if n.Kind() != constant.Int {
+		return 0, false
+	}
+	return constant.Int64Val(n)
+}
+
+const maxRoundingDigits = 100
+
+const maxExactExponent = 1024
+
+// power is exact for small integer exponents and uses float64 otherwise.
+// Quantities may be raised to whole number powers.
+func power(args []Value) (Value, error) {
+	if q, ok := args[0].(Quantity); ok {
+		return powerQuantity(q, args[1])
+	}
+	nums, err := numbers(args)
+	if err != nil {
+		return nil, err
+	}
+	base, exponent := nums[0], nums[1]
+	if n, ok := integer(exponent); ok && -maxExactExponent <= n && n <= maxExactExponent {
+		if n < 0 && constant.Sign(base) == 0 {
+			return nil, errors.New("zero cannot be raised to a negative power")
+		}
+		result := constant.MakeInt64(1)
+		for square, e := base, max(n, -n); e > 0; e >>= 1 {
+			if e&1 == 1 {
+				result = constant.BinaryOp(result, token.MUL, square)
+			}
+			square = constant.BinaryOp(square, token.MUL, square)
+		}
+		if n < 0 {
+			result = constant.BinaryOp(constant.MakeInt64(1), token.QUO, result)
+		}
+		return result, nil
+	}
+	b, _ := constant.Float64Val(base)
+	x, _ := constant.Float64Val(exponent)
+	result := constant.MakeFloat64(math.Pow(b, x))
+	if result.Kind() == constant.Unknown {
+		return nil, fmt.Errorf("%s ^ %s is not a real number", base.String(), exponent.String())
+	}
+	return result, nil
+}
+
+// concat joins the text of its arguments. Strings are used without quotes.
+func concat(args []Value) (Value, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(text(arg))
+	}
+	return constant.MakeString(sb.String()), nil
+}
+
+func text(v Value) string {
+	c, ok := v.(constant.Value)
+	switch {
+	case !ok:
+		return v.String()
+	case c.Kind() == constant.String:
+		return constant.StringVal(c)
+	case c.Kind() == constant.Bool:
+		return strings.ToUpper(c.String())
+	default:
+		return c.String()
+	}
+}
+
+func compileIf(args []evalFunc) evalFunc {
+	return func(ev *evaluation) (Value, error) {
+		condition, err := args[0](ev)
+		if err != nil {
+			return nil, err
+		}
+		if !isBool(condition) {
+			return nil, fmt.Errorf("IF: condition is %s, not a boolean", exactString(condition))
+		}
+		switch {
+		case constant.BoolVal(condition.(constant.Value)):
+			return args[1](ev)
+		case len(args) > 2:
+			return args[2](ev)
+		default:
+			return constant.MakeBool(false), nil
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package expression_test
+
+import (
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestFunctions(t *testing.T) {
+	scope := fakeScopeFunc(func(s string) (constant.Value, error) {
+		switch s {
+		case "A0":
+			return constant.MakeInt64(-4), nil
+		case "A1":
+			return constant.MakeInt64(10), nil
+		case "A2":
+			return constant.MakeBool(true), nil
+		default:
+			t.Fatalf("unexpected reference %s", s)
+			return nil, nil
+		}
+	})
+
+	for _, tt := range []struct {
+		Expression string
+		Result     string
+		Error      string
+	}{
+		{Expression: "SUM(1, 2, A1)", Result: "13"},
+		{Expression: "sum(A0)", Result: "-4"},
+		{Expression: "AVERAGE(1, 2)", Result: "1.5"},
+		{Expression: "MIN(A1, A0, 3)", Result: "-4"},
+		{Expression: "MAX(A1, A0, 3)", Result: "10"},
+		{Expression: "ABS(A0)", Result: "4"},
+		{Expression: "IF(A2, A1, B0)", Result: "10"},
+		{Expression: "IF(!A2, B0, A0)", Result: "-4"},
+		{Expression: "IF(!A2, B0)", Result: "false"},
+		{Expression: "POWER(2, 10)", Result: "1024"},
+		{Expression: "POWER(2, -2)", Result: "0.25"},
+		{Expression: "POWER(2, -9223372036854775808)", Result: "0"},
+		{Expression: "SUM(1, A2)", Error: "SUM: argument 2 is true, not a number"},
+		{Expression: "IF(1, 2, 3)", Error: "IF: condition is 1, not a boolean"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.New(tt.Expression)
+			require.NoError(t, err)
+
+			v, err := expression.Evaluate(scope, node)
+			if tt.Error != "" {
+				assert.EqualError(t, err, tt.Error)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
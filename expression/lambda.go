@@ -0,0 +1,273 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"slices"
+	"strings"
+)
+
+// maxCallDepth limits how deeply LAMBDA functions may call each other so a
+// recursive function without a base case fails instead of running forever.
+const maxCallDepth = 256
+
+// FunctionScope is implemented by scopes that define functions, such as a
+// table with named LAMBDA functions. Calls to names that are not built-in
+// functions or bound by LET are passed to Function.
+type FunctionScope interface {
+	Function(name string) (Lambda, bool)
+}
+
+// Lambda is a function created by LAMBDA, or by a function literal in the Go
+// dialect. Calling it evaluates its calculation with the parameters bound to
+// the arguments. It keeps the names bound by LET where it was created.
+type Lambda struct {
+	params   []string
+	body     evalFunc
+	bindings *binding
+}
+
+func (l Lambda) String() string {
+	return "LAMBDA(" + strings.Join(l.params, ", ") + ")"
+}
+
+func (l Lambda) call(ev *evaluation, args []Value) (Value, error) {
+	if ev.depth >= maxCallDepth {
+		return nil, fmt.Errorf("calls are nested more than %d deep", maxCallDepth)
+	}
+	scope := *ev
+	scope.depth++
+	scope.bindings = l.bindings
+	for i, name := range l.params {
+		scope.bindings = &binding{name: name, value: args[i], outer: scope.bindings}
+	}
+	return l.body(&scope)
+}
+
+// binding is a name bound by LET or a parameter of a LAMBDA. Bindings form a
+// chain from the innermost to the outermost and hide the names of the scope.
+type binding struct {
+	name  string
+	value Value
+	outer *binding
+}
+
+func (b *binding) lookup(name string) (Value, bool) {
+	for ; b != nil; b = b.outer {
+		if b.name == name {
+			return b.value, true
+		}
+	}
+	return nil, false
+}
+
+// let evaluates the calculation with each name bound to the value after it:
+// LET(name, value, [name, value, ...], calculation). A value may use the
+// names bound before it.
+func let(names []string, args []evalFunc) evalFunc {
+	values, body := args[:len(args)-1], args[len(args)-1]
+	return func(ev *evaluation) (Value, error) {
+		scope := *ev
+		for i, value := range values {
+			v, err := value(&scope)
+			if err != nil {
+				return nil, err
+			}
+			scope.bindings = &binding{name: names[i], value: v, outer: scope.bindings}
+		}
+		return body(&scope)
+	}
+}
+
+func letNames(n int) ([]int, error) {
+	if n%2 == 0 {
+		return nil, errors.New("LET expects a name and a value for each binding followed by a calculation")
+	}
+	positions := make([]int, 0, n/2)
+	for i := 0; i < n-1; i += 2 {
+		positions = append(positions, i)
+	}
+	return positions, nil
+}
+
+// lambda creates a function: LAMBDA([parameter, ...], calculation).
+func lambda(names []string, args []evalFunc) evalFunc {
+	body := args[0]
+	return func(ev *evaluation) (Value, error) {
+		return Lambda{params: names, body: body, bindings: ev.bindings}, nil
+	}
+}
+
+func lambdaNames(n int) ([]int, error) {
+	positions := make([]int, n-1)
+	for i := range positions {
+		positions[i] = i
+	}
+	return positions, nil
+}
+
+// bindingNames returns the names bound by a call to LET or LAMBDA and the
+// arguments that are expressions.
+func bindingNames(e *ast.CallExpr, fn function) ([]string, []ast.Expr, *Diagnostic) {
+	positions, err := fn.names(len(e.Args))
+	if err != nil {
+		return nil, nil, newDiagnostic(e, err)
+	}
+	var names []string
+	var exprs []ast.Expr
+	for i, arg := range e.Args {
+		if !slices.Contains(positions, i) {
+			exprs = append(exprs, arg)
+			continue
+		}
+		name, d := bindingName(arg, names)
+		if d != nil {
+			return nil, nil, d
+		}
+		names = append(names, name)
+	}
+	return names, exprs, nil
+}
+
+// bindingName checks that a name can be bound and is not already in names.
+func bindingName(arg ast.Expr, names []string) (string, *Diagnostic) {
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		return "", newDiagnostic(arg, errors.New("expected a name"))
+	}
+	if _, _, ok := parseCellName(ident.Name); ok || ident.Name == "true" || ident.Name == "false" {
+		return "", newDiagnostic(arg, fmt.Errorf("%s is not a name that can be bound", ident.Name))
+	}
+	if slices.Contains(names, ident.Name) {
+		return "", newDiagnostic(arg, fmt.Errorf("%s is bound more than once", ident.Name))
+	}
+	return ident.Name, nil
+}
+
+// funcLitLambda returns the parameters and the calculation of a function
+// literal. Like the calculation of a LAMBDA the body must be a single return
+// statement. The types of the parameters and the result are ignored.
+func funcLitLambda(e *ast.FuncLit) ([]string, ast.Expr, *Diagnostic) {
+	var names []string
+	for _, field := range e.Type.Params.List {
+		for _, ident := range field.Names {
+			name, d := bindingName(ident, names)
+			if d != nil {
+				return nil, nil, d
+			}
+			names = append(names, name)
+		}
+	}
+	if len(e.Body.List) == 1 {
+		if ret, ok := e.Body.List[0].(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+			return names, ret.Results[0], nil
+		}
+	}
+	return nil, nil, newDiagnostic(e.Body, errors.New("a function body must be a single return statement"))
+}
+
+func compileFuncLit(e *ast.FuncLit) (evalFunc, error) {
+	names, body, d := funcLitLambda(e)
+	if d != nil {
+		return nil, d
+	}
+	eval, err := compile(body)
+	if err != nil {
+		return nil, err
+	}
+	return lambda(names, []evalFunc{eval}), nil
+}
+
+// IsBuiltin reports whether name is a built-in function. Function names are
+// not case-sensitive.
+func IsBuiltin(name string) bool {
+	_, ok := functions[strings.ToUpper(name)]
+	return ok
+}
+
+// IsLambda reports whether expr evaluates to a Lambda: a call to LAMBDA or a
+// function literal.
+func IsLambda(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return IsLambda(e.X)
+	case *ast.FuncLit:
+		return true
+	case *ast.CallExpr:
+		ident, ok := e.Fun.(*ast.Ident)
+		return ok && strings.ToUpper(ident.Name) == "LAMBDA"
+	}
+	return false
+}
+
+// calledBuiltin reports whether e calls a built-in function. Other calls are
+// to a Lambda.
+func calledBuiltin(e *ast.CallExpr) bool {
+	ident, ok := e.Fun.(*ast.Ident)
+	return ok && IsBuiltin(ident.Name)
+}
+
+// compileLambdaCall calls the Lambda that the callee evaluates to. A name
+// is looked up in the names bound by LET and then in the functions of the
+// scope. Errors from functions of the scope are given the span of the call
+// since their source is not the expression being evaluated.
+func compileLambdaCall(e *ast.CallExpr) (evalFunc, error) {
+	args := make([]evalFunc, len(e.Args))
+	for i, arg := range e.Args {
+		var err error
+		args[i], err = compile(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	name := "LAMBDA"
+	var callee func(ev *evaluation) (Value, bool, error)
+	if ident, ok := e.Fun.(*ast.Ident); ok {
+		name = ident.Name
+		callee = func(ev *evaluation) (Value, bool, error) {
+			if v, ok := ev.bindings.lookup(name); ok {
+				return v, false, nil
+			}
+			if functions, ok := ev.scope.(FunctionScope); ok {
+				if l, ok := functions.Function(name); ok {
+					return l, true, nil
+				}
+			}
+			return nil, false, newDiagnostic(ident, fmt.Errorf("unknown function %s", name))
+		}
+	} else {
+		fun, err := compile(e.Fun)
+		if err != nil {
+			return nil, err
+		}
+		callee = func(ev *evaluation) (Value, bool, error) {
+			v, err := fun(ev)
+			return v, false, err
+		}
+	}
+	return func(ev *evaluation) (Value, error) {
+		v, external, err := callee(ev)
+		if err != nil {
+			return nil, err
+		}
+		l, ok := v.(Lambda)
+		if !ok {
+			return nil, newDiagnostic(e.Fun, fmt.Errorf("%s is not a function", describe(v)))
+		}
+		if len(args) != len(l.params) {
+			return nil, newDiagnostic(e, fmt.Errorf("%s expects %d %s, got %d", name, len(l.params), plural(len(l.params), "argument"), len(args)))
+		}
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			if values[i], err = arg(ev); err != nil {
+				return nil, err
+			}
+		}
+		result, err := l.call(ev, values)
+		if err != nil && external {
+			return nil, newDiagnostic(e, err)
+		}
+		return result, at(e, err)
+	}, nil
+}
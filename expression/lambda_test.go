@@ -0,0 +1,124 @@
+package expression_test
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// definitions is the fruit table with functions defined by formulas.
+type definitions struct {
+	fakeLookup
+	functions map[string]string
+}
+
+func (d definitions) Function(name string) (expression.Lambda, bool) {
+	source, ok := d.functions[strings.ToUpper(name)]
+	if !ok {
+		return expression.Lambda{}, false
+	}
+	node, err := expression.FormulaDialect.Parse(source)
+	if err != nil {
+		return expression.Lambda{}, false
+	}
+	v, err := expression.Evaluate(d, node)
+	l, ok := v.(expression.Lambda)
+	return l, ok && err == nil
+}
+
+func withFunctions() definitions {
+	return definitions{
+		fakeLookup: fruit(),
+		functions: map[string]string{
+			"DOUBLE":    "=LAMBDA(x, x * 2)",
+			"FACT":      "=LAMBDA(n, IF(n <= 1, 1, n * FACT(n - 1)))",
+			"FOREVER":   "=LAMBDA(n, FOREVER(n + 1))",
+			"SUMSQ":     "=LAMBDA(a, b, a^2 + b^2)",
+			"QUANTITY":  "=LAMBDA(row, B0 * 0 + INDEX(B0:B4, row))",
+			"UNDEFINED": "=LAMBDA(x, x + y)",
+		},
+	}
+}
+
+func TestLambda(t *testing.T) {
+	scope := withFunctions()
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "let", Expression: "=LET(x, 2, y, x * 10, x + y)", Result: "22"},
+		{Name: "let shadows", Expression: "=LET(x, 1, LET(x, x + 1, x))", Result: "2"},
+		{Name: "let range", Expression: "=LET(q, B0:B4, SUM(q * q))", Result: "112"},
+		{Name: "let text", Expression: `=LET(name, A1, UPPER(name))`, Result: `"APPLE"`},
+		{Name: "immediate call", Expression: "=LAMBDA(x, x * 2)(21)", Result: "42"},
+		{Name: "bound lambda", Expression: "=LET(f, LAMBDA(x, y, x - y), f(10, 3))", Result: "7"},
+		{Name: "closure", Expression: "=LET(n, 5, add, LAMBDA(x, x + n), LET(n, 100, add(1)))", Result: "6"},
+		{Name: "named", Expression: "=DOUBLE(B1)", Result: "14"},
+		{Name: "two parameters", Expression: "=SUMSQ(3, 4)", Result: "25"},
+		{Name: "named case", Expression: "=double(2)", Result: "4"},
+		{Name: "recursion", Expression: "=FACT(10)", Result: "3628800"},
+		{Name: "named with cells", Expression: "=QUANTITY(3)", Result: "7"},
+		{Name: "array argument", Expression: "=SUM(DOUBLE(B0:B1))", Result: "20"},
+		{Name: "lambda value", Expression: "=LAMBDA(a, b, a)", Result: "LAMBDA(a, b)"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestLambda_errors(t *testing.T) {
+	scope := withFunctions()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+		Span       string
+	}{
+		{Expression: "=LET(x, 1, y, 2)", Error: "LET expects a name and a value for each binding followed by a calculation", Span: "LET(x, 1, y, 2)"},
+		{Expression: "=LET(A1, 1, A1)", Error: "A1 is not a name that can be bound", Span: "A1"},
+		{Expression: "=LAMBDA(x, x, 1)", Error: "x is bound more than once", Span: "x"},
+		{Expression: "=LAMBDA(1 + 1, 2)", Error: "expected a name", Span: "1 + 1"},
+		{Expression: "=NOPE(1)", Error: "unknown function NOPE", Span: "NOPE"},
+		{Expression: "=LET(x, 1, x(2))", Error: "1 (number) is not a function", Span: "x"},
+		{Expression: "=SUMSQ(3)", Error: "SUMSQ expects 2 arguments, got 1", Span: "SUMSQ(3)"},
+		{Expression: "=LAMBDA(x, x)()", Error: "LAMBDA expects 1 argument, got 0", Span: "LAMBDA(x, x)()"},
+		{Expression: "=1 + FOREVER(1)", Error: "calls are nested more than 256 deep", Span: "FOREVER(1)"},
+		{Expression: "=UNDEFINED(1)", Error: "unexpected name y", Span: "UNDEFINED(1)"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+			var d *expression.Diagnostic
+			require.ErrorAs(t, err, &d)
+			assert.Equal(t, tt.Span, tt.Expression[d.Start:d.End])
+		})
+	}
+}
+
+func TestLambda_format(t *testing.T) {
+	node, err := expression.FormulaDialect.Parse("=LAMBDA(x,x*2)(21)")
+	require.NoError(t, err)
+	s, err := expression.FormulaDialect.Format(node)
+	require.NoError(t, err)
+	assert.Equal(t, "=LAMBDA(x, x * 2)(21)", s)
+
+	refs := expression.References(node)
+	require.Len(t, refs, 3)
+	assert.Equal(t, expression.DynamicReference, refs[0].Kind)
+	assert.Equal(t, "LAMBDA", refs[0].Name)
+	assert.True(t, expression.ReturnsArray(node))
+	assert.True(t, expression.IsLambda(node.(*ast.CallExpr).Fun))
+}
@@ -0,0 +1,521 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// NotFoundError is returned by the lookup functions when no cell matches the
+// key.
+type NotFoundError struct {
+	Key Value
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s was not found", describe(e.Key))
+}
+
+// cellRange is a rectangle of cells. Lookup functions receive their range
+// arguments as cell ranges, and OFFSET, INDEX and INDIRECT return them.
+type cellRange struct {
+	column, row, endColumn, endRow int
+}
+
+func referenceRange(ref Reference) cellRange {
+	return cellRange{column: ref.Column, row: ref.Row, endColumn: ref.EndColumn, endRow: ref.EndRow}
+}
+
+func (r cellRange) String() string {
+	if r.column == r.endColumn && r.row == r.endRow {
+		return CellName(r.column, r.row)
+	}
+	return CellName(r.column, r.row) + ":" + CellName(r.endColumn, r.endRow)
+}
+
+func (r cellRange) columns() int { return r.endColumn - r.column + 1 }
+
+func (r cellRange) rows() int { return r.endRow - r.row + 1 }
+
+// SizeScope is implemented by scopes with a fixed number of columns and rows,
+// such as a table. Ranges that do not fit are errors before any of their
+// cells are resolved.
+type SizeScope interface {
+	Size() (columns, rows int)
+}
+
+// RangeError is returned for a range that does not fit in the columns and
+// rows of a SizeScope.
+type RangeError struct {
+	Range string
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("#REF! %s is outside the table", e.Range)
+}
+
+// checkRange returns a RangeError for ranges that do not fit in the scope.
+// Ranges in other scopes are only checked as their cells are resolved.
+func (ev *evaluation) checkRange(r cellRange) error {
+	size, ok := ev.scope.(SizeScope)
+	if !ok {
+		return nil
+	}
+	columns, rows := size.Size()
+	if r.column < 0 || r.row < 0 || r.endColumn >= columns || r.endRow >= rows {
+		return &RangeError{Range: r.String()}
+	}
+	return nil
+}
+
+// resolveRange returns the values of the cells in row-major order.
+func (ev *evaluation) resolveRange(r cellRange) ([]Value, error) {
+	if err := ev.checkRange(r); err != nil {
+		return nil, err
+	}
+	var values []Value
+	for row := r.row; row <= r.endRow; row++ {
+		for column := r.column; column <= r.endColumn; column++ {
+			v, err := ev.ResolveCell(column, row)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// area is a range or an array argument. Functions that read the values of
+// a range, rather than its cells, accept arrays too, such as the results of
+// SORT and FILTER.
+type area struct {
+	r     cellRange
+	array *Array // nil for ranges
+}
+
+func toArea(v Value) (area, bool) {
+	switch v := v.(type) {
+	case cellRange:
+		return area{r: v}, true
+	case Array:
+		return area{array: &v}, true
+	default:
+		return area{}, false
+	}
+}
+
+func (a area) columns() int {
+	if a.array != nil {
+		return a.array.Columns()
+	}
+	return a.r.columns()
+}
+
+func (a area) rows() int {
+	if a.array != nil {
+		return a.array.Rows()
+	}
+	return a.r.rows()
+}
+
+func (a area) String() string {
+	if a.array != nil {
+		return a.array.String()
+	}
+	return a.r.String()
+}
+
+// at returns the value at a zero-based column and row of an area.
+func (ev *evaluation) at(a area, column, row int) (Value, error) {
+	if a.array != nil {
+		return a.array.At(column, row), nil
+	}
+	return ev.ResolveCell(a.r.column+column, a.r.row+row)
+}
+
+// values returns the values of an area in row-major order. Blank cells in
+// ranges are Blank.
+func (ev *evaluation) values(a area) ([]Value, error) {
+	if a.array != nil {
+		return slices.Clone(a.array.values), nil
+	}
+	return ev.resolveRange(a.r)
+}
+
+// cell returns the value at the zero-based position i of an area that is
+// one row or one column.
+func (ev *evaluation) cell(a area, i int) (Value, error) {
+	if a.columns() == 1 {
+		return ev.at(a, 0, i)
+	}
+	return ev.at(a, i, 0)
+}
+
+func compileLookup(e *ast.CallExpr, name string, fn function) (evalFunc, error) {
+	args := make([]evalFunc, len(e.Args))
+	for i, arg := range e.Args {
+		var err error
+		if slices.Contains(fn.ranges, i) {
+			args[i], err = compileReference(arg, !fn.cells)
+		} else {
+			args[i], err = compile(arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(ev *evaluation) (Value, error) {
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			var err error
+			if values[i], err = arg(ev); err != nil {
+				return nil, err
+			}
+		}
+		result, err := fn.lookup(ev, values)
+		if err == nil {
+			result, err = ev.numeric.normalize(zeroIfBlank(result))
+		}
+		if err != nil {
+			return nil, newDiagnostic(e, fmt.Errorf("%s: %w", name, err))
+		}
+		return result, nil
+	}, nil
+}
+
+// compileReference compiles an argument that is passed to a function as a
+// cell range, or as an array when arrays is set.
+func compileReference(expr ast.Expr, arrays bool) (evalFunc, error) {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.BinaryExpr:
+		if ref, ok := rangeReference(e); ok {
+			return constantFunc(referenceRange(ref)), nil
+		}
+	case *ast.Ident:
+		if column, row, ok := parseCellName(e.Name); ok {
+			return constantFunc(cellRange{column: column, row: row, endColumn: column, endRow: row}), nil
+		}
+	case *ast.CallExpr:
+		return compileCall(e)
+	}
+	if !arrays {
+		return func(*evaluation) (Value, error) {
+			return nil, newDiagnostic(expr, errors.New("expected a cell or a range"))
+		}, nil
+	}
+	// Other expressions, such as A0:A9 * 2 or a name bound by LET, may
+	// evaluate to arrays.
+	eval, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(ev *evaluation) (Value, error) {
+		v, err := eval(ev)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(Array); !ok {
+			return nil, newDiagnostic(expr, errors.New("expected a cell, a range or an array"))
+		}
+		return v, nil
+	}, nil
+}
+
+func rangeArg(args []Value, i int) (cellRange, error) {
+	r, ok := args[i].(cellRange)
+	if !ok {
+		return cellRange{}, fmt.Errorf("argument %d is %s, not a range", i+1, exactString(args[i]))
+	}
+	return r, nil
+}
+
+// areaArg returns a range or an array argument.
+func areaArg(args []Value, i int) (area, error) {
+	a, ok := toArea(args[i])
+	if !ok {
+		return area{}, fmt.Errorf("argument %d is %s, not a range or an array", i+1, exactString(args[i]))
+	}
+	return a, nil
+}
+
+// vectorArg returns a range or an array argument that must be one row or
+// one column.
+func vectorArg(args []Value, i int) (area, int, error) {
+	a, err := areaArg(args, i)
+	if err != nil {
+		return area{}, 0, err
+	}
+	switch {
+	case a.columns() == 1:
+		return a, a.rows(), nil
+	case a.rows() == 1:
+		return a, a.columns(), nil
+	default:
+		return area{}, 0, fmt.Errorf("argument %d must be one row or one column, got %s", i+1, a)
+	}
+}
+
+// matchMode selects the cell a lookup returns when no cell equals the key.
+type matchMode int
+
+const (
+	exactMatch  matchMode = 0
+	nextSmaller matchMode = -1 // the largest value less than the key
+	nextLarger  matchMode = 1  // the smallest value greater than the key
+)
+
+// match returns the position of the first of n values equal to key, or of
+// the closest value in the direction of mode. Text is compared without
+// regard to case. Values that cannot be compared with the key are skipped.
+func match(key Value, n int, mode matchMode, value func(i int) (Value, error)) (int, error) {
+	best, bestValue := -1, Value(nil)
+	for i := range n {
+		v, err := value(i)
+		if err != nil {
+			return 0, err
+		}
+		c, ok := compareValues(v, key)
+		switch {
+		case !ok:
+		case c == 0:
+			return i, nil
+		case mode == exactMatch || c != int(mode):
+		case best < 0:
+			best, bestValue = i, v
+		default:
+			if c, _ := compareValues(v, bestValue); c == -int(mode) {
+				best, bestValue = i, v
+			}
+		}
+	}
+	if best < 0 {
+		return 0, &NotFoundError{Key: key}
+	}
+	return best, nil
+}
+
+// compareValues returns -1, 0 or +1 when a is less than, equal to or
+// greater than b. It reports false when the values cannot be compared.
+func compareValues(a, b Value) (int, bool) {
+	if isText(a) != isText(b) || isBool(a) != isBool(b) {
+		return 0, false
+	}
+	if isText(a) {
+		return strings.Compare(strings.ToLower(text(a)), strings.ToLower(text(b))), true
+	}
+	less, err := binaryOp(a, token.LSS, b)
+	if err != nil {
+		return 0, false
+	}
+	if constant.BoolVal(less.(constant.Value)) {
+		return -1, true
+	}
+	if equal, _ := binaryOp(a, token.EQL, b); constant.BoolVal(equal.(constant.Value)) {
+		return 0, true
+	}
+	return 1, true
+}
+
+func matchModeArg(args []Value, i int, modes map[int]matchMode) (matchMode, error) {
+	if len(args) <= i {
+		return exactMatch, nil
+	}
+	n, err := integerArg(args, i)
+	if err != nil {
+		return 0, err
+	}
+	mode, ok := modes[n]
+	if !ok {
+		return 0, fmt.Errorf("match type must be -1, 0 or 1, got %d", n)
+	}
+	return mode, nil
+}
+
+// vlookup finds the key in the first column of a range and returns the value
+// in the same row at the zero-based column. When the fourth argument is true
+// the first column must be sorted and the row with the largest value not
+// greater than the key is used if there is no exact match.
+func vlookup(ev *evaluation, args []Value) (Value, error) {
+	return tableLookup(ev, args, false)
+}
+
+// hlookup is vlookup with rows and columns swapped.
+func hlookup(ev *evaluation, args []Value) (Value, error) {
+	return tableLookup(ev, args, true)
+}
+
+func tableLookup(ev *evaluation, args []Value, horizontal bool) (Value, error) {
+	r, err := areaArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	position, err := integerArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	mode := exactMatch
+	if len(args) > 3 {
+		if !isBool(args[3]) {
+			return nil, fmt.Errorf("argument 4 is %s, not a boolean", exactString(args[3]))
+		}
+		if constant.BoolVal(args[3].(constant.Value)) {
+			mode = nextSmaller
+		}
+	}
+	// at reads the position of the key, counted along the first column, or
+	// the first row, and then the position of the value.
+	at := func(key, value int) (Value, error) { return ev.at(r, value, key) }
+	size, n, unit := r.columns(), r.rows(), "column"
+	if horizontal {
+		at = func(key, value int) (Value, error) { return ev.at(r, key, value) }
+		size, n, unit = r.rows(), r.columns(), "row"
+	}
+	if position < 0 || position >= size {
+		return nil, fmt.Errorf("%d is outside the range %s, which has %d %s", position, r, size, plural(size, unit))
+	}
+	i, err := match(args[0], n, mode, func(i int) (Value, error) { return at(i, 0) })
+	if err != nil {
+		return nil, err
+	}
+	return at(i, position)
+}
+
+// matchPosition returns the zero-based position of the key in a row or
+// column. The match type 1 finds the largest value not greater than the key
+// and -1 the smallest value not less than the key.
+func matchPosition(ev *evaluation, args []Value) (Value, error) {
+	r, n, err := vectorArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := matchModeArg(args, 2, map[int]matchMode{0: exactMatch, 1: nextSmaller, -1: nextLarger})
+	if err != nil {
+		return nil, err
+	}
+	i, err := match(args[0], n, mode, func(i int) (Value, error) { return ev.cell(r, i) })
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(i)), nil
+}
+
+// xlookup finds the key in one row or column and returns the value at the
+// same position of another. The fourth argument is returned when the key is
+// not found and the fifth selects the match like MATCH, where -1 is the next
+// smaller value and 1 the next larger value.
+func xlookup(ev *evaluation, args []Value) (Value, error) {
+	keys, n, err := vectorArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	values, m, err := vectorArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if n != m {
+		return nil, fmt.Errorf("the lookup range %s and the result range %s have different sizes", keys, values)
+	}
+	mode, err := matchModeArg(args, 4, map[int]matchMode{0: exactMatch, -1: nextSmaller, 1: nextLarger})
+	if err != nil {
+		return nil, err
+	}
+	i, err := match(args[0], n, mode, func(i int) (Value, error) { return ev.cell(keys, i) })
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) && len(args) > 3 {
+		return args[3], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ev.cell(values, i)
+}
+
+// index returns the cell at a zero-based row and column of a range. A single
+// position selects a cell of a range that is one row or one column.
+func index(_ *evaluation, args []Value) (Value, error) {
+	r, err := rangeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := integerArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	var row, column int
+	switch {
+	case len(args) > 2:
+		row = i
+		if column, err = integerArg(args, 2); err != nil {
+			return nil, err
+		}
+	case r.rows() == 1:
+		column = i
+	case r.columns() == 1:
+		row = i
+	default:
+		return nil, fmt.Errorf("the range %s needs a row and a column", r)
+	}
+	if row < 0 || row >= r.rows() || column < 0 || column >= r.columns() {
+		return nil, fmt.Errorf("row %d, column %d is outside the range %s", row, column, r)
+	}
+	return cellRange{column: r.column + column, row: r.row + row, endColumn: r.column + column, endRow: r.row + row}, nil
+}
+
+// offsetRange moves a range by rows and columns. The optional height and
+// width default to the size of the range.
+func offsetRange(ev *evaluation, args []Value) (Value, error) {
+	r, err := rangeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := integers(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	height, width := r.rows(), r.columns()
+	if len(n) > 2 {
+		height = n[2]
+	}
+	if len(n) > 3 {
+		width = n[3]
+	}
+	if height < 1 || width < 1 {
+		return nil, fmt.Errorf("height and width must be at least 1, got %d and %d", height, width)
+	}
+	result := cellRange{column: r.column + n[1], row: r.row + n[0]}
+	if result.column < 0 || result.row < 0 {
+		return nil, fmt.Errorf("moving %s by %d rows and %d columns leaves the table", r, n[0], n[1])
+	}
+	result.endColumn, result.endRow = result.column+width-1, result.row+height-1
+	if err := ev.checkRange(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// indirect returns the cell or range named by text such as "B3" or "A0:B2".
+func indirect(ev *evaluation, args []Value) (Value, error) {
+	if !isText(args[0]) {
+		return nil, fmt.Errorf("argument 1 is %s, not text", exactString(args[0]))
+	}
+	s := constant.StringVal(args[0].(constant.Value))
+	from, to, isRange := strings.Cut(strings.ToUpper(strings.TrimSpace(s)), ":")
+	if !isRange {
+		to = from
+	}
+	c0, r0, ok0 := parseCellName(from)
+	c1, r1, ok1 := parseCellName(to)
+	if !ok0 || !ok1 {
+		return nil, fmt.Errorf("%q is not a cell or a range", s)
+	}
+	result := cellRange{column: min(c0, c1), row: min(r0, r1), endColumn: max(c0, c1), endRow: max(r0, r1)}
+	if err := ev.checkRange(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
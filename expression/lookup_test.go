@@ -0,0 +1,158 @@
+package expression_test
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// priceList is a table with a header row:
+//
+//	   A         B       C
+//	0  "item"    "price" "stock"
+//	1  "apple"   1.2     30
+//	2  "banana"  0.5     0
+//	3  "cherry"  4       12
+//
+// and rates in column E from row 0: 0, 10000, 50000 with taxes in F: 0.1,
+// 0.2, 0.4.
+func priceList(resolved map[string]bool) fakeLookup {
+	lookup := cellLookup(map[string]expression.Value{
+		"A0": constant.MakeString("item"), "B0": constant.MakeString("price"), "C0": constant.MakeString("stock"),
+		"A1": constant.MakeString("apple"), "B1": constant.MakeFromLiteral("1.2", token.FLOAT, 0), "C1": constant.MakeInt64(30),
+		"A2": constant.MakeString("banana"), "B2": constant.MakeFromLiteral("0.5", token.FLOAT, 0), "C2": constant.MakeInt64(0),
+		"A3": constant.MakeString("cherry"), "B3": constant.MakeInt64(4), "C3": constant.MakeInt64(12),
+		"E0": constant.MakeInt64(0), "F0": constant.MakeFromLiteral("0.1", token.FLOAT, 0),
+		"E1": constant.MakeInt64(10000), "F1": constant.MakeFromLiteral("0.2", token.FLOAT, 0),
+		"E2": constant.MakeInt64(50000), "F2": constant.MakeFromLiteral("0.4", token.FLOAT, 0),
+	})
+	cell := lookup.resolveCell
+	lookup.resolveCell = func(column, row int) (expression.Value, error) {
+		name := expression.CellName(column, row)
+		if resolved != nil {
+			resolved[name] = true
+		}
+		if row > 9 {
+			return nil, fmt.Errorf("unknown cell %s", name)
+		}
+		return cell(column, row)
+	}
+	return lookup
+}
+
+func TestLookupFunctions(t *testing.T) {
+	scope := priceList(nil)
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "vlookup", Expression: `=VLOOKUP("banana", A1:C3, 1)`, Result: "0.5"},
+		{Name: "vlookup ignores case", Expression: `=VLOOKUP("Cherry", A1:C3, 2)`, Result: "12"},
+		{Name: "vlookup key column", Expression: `=VLOOKUP("apple", A1:C3, 0)`, Result: `"apple"`},
+		{Name: "vlookup approximate", Expression: `=VLOOKUP(25000, E0:F2, 1, true)`, Result: "0.2"},
+		{Name: "vlookup approximate exact", Expression: `=VLOOKUP(50000, E0:F2, 1, true)`, Result: "0.4"},
+		{Name: "hlookup", Expression: `=HLOOKUP("stock", A0:C3, 3)`, Result: "12"},
+		{Name: "match", Expression: `=MATCH("cherry", A0:A3)`, Result: "3"},
+		{Name: "match row", Expression: `=MATCH("price", A0:C0)`, Result: "1"},
+		{Name: "match next smaller", Expression: `=MATCH(9999, E0:E2, 1)`, Result: "0"},
+		{Name: "match next larger", Expression: `=MATCH(9999, E0:E2, -1)`, Result: "1"},
+		{Name: "index", Expression: `=INDEX(A0:C3, 2, 1)`, Result: "0.5"},
+		{Name: "index of a column", Expression: `=INDEX(A0:A3, 1)`, Result: `"apple"`},
+		{Name: "index of a row", Expression: `=INDEX(A0:C0, 2)`, Result: `"stock"`},
+		{Name: "index and match", Expression: `=INDEX(B0:B3, MATCH("cherry", A0:A3)) * 2`, Result: "8"},
+		{Name: "xlookup", Expression: `=XLOOKUP("banana", A1:A3, C1:C3)`, Result: "0"},
+		{Name: "xlookup not found", Expression: `=XLOOKUP("kiwi", A1:A3, C1:C3, "none")`, Result: `"none"`},
+		{Name: "xlookup next larger", Expression: `=XLOOKUP(2, B1:B3, A1:A3, "none", 1)`, Result: `"cherry"`},
+		{Name: "xlookup next smaller", Expression: `=XLOOKUP(1, B1:B3, A1:A3, "none", -1)`, Result: `"banana"`},
+		{Name: "xlookup across", Expression: `=XLOOKUP("price", A0:C0, A3:C3)`, Result: "4"},
+		{Name: "offset", Expression: `=OFFSET(A0, 3, 1)`, Result: "4"},
+		{Name: "offset range", Expression: `=SUM(OFFSET(B0, 1, 0, 3, 1))`, Result: "5.7"},
+		{Name: "offset keeps the size", Expression: `=SUM(OFFSET(B0:C0, 3, 0))`, Result: "16"},
+		{Name: "offset array", Expression: `=OFFSET(A0, 1, 2, 2) + 1`, Result: "{31; 1}"},
+		{Name: "indirect", Expression: `=INDIRECT("b3") + 1`, Result: "5"},
+		{Name: "indirect built from text", Expression: `=INDIRECT(CONCAT("C", 1))`, Result: "30"},
+		{Name: "indirect range", Expression: `=SUM(INDIRECT("C1:C3"))`, Result: "42"},
+		{Name: "lookup in a lookup", Expression: `=VLOOKUP(INDEX(A0:A3, 3), OFFSET(A0:C3, 1, 0, 3), 1)`, Result: "4"},
+		{Name: "without spaces", Expression: `=VLOOKUP("apple",A1:C3,1)*C1`, Result: "36"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestLookupFunctions_errors(t *testing.T) {
+	scope := priceList(nil)
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: `=VLOOKUP("kiwi", A1:C3, 1)`, Error: `VLOOKUP: "kiwi" (text) was not found`},
+		{Expression: `=VLOOKUP(-1, E0:F2, 1, true)`, Error: `VLOOKUP: -1 (number) was not found`},
+		{Expression: `=VLOOKUP("apple", A1:C3, 3)`, Error: "VLOOKUP: 3 is outside the range A1:C3, which has 3 columns"},
+		{Expression: `=VLOOKUP("apple", A1:C3, 1, 1)`, Error: "VLOOKUP: argument 4 is 1, not a boolean"},
+		{Expression: `=VLOOKUP("apple", 5, 1)`, Error: "expected a cell, a range or an array"},
+		{Expression: `=MATCH(1, A0:C3)`, Error: "MATCH: argument 2 must be one row or one column, got A0:C3"},
+		{Expression: `=MATCH(1, E0:E2, 2)`, Error: "MATCH: match type must be -1, 0 or 1, got 2"},
+		{Expression: `=XLOOKUP("apple", A1:A3, C1:C2)`, Error: "XLOOKUP: the lookup range A1:A3 and the result range C1:C2 have different sizes"},
+		{Expression: `=INDEX(A0:C3, 4, 0)`, Error: "INDEX: row 4, column 0 is outside the range A0:C3"},
+		{Expression: `=INDEX(A0:C3, 1)`, Error: "INDEX: the range A0:C3 needs a row and a column"},
+		{Expression: `=OFFSET(A0, -1, 0)`, Error: "OFFSET: moving A0 by -1 rows and 0 columns leaves the table"},
+		{Expression: `=OFFSET(A0, 0, 0, 0)`, Error: "OFFSET: height and width must be at least 1, got 0 and 1"},
+		{Expression: `=INDIRECT("total")`, Error: `INDIRECT: "total" is not a cell or a range`},
+		{Expression: `=INDIRECT("A10")`, Error: "unknown cell A10"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+
+	t.Run("not found is typed", func(t *testing.T) {
+		node, err := expression.FormulaDialect.Parse(`=MATCH("kiwi", A0:A3)`)
+		require.NoError(t, err)
+		_, err = expression.Evaluate(scope, node)
+		var notFound *expression.NotFoundError
+		require.True(t, errors.As(err, &notFound))
+		assert.Equal(t, constant.MakeString("kiwi"), notFound.Key)
+	})
+}
+
+func TestLookupFunctions_resolveOnlyWhatTheyNeed(t *testing.T) {
+	resolved := make(map[string]bool)
+	node, err := expression.FormulaDialect.Parse(`=VLOOKUP("apple", A0:C3, 2)`)
+	require.NoError(t, err)
+	_, err = expression.Evaluate(priceList(resolved), node)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"A0": true, "A1": true, "C1": true}, resolved)
+}
+
+func TestReferences_dynamic(t *testing.T) {
+	node, err := expression.New(`SUM(OFFSET(A0, B0, 0)) + indirect("C1")`)
+	require.NoError(t, err)
+	var dynamic []expression.Reference
+	for _, ref := range expression.References(node) {
+		if ref.Kind == expression.DynamicReference {
+			dynamic = append(dynamic, ref)
+		}
+	}
+	assert.Equal(t, []expression.Reference{
+		{Kind: expression.DynamicReference, Name: "OFFSET", Start: 4, End: 21},
+		{Kind: expression.DynamicReference, Name: "INDIRECT", Start: 25, End: 39},
+	}, dynamic)
+}
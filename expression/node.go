@@ -16,11 +16,16 @@ type Scope interface {
 	Resolve(string) (constant.Value, error)
 }
 
+// New parses an expression. Syntax errors are returned as a *Diagnostic.
 func New(in string) (ast.Expr, error) {
 	if in == "" {
 		return nil, nil
 	}
-	return parser.ParseExpr(in)
+	expr, err := parser.ParseExpr(in)
+	if err != nil {
+		return nil, parseError(in, err)
+	}
+	return expr, nil
 }
 
 func String(expr ast.Expr) (string, error) {
@@ -33,54 +38,16 @@ func String(expr ast.Expr) (string, error) {
 	return buf.String(), err
 }
 
-func Evaluate(scope Scope, expr ast.Expr) (_ constant.Value, err error) {
-	switch e := expr.(type) {
-	case *ast.BasicLit:
-		cv := constant.MakeFromLiteral(e.Value, e.Kind, 0)
-		return cv, nil
-	case *ast.UnaryExpr:
-		v, err := Evaluate(scope, e.X)
-		if err != nil {
-			return nil, err
-		}
-		return constant.UnaryOp(e.Op, v, 0), nil
-	case *ast.BinaryExpr:
-		leftValue, err := Evaluate(scope, e.X)
-		if err != nil {
-			return nil, err
-		}
-		if leftValue.Kind() == constant.Bool {
-			left := constant.BoolVal(leftValue)
-			switch e.Op.String() {
-			case "&&":
-				if !left {
-					return constant.MakeBool(false), nil
-				}
-			case "||":
-				if left {
-					return constant.MakeBool(true), nil
-				}
-			}
-		}
-		rightValue, err := Evaluate(scope, e.Y)
-		if err != nil {
-			return nil, err
-		}
-		return constant.BinaryOp(leftValue, e.Op, rightValue), nil
-	case *ast.ParenExpr:
-		return Evaluate(scope, e.X)
-	case *ast.Ident:
-		switch e.Name {
-		case "true":
-			return constant.MakeBool(true), nil
-		case "false":
-			return constant.MakeBool(false), nil
-		default:
-			return scope.Resolve(e.Name)
-		}
-	default:
-		return nil, &UnsupportedError{Expr: expr}
+// Evaluate compiles and runs expr. Use Compile to evaluate an expression
+// more than once. The result is a Value rather than a constant.Value since
+// expressions may also evaluate to times, durations, quantities and arrays;
+// numbers, text and booleans are still constant.Value.
+func Evaluate(scope Scope, expr ast.Expr) (Value, error) {
+	program, err := Compile(expr)
+	if err != nil {
+		return nil, err
 	}
+	return program.Evaluate(scope)
 }
 
 type UnsupportedError struct {
@@ -1,7 +1,6 @@
 package expression_test
 
 import (
-	"errors"
 	"fmt"
 	"go/constant"
 	"strconv"
@@ -351,11 +350,17 @@ func TestEvaluate(t *testing.T) {
 			}
 		})
 
-		_, err = expression.Evaluate(scope, node)
+		v, err := expression.Evaluate(scope, node)
+		require.NoError(t, err)
+		assert.Equal(t, "11", v.String())
+	})
+
+	t.Run("inline function with statements", func(t *testing.T) {
+		node, err := expression.New("func() int { x := 1; return x }()")
+		require.NoError(t, err)
 
-		var exprErr *expression.UnsupportedError
-		require.True(t, errors.As(err, &exprErr))
-		require.ErrorContains(t, err, "unsupported expression type: *ast.CallExpr")
+		_, err = expression.Evaluate(fakeScopeFunc(nil), node)
+		require.EqualError(t, err, "a function body must be a single return statement")
 	})
 }
 
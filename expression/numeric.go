@@ -0,0 +1,283 @@
+package expression
+
+import (
+	"fmt"
+	"go/constant"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// NumericMode selects how fractions are represented during evaluation.
+// Integers are exact in every mode.
+type NumericMode int
+
+const (
+	// Exact keeps fractions as exact rationals.
+	Exact NumericMode = iota
+
+	// Float rounds fractions to the nearest float64 after every operation.
+	Float
+
+	// Decimal rounds the result of an expression to Numeric.Scale digits
+	// after the decimal point. Operations within the expression are exact,
+	// so 1/3*3 is 1.00, while values read from other cells are rounded.
+	Decimal
+)
+
+var numericModeNames = []string{"exact", "float", "decimal"}
+
+func (m NumericMode) String() string { return enumString(numericModeNames, int(m), "NumericMode") }
+
+func (m NumericMode) MarshalText() ([]byte, error) {
+	return enumMarshal(numericModeNames, int(m), "numeric mode")
+}
+
+func (m *NumericMode) UnmarshalText(text []byte) error {
+	return enumUnmarshal(numericModeNames, (*int)(m), text, "numeric mode")
+}
+
+// Rounding selects the direction used to round a number that lies between
+// two representable values.
+type Rounding int
+
+const (
+	RoundHalfUp   Rounding = iota // to nearest, ties away from zero
+	RoundHalfEven                 // to nearest, ties to the even digit
+	RoundDown                     // toward zero
+	RoundFloor                    // toward negative infinity
+	RoundCeiling                  // toward positive infinity
+)
+
+var roundingNames = []string{"half-up", "half-even", "down", "floor", "ceiling"}
+
+func (r Rounding) String() string { return enumString(roundingNames, int(r), "Rounding") }
+
+func (r Rounding) MarshalText() ([]byte, error) {
+	return enumMarshal(roundingNames, int(r), "rounding mode")
+}
+
+func (r *Rounding) UnmarshalText(text []byte) error {
+	return enumUnmarshal(roundingNames, (*int)(r), text, "rounding mode")
+}
+
+// MaxScale is the largest Numeric.Scale, the same limit as the digits of
+// ROUND.
+const MaxScale = maxRoundingDigits
+
+// DefaultDisplayDigits is the number of digits after the decimal point shown
+// for fractions in the Exact and Float modes when Numeric.Scale is zero.
+const DefaultDisplayDigits = 10
+
+// Numeric is the number model of a table. The zero value is exact
+// arithmetic.
+type Numeric struct {
+	Mode NumericMode `json:"mode,omitempty"`
+
+	// Scale is the number of digits after the decimal point, at most
+	// MaxScale. In Decimal mode numbers are rounded to and displayed with
+	// exactly Scale digits. In the other modes it limits the digits
+	// displayed.
+	Scale int `json:"scale,omitempty"`
+
+	// Rounding is used by Decimal mode.
+	Rounding Rounding `json:"rounding,omitempty"`
+
+	// Tolerance is the change between iterations at which functions that
+	// are solved iteratively, IRR and RATE, accept a result. Zero uses
+	// DefaultTolerance.
+	Tolerance float64 `json:"tolerance,omitempty"`
+
+	// MaxIterations limits the iterations of IRR and RATE. Zero uses
+	// DefaultMaxIterations.
+	MaxIterations int `json:"maxIterations,omitempty"`
+}
+
+// DefaultTolerance and DefaultMaxIterations are used when the Numeric fields,
+// or those of a table that calculates circular references iteratively, are
+// zero.
+const (
+	DefaultTolerance     = 1e-10
+	DefaultMaxIterations = 100
+)
+
+// NumericScope is implemented by scopes that choose a number model. Programs
+// evaluated with other scopes use exact arithmetic.
+type NumericScope interface {
+	Numeric() Numeric
+}
+
+// normalize converts the result of an operation to the number model. Only
+// Float rounds after every operation; Decimal numbers keep their precision
+// until convert rounds the result of the expression.
+func (n Numeric) normalize(x Value) (Value, error) {
+	if n.Mode != Float {
+		return x, nil
+	}
+	return n.convert(x)
+}
+
+// convert rounds a number to the number model. The elements of arrays and
+// the numbers of quantities are converted and other values are returned
+// unchanged.
+func (n Numeric) convert(x Value) (Value, error) {
+	if n.Mode == Exact {
+		return x, nil
+	}
+	if a, ok := x.(Array); ok {
+		return arrayOp(a, func(x, _ Value) (Value, error) { return n.convert(x) }, nil)
+	}
+	if q, ok := x.(Quantity); ok {
+		v, err := n.convert(q.number)
+		if err != nil {
+			return nil, err
+		}
+		return Quantity{number: v.(constant.Value), unit: q.unit}, nil
+	}
+	v, ok := x.(constant.Value)
+	if !ok || v.Kind() != constant.Float {
+		return x, nil
+	}
+	switch n.Mode {
+	case Float:
+		f, _ := constant.Float64Val(v)
+		if math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%s is too large for a float64", v.String())
+		}
+		return constant.MakeFloat64(f), nil
+	case Decimal:
+		return round(v, n.Scale, n.Rounding), nil
+	default:
+		return v, nil
+	}
+}
+
+// Format returns the decimal text of a number, followed by the unit for a
+// quantity. Other values use their String method.
+func (n Numeric) Format(x Value) string {
+	if q, ok := x.(Quantity); ok {
+		return n.Format(q.number) + " " + q.unit.String()
+	}
+	v, ok := x.(constant.Value)
+	if !ok {
+		return x.String()
+	}
+	switch v.Kind() {
+	case constant.Int:
+		if n.Mode == Decimal && n.Scale > 0 {
+			return v.ExactString() + "." + strings.Repeat("0", n.Scale)
+		}
+		return v.ExactString()
+	case constant.Float:
+		r := Rat(v)
+		if n.Mode == Decimal {
+			return r.FloatString(max(n.Scale, 0))
+		}
+		digits := n.Scale
+		if digits <= 0 {
+			digits = DefaultDisplayDigits
+		}
+		s := Rat(round(v, digits, RoundHalfUp)).FloatString(digits)
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+		if s == "-0" {
+			return "0"
+		}
+		return s
+	default:
+		return v.String()
+	}
+}
+
+// round rounds a number to digits after the decimal point. Negative digits
+// round to the left of the decimal point. The result is an integer when
+// digits is not positive.
+func round(v constant.Value, digits int, mode Rounding) constant.Value {
+	if v.Kind() == constant.Int && digits >= 0 {
+		return v
+	}
+	scaled := Rat(v)
+	exponent := int64(digits)
+	if exponent < 0 {
+		exponent = -exponent
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(exponent), nil)
+	if digits >= 0 {
+		scaled.Mul(scaled, new(big.Rat).SetInt(scale))
+	} else {
+		scaled.Quo(scaled, new(big.Rat).SetInt(scale))
+	}
+	q, m := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		// q is truncated toward zero; decide whether to move it away.
+		twice := new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2))
+		half := twice.Cmp(scaled.Denom())
+		away := false
+		switch mode {
+		case RoundHalfUp:
+			away = half >= 0
+		case RoundHalfEven:
+			away = half > 0 || half == 0 && q.Bit(0) == 1
+		case RoundFloor:
+			away = scaled.Sign() < 0
+		case RoundCeiling:
+			away = scaled.Sign() > 0
+		}
+		if away {
+			q.Add(q, big.NewInt(int64(scaled.Sign())))
+		}
+	}
+	switch {
+	case digits > 0:
+		return constant.Make(new(big.Rat).SetFrac(q, scale))
+	case digits < 0:
+		q.Mul(q, scale)
+	}
+	return constant.Make(q)
+}
+
+// Rat returns a number as a fraction the caller may modify. It returns zero
+// for values that are not numbers.
+func Rat(v constant.Value) *big.Rat {
+	switch x := constant.Val(v).(type) {
+	case int64:
+		return new(big.Rat).SetInt64(x)
+	case *big.Int:
+		return new(big.Rat).SetInt(x)
+	case *big.Rat:
+		return new(big.Rat).Set(x)
+	case *big.Float:
+		r, _ := x.Rat(nil)
+		return r
+	default:
+		return new(big.Rat)
+	}
+}
+
+func enumString(names []string, i int, typeName string) string {
+	if i < 0 || i >= len(names) {
+		return fmt.Sprintf("%s(%d)", typeName, i)
+	}
+	return names[i]
+}
+
+func enumMarshal(names []string, i int, what string) ([]byte, error) {
+	if i < 0 || i >= len(names) {
+		return nil, fmt.Errorf("unknown %s %d", what, i)
+	}
+	return []byte(names[i]), nil
+}
+
+func enumUnmarshal(names []string, i *int, text []byte, what string) error {
+	if len(text) == 0 {
+		*i = 0
+		return nil
+	}
+	for n, name := range names {
+		if name == string(text) {
+			*i = n
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s %q", what, text)
+}
@@ -0,0 +1,112 @@
+package expression_test
+
+import (
+	"go/constant"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+type numericScope struct {
+	fakeScopeFunc
+	numeric expression.Numeric
+}
+
+func (s numericScope) Numeric() expression.Numeric { return s.numeric }
+
+func TestNumeric(t *testing.T) {
+	var (
+		exact    = expression.Numeric{}
+		float    = expression.Numeric{Mode: expression.Float}
+		cents    = expression.Numeric{Mode: expression.Decimal, Scale: 2}
+		even     = expression.Numeric{Mode: expression.Decimal, Scale: 2, Rounding: expression.RoundHalfEven}
+		truncate = expression.Numeric{Mode: expression.Decimal, Scale: 1, Rounding: expression.RoundDown}
+	)
+	for _, tt := range []struct {
+		Name       string
+		Numeric    expression.Numeric
+		Expression string
+		Result     string
+	}{
+		{Name: "exact thirds add up", Numeric: exact, Expression: "1/3 + 1/3 + 1/3", Result: "1"},
+		{Name: "exact repeating fraction", Numeric: exact, Expression: "2/3", Result: "0.6666666667"},
+		{Name: "exact decimal", Numeric: exact, Expression: "0.1 + 0.2", Result: "0.3"},
+		{Name: "exact large", Numeric: exact, Expression: "1e30 / 4", Result: "250000000000000000000000000000"},
+		{Name: "exact display scale", Numeric: expression.Numeric{Scale: 3}, Expression: "2/3", Result: "0.667"},
+		{Name: "float thirds", Numeric: float, Expression: "1/3 + 1/3 + 1/3", Result: "1"},
+		{Name: "float rounding error", Numeric: expression.Numeric{Mode: expression.Float, Scale: 17}, Expression: "0.1 + 0.2", Result: "0.30000000000000004"},
+		{Name: "float integers stay exact", Numeric: float, Expression: "9007199254740993 + 0", Result: "9007199254740993"},
+		{Name: "decimal cents", Numeric: cents, Expression: "10 / 3", Result: "3.33"},
+		{Name: "decimal operations are exact", Numeric: cents, Expression: "10/3 + 10/3 + 10/3", Result: "10.00"},
+		{Name: "decimal thirds", Numeric: cents, Expression: "1/3 * 3", Result: "1.00"},
+		{Name: "decimal small fraction", Numeric: cents, Expression: "0.05/12 * 12", Result: "0.05"},
+		{Name: "decimal integer", Numeric: cents, Expression: "12", Result: "12.00"},
+		{Name: "decimal literal", Numeric: cents, Expression: "1.005 + 0", Result: "1.01"},
+		{Name: "decimal half even", Numeric: even, Expression: "1.005 + 0", Result: "1.00"},
+		{Name: "decimal negative", Numeric: cents, Expression: "-1.005 * 1", Result: "-1.01"},
+		{Name: "decimal round down", Numeric: truncate, Expression: "-2/3", Result: "-0.6"},
+		{Name: "ROUND", Numeric: exact, Expression: "ROUND(2.5)", Result: "3"},
+		{Name: "ROUND negative", Numeric: exact, Expression: "ROUND(-2.5)", Result: "-3"},
+		{Name: "ROUND digits", Numeric: exact, Expression: "ROUND(3.14159, 2)", Result: "3.14"},
+		{Name: "ROUND tens", Numeric: exact, Expression: "ROUND(1234, -2)", Result: "1200"},
+		{Name: "FLOOR", Numeric: exact, Expression: "FLOOR(-2.1)", Result: "-3"},
+		{Name: "FLOOR digits", Numeric: exact, Expression: "FLOOR(2.19, 1)", Result: "2.1"},
+		{Name: "CEIL", Numeric: exact, Expression: "CEIL(2.1)", Result: "3"},
+		{Name: "CEIL tens", Numeric: exact, Expression: "CEIL(1201, -2)", Result: "1300"},
+		{Name: "TRUNC", Numeric: exact, Expression: "TRUNC(-2.9)", Result: "-2"},
+		{Name: "TRUNC integer", Numeric: exact, Expression: "TRUNC(7)", Result: "7"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.New(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(numericScope{numeric: tt.Numeric}, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, tt.Numeric.Format(v))
+		})
+	}
+
+	t.Run("rounding results are integers", func(t *testing.T) {
+		node, err := expression.New("ROUND(2.5)")
+		require.NoError(t, err)
+		v, err := expression.Evaluate(numericScope{}, node)
+		require.NoError(t, err)
+		assert.Equal(t, constant.Int, v.(constant.Value).Kind())
+	})
+
+	t.Run("invalid digits", func(t *testing.T) {
+		node, err := expression.New("ROUND(1, 0.5)")
+		require.NoError(t, err)
+		_, err = expression.Evaluate(numericScope{}, node)
+		assert.EqualError(t, err, "ROUND: digits must be an integer between -100 and 100, got 0.5")
+	})
+}
+
+func TestNumeric_text(t *testing.T) {
+	var mode expression.NumericMode
+	require.NoError(t, mode.UnmarshalText([]byte("decimal")))
+	assert.Equal(t, expression.Decimal, mode)
+	assert.Error(t, mode.UnmarshalText([]byte("binary")))
+
+	var rounding expression.Rounding
+	require.NoError(t, rounding.UnmarshalText([]byte("half-even")))
+	assert.Equal(t, expression.RoundHalfEven, rounding)
+	text, err := expression.RoundCeiling.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "ceiling", string(text))
+}
+
+func TestRat(t *testing.T) {
+	third := constant.BinaryOp(constant.MakeInt64(1), token.QUO, constant.MakeInt64(3))
+	r := expression.Rat(third)
+	assert.Equal(t, "1/3", r.String())
+	r.Neg(r)
+	assert.Equal(t, "1/3", expression.Rat(third).String(), "the fraction is a copy")
+
+	assert.Equal(t, "7/1", expression.Rat(constant.MakeInt64(7)).String())
+	assert.Equal(t, "1/4", expression.Rat(constant.MakeFloat64(0.25)).String())
+	assert.Equal(t, "0/1", expression.Rat(constant.MakeString("a")).String())
+}
@@ -0,0 +1,258 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+)
+
+// ErrDivisionByZero is returned when the divisor of /, % or a function that
+// divides is zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// TypeError is returned when an operator does not support the kinds of its
+// operands. Y is nil for unary operators.
+type TypeError struct {
+	Op   token.Token
+	X, Y Value
+}
+
+func (e *TypeError) Error() string {
+	if e.Y == nil {
+		return fmt.Sprintf("cannot apply %s to %s", e.Op, describe(e.X))
+	}
+	return fmt.Sprintf("cannot apply %s to %s and %s", e.Op, describe(e.X), describe(e.Y))
+}
+
+// unaryOp applies op to x. The sign operators accept numbers, quantities,
+// durations and booleans, which count as 1 and 0, ! accepts booleans and ^, which flips
+// the bits of its operand, accepts whole numbers.
+func unaryOp(op token.Token, x Value) (Value, error) {
+	if _, ok := x.(Array); ok {
+		return arrayOp(x, func(x, _ Value) (Value, error) { return unaryOp(op, x) }, nil)
+	}
+	switch op {
+	case token.ADD, token.SUB:
+		if q, ok := x.(Quantity); ok {
+			return Quantity{number: constant.UnaryOp(op, q.number, 0), unit: q.unit}, nil
+		}
+		if d, ok := x.(Duration); ok {
+			if op == token.SUB {
+				return -d, nil
+			}
+			return d, nil
+		}
+		if n, ok := toNumber(x); ok {
+			return constant.UnaryOp(op, n, 0), nil
+		}
+	case token.NOT:
+		if isBool(x) {
+			return constant.UnaryOp(op, x.(constant.Value), 0), nil
+		}
+	case token.XOR:
+		if n, ok := wholeNumber(x); ok {
+			return constant.UnaryOp(op, n, 0), nil
+		}
+	}
+	return nil, &TypeError{Op: op, X: x}
+}
+
+// binaryOp applies op to x and y without panicking. The operands are coerced
+// as follows:
+//
+//   - an integer combined with a fraction is converted to a fraction
+//   - a boolean combined with a number, or used with an arithmetic or
+//     ordering operator, counts as 1 when true and 0 when false
+//   - + with a text operand concatenates, converting the other operand to
+//     text the same way CONCAT does
+//   - a number added to or subtracted from a date is a number of days
+//   - an array is combined element by element with an array of the same
+//     size or with every element with any other value
+//   - a number combined with a quantity is a quantity without a unit;
+//     quantities in different units of the same dimension are converted to
+//     the unit of the left operand
+//
+// Text can only be compared with text and && and || require booleans. Dates
+// and durations can be compared with values of the same kind; subtracting
+// two dates gives a duration. The bitwise operators &, |, ^ and &^ and the
+// shifts << and >> require whole numbers.
+func binaryOp(x Value, op token.Token, y Value) (Value, error) {
+	// Numbers are the common case so they skip the checks for other kinds.
+	if a, ok := asNumber(x); ok {
+		if b, ok := asNumber(y); ok {
+			if v, ok, err := numberOp(a, op, b); ok {
+				return v, err
+			}
+		}
+	}
+	_, xArray := x.(Array)
+	_, yArray := y.(Array)
+	if xArray || yArray {
+		return arrayOp(x, func(x, y Value) (Value, error) { return binaryOp(x, op, y) }, y)
+	}
+	if op == token.ADD && (isText(x) || isText(y)) {
+		return constant.MakeString(text(x) + text(y)), nil
+	}
+	if isTemporal(x) || isTemporal(y) {
+		if v, ok, err := temporalOp(x, op, y); ok {
+			return v, err
+		}
+		return nil, &TypeError{Op: op, X: x, Y: y}
+	}
+	if isQuantity(x) || isQuantity(y) {
+		return quantityOp(x, op, y)
+	}
+	a, aok := x.(constant.Value)
+	b, bok := y.(constant.Value)
+	if !aok || !bok {
+		return nil, &TypeError{Op: op, X: x, Y: y}
+	}
+	return constantOp(a, op, b)
+}
+
+func constantOp(x constant.Value, op token.Token, y constant.Value) (Value, error) {
+	switch op {
+	case token.LAND, token.LOR:
+		if x.Kind() == constant.Bool && y.Kind() == constant.Bool {
+			return constant.BinaryOp(x, op, y), nil
+		}
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		switch {
+		case x.Kind() == constant.String && y.Kind() == constant.String:
+			return constant.MakeBool(constant.Compare(x, op, y)), nil
+		case x.Kind() == constant.Bool && y.Kind() == constant.Bool && (op == token.EQL || op == token.NEQ):
+			return constant.MakeBool(constant.Compare(x, op, y)), nil
+		}
+		if a, b, ok := toNumbers(x, y); ok {
+			v, _, err := numberOp(a, op, b)
+			return v, err
+		}
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		if a, b, ok := toNumbers(x, y); ok {
+			if v, ok, err := numberOp(a, op, b); ok {
+				return v, err
+			}
+		}
+	case token.AND, token.OR, token.XOR, token.AND_NOT, token.SHL, token.SHR:
+		return bitwiseOp(x, op, y)
+	default:
+		return nil, fmt.Errorf("unsupported operator %s", op)
+	}
+	return nil, &TypeError{Op: op, X: x, Y: y}
+}
+
+// numberOp applies an arithmetic or comparison operator to two numbers. It
+// reports false for other operators and for % of numbers that are not
+// integers.
+func numberOp(a constant.Value, op token.Token, b constant.Value) (Value, bool, error) {
+	if x, ok := int64Of(a); ok {
+		if y, ok := int64Of(b); ok {
+			if v, ok := intOp(x, op, y); ok {
+				return v, true, nil
+			}
+		}
+	}
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return constant.MakeBool(constant.Compare(a, op, b)), true, nil
+	case token.ADD, token.SUB, token.MUL:
+		return constant.BinaryOp(a, op, b), true, nil
+	case token.QUO, token.REM:
+		if op == token.REM && (a.Kind() != constant.Int || b.Kind() != constant.Int) {
+			return nil, false, nil
+		}
+		if constant.Sign(b) == 0 {
+			return nil, true, ErrDivisionByZero
+		}
+		return constant.BinaryOp(a, op, b), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// int64Of returns the value of integers that fit in an int64.
+func int64Of(v Value) (int64, bool) {
+	c, ok := v.(constant.Value)
+	if !ok || c.Kind() != constant.Int {
+		return 0, false
+	}
+	return constant.Int64Val(c)
+}
+
+// intOp applies op to integers that fit in an int64 without going through
+// the arbitrary precision arithmetic of constant.BinaryOp. It reports false
+// when the result does not fit, is not an integer or the divisor is zero.
+func intOp(x int64, op token.Token, y int64) (Value, bool) {
+	switch op {
+	case token.ADD:
+		if v := x + y; (v > x) == (y > 0) {
+			return constant.MakeInt64(v), true
+		}
+	case token.SUB:
+		if v := x - y; (v < x) == (y > 0) {
+			return constant.MakeInt64(v), true
+		}
+	case token.MUL:
+		if x == 0 || y == 0 {
+			return constant.MakeInt64(0), true
+		}
+		if v := x * y; v/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+			return constant.MakeInt64(v), true
+		}
+	case token.QUO:
+		if y != 0 && y != -1 && x%y == 0 {
+			return constant.MakeInt64(x / y), true
+		}
+	case token.REM:
+		if y != 0 && y != -1 {
+			return constant.MakeInt64(x % y), true
+		}
+	case token.EQL:
+		return constant.MakeBool(x == y), true
+	case token.NEQ:
+		return constant.MakeBool(x != y), true
+	case token.LSS:
+		return constant.MakeBool(x < y), true
+	case token.LEQ:
+		return constant.MakeBool(x <= y), true
+	case token.GTR:
+		return constant.MakeBool(x > y), true
+	case token.GEQ:
+		return constant.MakeBool(x >= y), true
+	}
+	return nil, false
+}
+
+// toNumber converts booleans to 1 or 0. It reports false for other kinds that
+// are not numbers.
+func toNumber(x Value) (constant.Value, bool) {
+	v, ok := x.(constant.Value)
+	if !ok {
+		return nil, false
+	}
+	switch v.Kind() {
+	case constant.Int, constant.Float:
+		return v, true
+	case constant.Bool:
+		if constant.BoolVal(v) {
+			return constant.MakeInt64(1), true
+		}
+		return constant.MakeInt64(0), true
+	default:
+		return nil, false
+	}
+}
+
+func toNumbers(x, y Value) (constant.Value, constant.Value, bool) {
+	a, ok := toNumber(x)
+	if !ok {
+		return nil, nil, false
+	}
+	b, ok := toNumber(y)
+	if !ok {
+		return nil, nil, false
+	}
+	return a, b, true
+}
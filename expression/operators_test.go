@@ -0,0 +1,116 @@
+package expression_test
+
+import (
+	"errors"
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestEvaluate_operators(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeInt64(5), nil
+	})
+	for _, tt := range []struct {
+		Name       string
+		Dialect    expression.Dialect
+		Expression string
+		Result     string
+	}{
+		{Name: "equal", Expression: "1 == 1", Result: "true"},
+		{Name: "not equal", Expression: "1 != 1", Result: "false"},
+		{Name: "less", Expression: "A0 < 6", Result: "true"},
+		{Name: "less or equal", Expression: "5 <= A0", Result: "true"},
+		{Name: "greater", Expression: "A0 > 5", Result: "false"},
+		{Name: "greater or equal", Expression: "A0 >= 5.5", Result: "false"},
+		{Name: "int equals float", Expression: "2 == 2.0", Result: "true"},
+		{Name: "text", Expression: `"apple" < "banana"`, Result: "true"},
+		{Name: "booleans", Expression: "true == false", Result: "false"},
+		{Name: "ordered booleans count as numbers", Expression: "false < true", Result: "true"},
+		{Name: "boolean and number", Expression: "true == 1", Result: "true"},
+		{Name: "boolean arithmetic", Expression: "true + true", Result: "2"},
+		{Name: "negated boolean", Expression: "-true", Result: "-1"},
+		{Name: "int and float", Expression: "1 + 0.5", Result: "3/2"},
+		{Name: "division", Expression: "7 / 2", Result: "7/2"},
+		{Name: "remainder", Expression: "7 % 2", Result: "1"},
+		{Name: "negative remainder", Expression: "-7 % A0", Result: "-2"},
+		{Name: "inexact division", Expression: "A0 / 2", Result: "5/2"},
+		{Name: "sum larger than int64", Expression: "9223372036854775807 + A0", Result: "9223372036854775812"},
+		{Name: "difference smaller than int64", Expression: "-9223372036854775807 - A0", Result: "-9223372036854775812"},
+		{Name: "product larger than int64", Expression: "A0 * 2000000000000000000", Result: "10000000000000000000"},
+		{Name: "quotient larger than int64", Expression: "(-9223372036854775807 - 1) / -1", Result: "9223372036854775808"},
+		{Name: "text and number", Expression: `"a" + 1`, Result: `"a1"`},
+		{Name: "number and text", Expression: `1.5 + "a"`, Result: `"1.5a"`},
+		{Name: "text and boolean", Expression: `"a" + true`, Result: `"aTRUE"`},
+		{Name: "comparison in a condition", Expression: `IF(A0 > 3, "big", "small")`, Result: `"big"`},
+		{Name: "logical", Expression: "A0 > 3 && A0 < 10", Result: "true"},
+		{Name: "formula equal", Dialect: expression.FormulaDialect, Expression: `="a"="a"`, Result: "true"},
+		{Name: "formula not equal", Dialect: expression.FormulaDialect, Expression: "=A0<>5", Result: "false"},
+		{Name: "formula concatenation", Dialect: expression.FormulaDialect, Expression: `=1&2`, Result: `"12"`},
+		{Name: "bitwise and", Expression: "12 & 10", Result: "8"},
+		{Name: "bitwise or", Expression: "12 | A0", Result: "13"},
+		{Name: "bitwise xor", Expression: "12 ^ 10", Result: "6"},
+		{Name: "bit clear", Expression: "12 &^ 4", Result: "8"},
+		{Name: "complement", Expression: "^A0", Result: "-6"},
+		{Name: "negative and", Expression: "-1 & 255", Result: "255"},
+		{Name: "shift left", Expression: "1 << 70", Result: "1180591620717411303424"},
+		{Name: "shift right", Expression: "A0 >> 1", Result: "2"},
+		{Name: "whole fraction", Expression: "4.0 | 1", Result: "5"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := tt.Dialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.(constant.Value).ExactString())
+		})
+	}
+}
+
+func TestEvaluate_operatorErrors(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeInt64(0), nil
+	})
+	for _, tt := range []struct {
+		Expression string
+		Message    string
+		Span       string
+		Is         error
+		TypeError  bool
+	}{
+		{Expression: `1 + ("a" - 1)`, Message: `cannot apply - to "a" (text) and 1 (number)`, Span: `"a" - 1`, TypeError: true},
+		{Expression: `"a" < 1`, Message: `cannot apply < to "a" (text) and 1 (number)`, Span: `"a" < 1`, TypeError: true},
+		{Expression: `1 && true`, Message: `cannot apply && to 1 (number) and true (boolean)`, Span: `1 && true`, TypeError: true},
+		{Expression: `-"a"`, Message: `cannot apply - to "a" (text)`, Span: `-"a"`, TypeError: true},
+		{Expression: `!1`, Message: `cannot apply ! to 1 (number)`, Span: `!1`, TypeError: true},
+		{Expression: `1.5 % 1`, Message: `cannot apply % to 1.5 (number) and 1 (number)`, Span: `1.5 % 1`, TypeError: true},
+		{Expression: `2 * (1 / A0)`, Message: "division by zero", Span: "1 / A0", Is: expression.ErrDivisionByZero},
+		{Expression: `5 % A0`, Message: "division by zero", Span: "5 % A0", Is: expression.ErrDivisionByZero},
+		{Expression: `1.5 & 1`, Message: `cannot apply & to 1.5 (number) and 1 (number)`, Span: `1.5 & 1`, TypeError: true},
+		{Expression: `true | 1`, Message: `cannot apply | to true (boolean) and 1 (number)`, Span: `true | 1`, TypeError: true},
+		{Expression: `^"a"`, Message: `cannot apply ^ to "a" (text)`, Span: `^"a"`, TypeError: true},
+		{Expression: `1 << (A0 - 1)`, Message: "negative shift count -1", Span: "1 << (A0 - 1)"},
+		{Expression: `1 << 2000`, Message: "shift count 2000 is more than 1024", Span: "1 << 2000"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.New(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			var d *expression.Diagnostic
+			require.True(t, errors.As(err, &d), "expected a diagnostic got %v", err)
+			assert.EqualError(t, err, tt.Message)
+			assert.Equal(t, tt.Span, tt.Expression[d.Start:d.End])
+			if tt.Is != nil {
+				assert.ErrorIs(t, err, tt.Is)
+			}
+			if tt.TypeError {
+				var typeErr *expression.TypeError
+				assert.True(t, errors.As(err, &typeErr))
+			}
+		})
+	}
+}
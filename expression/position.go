@@ -0,0 +1,159 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+)
+
+// PositionScope is implemented by scopes that evaluate the expression of a
+// cell. ROW, COLUMN and REL without a reference use its position.
+type PositionScope interface {
+	Position() (column, row int)
+}
+
+// position returns the column and row of the cell being evaluated.
+func (ev *evaluation) position() (cellRange, error) {
+	positions, ok := ev.scope.(PositionScope)
+	if !ok {
+		return cellRange{}, errors.New("there is no cell to take the position from")
+	}
+	column, row := positions.Position()
+	return cellRange{column: column, row: row, endColumn: column, endRow: row}, nil
+}
+
+// referenceArg returns the optional reference argument of ROW and COLUMN or
+// the cell being evaluated.
+func (ev *evaluation) referenceArg(args []Value) (cellRange, error) {
+	if len(args) == 0 {
+		return ev.position()
+	}
+	return rangeArg(args, 0)
+}
+
+// row returns the zero-based row of the top of a reference: ROW([reference]).
+func row(ev *evaluation, args []Value) (Value, error) {
+	r, err := ev.referenceArg(args)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(r.row)), nil
+}
+
+// column returns the zero-based column of the left of a reference:
+// COLUMN([reference]).
+func column(ev *evaluation, args []Value) (Value, error) {
+	r, err := ev.referenceArg(args)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(r.column)), nil
+}
+
+// rows returns the number of rows in a range: ROWS(range).
+func rows(_ *evaluation, args []Value) (Value, error) {
+	r, err := rangeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(r.rows())), nil
+}
+
+// columns returns the number of columns in a range: COLUMNS(range).
+func columns(_ *evaluation, args []Value) (Value, error) {
+	r, err := rangeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeInt64(int64(r.columns())), nil
+}
+
+// address returns the name of the cell at a zero-based row and column:
+// ADDRESS(row, column).
+func address(args []Value) (Value, error) {
+	n, err := integers(args)
+	if err != nil {
+		return nil, err
+	}
+	if n[0] < 0 || n[1] < 0 {
+		return nil, fmt.Errorf("row and column must not be negative, got %d and %d", n[0], n[1])
+	}
+	return constant.MakeString(CellName(n[1], n[0])), nil
+}
+
+// relative returns the cell, or range, at an offset from the cell being
+// evaluated: REL(rows, columns, [height], [width]). REL(-1, 0) is the cell
+// above.
+func relative(ev *evaluation, args []Value) (Value, error) {
+	here, err := ev.position()
+	if err != nil {
+		return nil, err
+	}
+	return offsetRange(ev, append([]Value{here}, args...))
+}
+
+// relativeReference returns the reference made by a call to REL with
+// whole number literals as arguments. The rows and columns of the reference
+// are offsets from the cell the expression belongs to.
+func relativeReference(e *ast.CallExpr) (Reference, bool) {
+	n := []int{0, 0, 1, 1}
+	if len(e.Args) < 2 || len(e.Args) > len(n) {
+		return Reference{}, false
+	}
+	for i, arg := range e.Args {
+		v, ok := integerLiteral(arg)
+		if !ok {
+			return Reference{}, false
+		}
+		n[i] = v
+	}
+	if n[2] < 1 || n[3] < 1 {
+		return Reference{}, false
+	}
+	return Reference{
+		Kind:      RelativeReference,
+		Name:      "REL",
+		Column:    n[1],
+		Row:       n[0],
+		EndColumn: n[1] + n[3] - 1,
+		EndRow:    n[0] + n[2] - 1,
+		Start:     offset(e.Pos()),
+		End:       offset(e.End()),
+	}, true
+}
+
+// integerLiteral returns the value of an integer literal, which may be
+// negated, that fits in an int32.
+func integerLiteral(expr ast.Expr) (int, bool) {
+	n, ok := int64Literal(expr)
+	if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// int64Literal returns the value of an integer literal, which may be
+// negated, that fits in an int64.
+func int64Literal(expr ast.Expr) (int64, bool) {
+	var negative bool
+	expr = ast.Unparen(expr)
+	if u, ok := expr.(*ast.UnaryExpr); ok && (u.Op == token.SUB || u.Op == token.ADD) {
+		negative = u.Op == token.SUB
+		expr = ast.Unparen(u.X)
+	}
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, false
+	}
+	n, ok := constant.Int64Val(constant.MakeFromLiteral(lit.Value, lit.Kind, 0))
+	if !ok {
+		return 0, false
+	}
+	if negative {
+		return -n, true
+	}
+	return n, true
+}
@@ -0,0 +1,84 @@
+package expression_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// cellScope evaluates an expression as if it were in a cell of the fruit
+// table.
+type cellScope struct {
+	fakeLookup
+	column, row int
+}
+
+func (s cellScope) Position() (int, int) { return s.column, s.row }
+
+func TestPositionFunctions(t *testing.T) {
+	scope := cellScope{fakeLookup: fruit(), column: 2, row: 3}
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "row", Expression: "=ROW()", Result: "3"},
+		{Name: "column", Expression: "=COLUMN()", Result: "2"},
+		{Name: "row of a cell", Expression: "=ROW(B7)", Result: "7"},
+		{Name: "column of a range", Expression: "=COLUMN(D1:E9)", Result: "3"},
+		{Name: "rows", Expression: "=ROWS(A0:B4)", Result: "5"},
+		{Name: "columns", Expression: "=COLUMNS(A0:B4)", Result: "2"},
+		{Name: "address", Expression: "=ADDRESS(3, 27)", Result: `"AB3"`},
+		{Name: "cell to the left", Expression: "=REL(0, -1)", Result: "7"},
+		{Name: "cell above and left", Expression: "=REL(-1, -2)", Result: `"Pear"`},
+		{Name: "range above", Expression: "=SUM(REL(-3, -1, 3))", Result: "11"},
+		{Name: "indirect address", Expression: "=INDIRECT(ADDRESS(ROW() - 2, COLUMN() - 1))", Result: "7"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestPositionFunctions_errors(t *testing.T) {
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "=REL(-4, 0)", Error: "REL: moving C3 by -4 rows and 0 columns leaves the table"},
+		{Expression: "=ADDRESS(-1, 0)", Error: "ADDRESS: row and column must not be negative, got -1 and 0"},
+		{Expression: "=ROWS(1)", Error: "expected a cell or a range"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(cellScope{fakeLookup: fruit(), column: 2, row: 3}, node)
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+
+	t.Run("without a cell", func(t *testing.T) {
+		node, err := expression.FormulaDialect.Parse("=ROW() + 1")
+		require.NoError(t, err)
+		_, err = expression.Evaluate(fruit(), node)
+		assert.EqualError(t, err, "ROW: there is no cell to take the position from")
+	})
+}
+
+func TestReferences_relative(t *testing.T) {
+	node, err := expression.FormulaDialect.Parse("=REL(-1, 0) + SUM(REL(-3, +1, 2, 1)) + REL(A0, 0)")
+	require.NoError(t, err)
+	refs := expression.References(node)
+	require.Len(t, refs, 4)
+	assert.Equal(t, expression.Reference{Kind: expression.RelativeReference, Name: "REL", Column: 0, Row: -1, EndColumn: 0, EndRow: -1, Start: 1, End: 11}, refs[0])
+	assert.Equal(t, [4]int{1, -3, 1, -2}, [4]int{refs[1].Column, refs[1].Row, refs[1].EndColumn, refs[1].EndRow})
+	assert.Equal(t, expression.DynamicReference, refs[2].Kind)
+	assert.Equal(t, expression.CellReference, refs[3].Kind)
+}
@@ -0,0 +1,94 @@
+package expression
+
+import (
+	"fmt"
+	"go/constant"
+	"regexp"
+	"sync"
+)
+
+// PatternError is returned by the regular expression functions when the
+// pattern does not compile.
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("invalid pattern %q: %s", e.Pattern, e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// maxCachedPatterns bounds the memory used by patterns built from cell
+// values. The cache is emptied when it is full.
+const maxCachedPatterns = 256
+
+// patterns caches compiled regular expressions across evaluations. A Regexp
+// is safe for concurrent use.
+var patterns = struct {
+	sync.Mutex
+	cache map[string]*regexp.Regexp
+}{cache: make(map[string]*regexp.Regexp)}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+	if re, ok := patterns.cache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &PatternError{Pattern: pattern, Err: err}
+	}
+	if len(patterns.cache) >= maxCachedPatterns {
+		clear(patterns.cache)
+	}
+	patterns.cache[pattern] = re
+	return re, nil
+}
+
+func patternArg(args []Value, i int) (*regexp.Regexp, error) {
+	if !isText(args[i]) {
+		return nil, fmt.Errorf("argument %d is %s, not text", i+1, exactString(args[i]))
+	}
+	return compilePattern(constant.StringVal(args[i].(constant.Value)))
+}
+
+func regexMatch(args []Value) (Value, error) {
+	re, err := patternArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeBool(re.MatchString(text(args[0]))), nil
+}
+
+// regexExtract returns the first match, or the first group of the first
+// match when the pattern has groups.
+func regexExtract(args []Value) (Value, error) {
+	re, err := patternArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	s := text(args[0])
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("%q does not match %q", s, re.String())
+	}
+	if len(match) > 1 {
+		return constant.MakeString(match[1]), nil
+	}
+	return constant.MakeString(match[0]), nil
+}
+
+// regexReplace replaces every match. The replacement may refer to groups
+// with $1 or ${name}.
+func regexReplace(args []Value) (Value, error) {
+	re, err := patternArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return constant.MakeString(re.ReplaceAllString(text(args[0]), text(args[2]))), nil
+}
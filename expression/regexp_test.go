@@ -0,0 +1,68 @@
+package expression_test
+
+import (
+	"errors"
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestRegexpFunctions(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeString("Order #1042 shipped 2026-10-17"), nil
+	})
+	for _, tt := range []struct {
+		Name       string
+		Dialect    expression.Dialect
+		Expression string
+		Result     string
+	}{
+		{Name: "match", Expression: `REGEXMATCH(A0, "#[0-9]+")`, Result: "true"},
+		{Name: "no match", Expression: `REGEXMATCH(A0, "^shipped")`, Result: "false"},
+		{Name: "match a number", Expression: `REGEXMATCH(1042, "^1[0-9]{3}$")`, Result: "true"},
+		{Name: "extract", Expression: `REGEXEXTRACT(A0, "[0-9]{4}-[0-9]{2}-[0-9]{2}")`, Result: `"2026-10-17"`},
+		{Name: "extract group", Expression: `REGEXEXTRACT(A0, "#([0-9]+)")`, Result: `"1042"`},
+		{Name: "extract characters", Expression: `REGEXEXTRACT("café crème", "\\pL+$")`, Result: `"crème"`},
+		{Name: "replace", Expression: `REGEXREPLACE("  too   many  spaces ", " +", " ")`, Result: `" too many spaces "`},
+		{Name: "replace groups", Expression: `REGEXREPLACE(A0, "(\\d{4})-(\\d{2})-(\\d{2})", "$3/$2/$1")`, Result: `"Order #1042 shipped 17/10/2026"`},
+		{Name: "formula", Dialect: expression.FormulaDialect, Expression: `=VALUE(REGEXEXTRACT(A0,"#(\d+)"))+1`, Result: "1043"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := tt.Dialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.(constant.Value).ExactString())
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		node, err := expression.New(`REGEXMATCH(A0, "(unclosed")`)
+		require.NoError(t, err)
+		_, err = expression.Evaluate(scope, node)
+		var patternErr *expression.PatternError
+		require.True(t, errors.As(err, &patternErr))
+		assert.Equal(t, "(unclosed", patternErr.Pattern)
+		assert.Equal(t, "REGEXMATCH: invalid pattern \"(unclosed\": error parsing regexp: missing closing ): `(unclosed`", err.Error())
+		var d *expression.Diagnostic
+		assert.True(t, errors.As(err, &d))
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		node, err := expression.New(`REGEXEXTRACT("abc", "[0-9]")`)
+		require.NoError(t, err)
+		_, err = expression.Evaluate(scope, node)
+		assert.EqualError(t, err, `REGEXEXTRACT: "abc" does not match "[0-9]"`)
+	})
+
+	t.Run("pattern must be text", func(t *testing.T) {
+		node, err := expression.New(`REGEXMATCH("abc", 1)`)
+		require.NoError(t, err)
+		_, err = expression.Evaluate(scope, node)
+		assert.EqualError(t, err, "REGEXMATCH: argument 2 is 1, not text")
+	})
+}
@@ -0,0 +1,301 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"slices"
+)
+
+// The statistical functions skip blank cells, and the text and booleans in
+// ranges and arrays. Sample statistics such as
+// STDEV divide by one less than the number of values, population statistics
+// such as STDEVP by the number of values.
+
+// count returns the number of numbers, dates and durations.
+func count(args []Value) (Value, error) {
+	n := 0
+	for _, arg := range args {
+		if isNumber(arg) || isTemporal(arg) {
+			n++
+		}
+	}
+	return constant.MakeInt64(int64(n)), nil
+}
+
+// countA returns the number of cells that are not blank.
+func countA(args []Value) (Value, error) {
+	return constant.MakeInt64(int64(len(skipBlanks(args)))), nil
+}
+
+// sortedNumbers returns the numbers, which must not be empty, in ascending
+// order.
+func sortedNumbers(args []Value) ([]constant.Value, error) {
+	nums, err := numbers(skipBlanks(args))
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, errors.New("there are no numbers")
+	}
+	slices.SortFunc(nums, compareNumbers)
+	return nums, nil
+}
+
+func compareNumbers(a, b constant.Value) int {
+	switch {
+	case constant.Compare(a, token.LSS, b):
+		return -1
+	case constant.Compare(a, token.GTR, b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func median(args []Value) (Value, error) {
+	nums, err := sortedNumbers(args)
+	if err != nil {
+		return nil, err
+	}
+	return percentileOf(nums, constant.MakeFromLiteral("0.5", token.FLOAT, 0)), nil
+}
+
+// mode returns the number that occurs most often. When several occur equally
+// often the one that occurs first wins.
+func mode(args []Value) (Value, error) {
+	nums, err := numbers(skipBlanks(args))
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(nums))
+	for _, n := range nums {
+		counts[n.ExactString()]++
+	}
+	var result constant.Value
+	most := 1
+	for _, n := range nums {
+		if c := counts[n.ExactString()]; c > most {
+			result, most = n, c
+		}
+	}
+	if result == nil {
+		return nil, errors.New("no number occurs more than once")
+	}
+	return result, nil
+}
+
+// variance returns a function computing the sample or population variance.
+func variance(sample bool) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		nums, err := numbers(skipBlanks(args))
+		if err != nil {
+			return nil, err
+		}
+		return varianceOf(nums, sample)
+	}
+}
+
+func standardDeviation(sample bool) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		v, err := variance(sample)(args)
+		if err != nil {
+			return nil, err
+		}
+		return sqrt(v.(constant.Value)), nil
+	}
+}
+
+func varianceOf(nums []constant.Value, sample bool) (constant.Value, error) {
+	n := int64(len(nums))
+	divisor := n
+	if sample {
+		divisor--
+	}
+	if divisor < 1 {
+		return nil, fmt.Errorf("needs at least %d %s, got %d", n-divisor+1, plural(int(n-divisor+1), "number"), n)
+	}
+	mean := meanOf(nums)
+	squares := constant.MakeInt64(0)
+	for _, x := range nums {
+		d := constant.BinaryOp(x, token.SUB, mean)
+		squares = constant.BinaryOp(squares, token.ADD, constant.BinaryOp(d, token.MUL, d))
+	}
+	return constant.BinaryOp(squares, token.QUO, constant.MakeInt64(divisor)), nil
+}
+
+func meanOf(nums []constant.Value) constant.Value {
+	total := constant.MakeInt64(0)
+	for _, x := range nums {
+		total = constant.BinaryOp(total, token.ADD, x)
+	}
+	return constant.BinaryOp(total, token.QUO, constant.MakeInt64(int64(len(nums))))
+}
+
+// sqrt returns the square root of a number that is not negative. It is exact
+// when the number is the square of a fraction.
+func sqrt(x constant.Value) constant.Value {
+	r := Rat(x)
+	num, denom := new(big.Int).Sqrt(r.Num()), new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) == 0 && new(big.Int).Mul(denom, denom).Cmp(r.Denom()) == 0 {
+		return constant.Make(new(big.Rat).SetFrac(num, denom))
+	}
+	f := new(big.Float).SetPrec(256).SetRat(r)
+	return constant.Make(f.Sqrt(f))
+}
+
+// rangeNumbers returns the numbers in a range or an array argument without
+// blank cells, text and booleans.
+func (ev *evaluation) rangeNumbers(args []Value, i int) ([]constant.Value, error) {
+	a, err := areaArg(args, i)
+	if err != nil {
+		return nil, err
+	}
+	values, err := ev.values(a)
+	if err != nil {
+		return nil, err
+	}
+	return numbers(slices.DeleteFunc(values, ignored))
+}
+
+// ignored reports whether a value in a range is skipped: blank cells, text
+// and booleans.
+func ignored(v Value) bool {
+	return isBlank(v) || isText(v) || isBool(v)
+}
+
+// percentile interpolates between the closest ranks of the numbers in a range,
+// where 0 is the smallest number and 1 the largest.
+func percentile(ev *evaluation, args []Value) (Value, error) {
+	nums, err := ev.rangeNumbers(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	k, ok := args[1].(constant.Value)
+	if !ok || !isNumber(k) || constant.Sign(k) < 0 || constant.Compare(k, token.GTR, constant.MakeInt64(1)) {
+		return nil, fmt.Errorf("the percentile must be a number from 0 to 1, got %s", exactString(args[1]))
+	}
+	if len(nums) == 0 {
+		return nil, errors.New("there are no numbers")
+	}
+	slices.SortFunc(nums, compareNumbers)
+	return percentileOf(nums, k), nil
+}
+
+// quartile returns the minimum, the first quartile, the median, the third
+// quartile or the maximum for 0 to 4.
+func quartile(ev *evaluation, args []Value) (Value, error) {
+	nums, err := ev.rangeNumbers(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	q, err := integerArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if q < 0 || q > 4 {
+		return nil, fmt.Errorf("the quartile must be 0, 1, 2, 3 or 4, got %d", q)
+	}
+	if len(nums) == 0 {
+		return nil, errors.New("there are no numbers")
+	}
+	slices.SortFunc(nums, compareNumbers)
+	return percentileOf(nums, constant.BinaryOp(constant.MakeInt64(int64(q)), token.QUO, constant.MakeInt64(4))), nil
+}
+
+// percentileOf interpolates the sorted numbers at k from 0 to 1.
+func percentileOf(nums []constant.Value, k constant.Value) constant.Value {
+	position := constant.BinaryOp(k, token.MUL, constant.MakeInt64(int64(len(nums)-1)))
+	lower := round(position, 0, RoundFloor)
+	i, _ := constant.Int64Val(lower)
+	if i >= int64(len(nums)-1) {
+		return nums[len(nums)-1]
+	}
+	fraction := constant.BinaryOp(position, token.SUB, lower)
+	step := constant.BinaryOp(nums[i+1], token.SUB, nums[i])
+	return constant.BinaryOp(nums[i], token.ADD, constant.BinaryOp(fraction, token.MUL, step))
+}
+
+// rank returns the position of a number in a range counting from 1 for the
+// largest, or the smallest when the third argument is not zero. Equal numbers
+// have the same rank.
+func rank(ev *evaluation, args []Value) (Value, error) {
+	if !isNumber(args[0]) {
+		return nil, fmt.Errorf("argument 1 is %s, not a number", exactString(args[0]))
+	}
+	x := args[0].(constant.Value)
+	nums, err := ev.rangeNumbers(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	ascending := false
+	if len(args) > 2 {
+		order, err := integerArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		ascending = order != 0
+	}
+	before, found := 0, false
+	for _, n := range nums {
+		switch c := compareNumbers(n, x); {
+		case c == 0:
+			found = true
+		case (c > 0) != ascending:
+			before++
+		}
+	}
+	if !found {
+		return nil, &NotFoundError{Key: x}
+	}
+	return constant.MakeInt64(int64(before + 1)), nil
+}
+
+// correl returns the Pearson correlation coefficient of two ranges of the
+// same size. Pairs with a blank cell, text or a boolean are skipped.
+func correl(ev *evaluation, args []Value) (Value, error) {
+	var columns [2][]Value
+	for i := range columns {
+		a, err := areaArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if columns[i], err = ev.values(a); err != nil {
+			return nil, err
+		}
+	}
+	if len(columns[0]) != len(columns[1]) {
+		return nil, fmt.Errorf("the ranges %s and %s have different sizes", args[0], args[1])
+	}
+	var xs, ys []Value
+	for i := range columns[0] {
+		if !ignored(columns[0][i]) && !ignored(columns[1][i]) {
+			xs, ys = append(xs, columns[0][i]), append(ys, columns[1][i])
+		}
+	}
+	x, err := numbers(xs)
+	if err != nil {
+		return nil, err
+	}
+	y, err := numbers(ys)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) < 2 {
+		return nil, fmt.Errorf("needs at least 2 pairs of numbers, got %d", len(x))
+	}
+	mx, my := meanOf(x), meanOf(y)
+	sxy, sxx, syy := constant.MakeInt64(0), constant.MakeInt64(0), constant.MakeInt64(0)
+	for i := range x {
+		dx, dy := constant.BinaryOp(x[i], token.SUB, mx), constant.BinaryOp(y[i], token.SUB, my)
+		sxy = constant.BinaryOp(sxy, token.ADD, constant.BinaryOp(dx, token.MUL, dy))
+		sxx = constant.BinaryOp(sxx, token.ADD, constant.BinaryOp(dx, token.MUL, dx))
+		syy = constant.BinaryOp(syy, token.ADD, constant.BinaryOp(dy, token.MUL, dy))
+	}
+	if constant.Sign(sxx) == 0 || constant.Sign(syy) == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return constant.BinaryOp(sxy, token.QUO, sqrt(constant.BinaryOp(sxx, token.MUL, syy))), nil
+}
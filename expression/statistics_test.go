@@ -0,0 +1,115 @@
+package expression_test
+
+import (
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// sample has the numbers 2, 4, 4, 4, 5, 5, 7, 9 in A0:A7, a blank cell in A8
+// and the text "n/a" in A9. Column B has 1 to 9 and a blank cell in B9 and
+// column C has 20 down to 6 in C0:C7.
+func sample() fakeLookup {
+	return cellLookup(map[string]expression.Value{
+		"A0": constant.MakeInt64(2), "B0": constant.MakeInt64(1), "C0": constant.MakeInt64(20),
+		"A1": constant.MakeInt64(4), "B1": constant.MakeInt64(2), "C1": constant.MakeInt64(18),
+		"A2": constant.MakeInt64(4), "B2": constant.MakeInt64(3), "C2": constant.MakeInt64(16),
+		"A3": constant.MakeInt64(4), "B3": constant.MakeInt64(4), "C3": constant.MakeInt64(14),
+		"A4": constant.MakeInt64(5), "B4": constant.MakeInt64(5), "C4": constant.MakeInt64(12),
+		"A5": constant.MakeInt64(5), "B5": constant.MakeInt64(6), "C5": constant.MakeInt64(10),
+		"A6": constant.MakeInt64(7), "B6": constant.MakeInt64(7), "C6": constant.MakeInt64(8),
+		"A7": constant.MakeInt64(9), "B7": constant.MakeInt64(8), "C7": constant.MakeInt64(6),
+		"B8": constant.MakeInt64(9),
+		"A9": constant.MakeString("n/a"),
+	})
+}
+
+func TestStatisticalFunctions(t *testing.T) {
+	scope := sample()
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Result     string
+	}{
+		{Name: "count", Expression: "=COUNT(A0:A9)", Result: "8"},
+		{Name: "count arguments", Expression: `=COUNT(1, "a", TRUE, DATE(2026,1,1))`, Result: "2"},
+		{Name: "counta", Expression: "=COUNTA(A0:A9)", Result: "9"},
+		{Name: "average skips blanks", Expression: "=AVERAGE(A0:A8)", Result: "5"},
+		{Name: "average skips text in ranges", Expression: "=AVERAGE(A0:A9)", Result: "5"},
+		{Name: "sum skips text in ranges", Expression: "=SUM(A0:A9)", Result: "40"},
+		{Name: "sum skips text in offset ranges", Expression: "=SUM(OFFSET(A0,0,0,10,1))", Result: "40"},
+		{Name: "average skips text in offset ranges", Expression: "=AVERAGE(OFFSET(A0,0,0,10,1))", Result: "5"},
+		{Name: "min skips text in offset ranges", Expression: "=MIN(OFFSET(A1,0,0,9,1))", Result: "4"},
+		{Name: "count skips text in offset ranges", Expression: "=COUNT(OFFSET(A0,0,0,10,1))", Result: "8"},
+		{Name: "net present value skips text", Expression: "=NPV(0, A0:A9)", Result: "40"},
+		{Name: "max skips text in arrays", Expression: "=MAX(SORT(A0:A9))", Result: "9"},
+		{Name: "percentile skips text", Expression: "=PERCENTILE(A0:A9, 0.5)", Result: "9/2"},
+		{Name: "rank skips text", Expression: "=RANK(9, A0:A9)", Result: "1"},
+		{Name: "correlation skips text", Expression: "=ROUND(CORREL(A0:A9, B0:B9), 4)", Result: "4637/5000"},
+		{Name: "min skips blanks", Expression: "=MIN(B5:B9)", Result: "6"},
+		{Name: "max of blanks", Expression: "=MAX(D0:D3)", Result: "0"},
+		{Name: "sum of blanks", Expression: "=SUM(D0:D3)", Result: "0"},
+		{Name: "blank on its own is zero", Expression: "=A8+1", Result: "1"},
+		{Name: "median", Expression: "=MEDIAN(A0:A8)", Result: "9/2"},
+		{Name: "median odd", Expression: "=MEDIAN(3, 1, 2)", Result: "2"},
+		{Name: "mode", Expression: "=MODE(A0:A8)", Result: "4"},
+		{Name: "mode first", Expression: "=MODE(1, 2, 2, 1)", Result: "1"},
+		{Name: "population variance", Expression: "=VARP(A0:A8)", Result: "4"},
+		{Name: "population standard deviation", Expression: "=STDEVP(A0:A8)", Result: "2"},
+		{Name: "variance", Expression: "=VAR(A0:A8)", Result: "32/7"},
+		{Name: "standard deviation", Expression: "=ROUND(STDEV(A0:A8), 6)", Result: "213809/100000"},
+		{Name: "percentile", Expression: "=PERCENTILE(A0:A8, 0.9)", Result: "38/5"},
+		{Name: "percentile extremes", Expression: "=PERCENTILE(B0:B9, 0)+PERCENTILE(B0:B9, 1)", Result: "10"},
+		{Name: "quartile", Expression: "=QUARTILE(B0:B9, 1)", Result: "3"},
+		{Name: "median quartile", Expression: "=QUARTILE(A0:A8, 2)", Result: "9/2"},
+		{Name: "rank", Expression: "=RANK(7, A0:A8)", Result: "2"},
+		{Name: "rank ties", Expression: "=RANK(4, A0:A8)", Result: "5"},
+		{Name: "rank ascending", Expression: "=RANK(4, A0:A8, 1)", Result: "2"},
+		{Name: "correlation", Expression: "=CORREL(B0:B7, C0:C7)", Result: "-1"},
+		{Name: "correlation skips blanks", Expression: "=ROUND(CORREL(A0:A8, B0:B8), 4)", Result: "4637/5000"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.(constant.Value).ExactString())
+		})
+	}
+}
+
+func TestStatisticalFunctions_errors(t *testing.T) {
+	scope := sample()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "=MEDIAN(A9)", Error: `MEDIAN: argument 1 is "n/a", not a number`},
+		{Expression: `=AVERAGE(A0:A8, "n/a")`, Error: `AVERAGE: argument 9 is "n/a", not a number`},
+		{Expression: `=SUM(A0:A8, "n/a")`, Error: `SUM: argument 10 is "n/a", not a number`},
+		{Expression: "=STDEV(A0:A8, TRUE)", Error: "STDEV: argument 9 is true, not a number"},
+		{Expression: "=MEDIAN(D0:D3)", Error: "MEDIAN: there are no numbers"},
+		{Expression: "=MODE(1, 2, 3)", Error: "MODE: no number occurs more than once"},
+		{Expression: "=STDEV(1)", Error: "STDEV: needs at least 2 numbers, got 1"},
+		{Expression: "=VARP(D0:D1)", Error: "VARP: needs at least 1 number, got 0"},
+		{Expression: "=AVERAGE(D0:D1)", Error: "AVERAGE: division by zero"},
+		{Expression: "=PERCENTILE(A0:A8, 1.5)", Error: "PERCENTILE: the percentile must be a number from 0 to 1, got 3/2"},
+		{Expression: "=QUARTILE(A0:A8, 5)", Error: "QUARTILE: the quartile must be 0, 1, 2, 3 or 4, got 5"},
+		{Expression: "=RANK(6, A0:A8)", Error: "RANK: 6 (number) was not found"},
+		{Expression: "=CORREL(A0:A3, B0:B1)", Error: "CORREL: the ranges A0:A3 and B0:B1 have different sizes"},
+		{Expression: "=CORREL(A1:A3, D0:D2)", Error: "CORREL: needs at least 2 pairs of numbers, got 0"},
+		{Expression: "=CORREL(A1:A3, B1:B3)", Error: "CORREL: division by zero"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+}
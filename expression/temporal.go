@@ -0,0 +1,377 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// Time is a calendar date, or a date and a time of day. It has no time zone:
+// NOW and TODAY use the wall clock of the scope's location.
+type Time struct {
+	t    time.Time // always UTC
+	date bool      // midnight without a time of day
+}
+
+// MakeDate returns a date. Out of range months and days are normalized the
+// same way time.Date does.
+func MakeDate(year int, month time.Month, day int) Time {
+	return Time{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), date: true}
+}
+
+// MakeTime returns the wall clock date and time of t.
+func MakeTime(t time.Time) Time {
+	return Time{t: time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)}
+}
+
+// Time returns the date and time in UTC.
+func (t Time) Time() time.Time { return t.t }
+
+// IsDate reports whether t has no time of day.
+func (t Time) IsDate() bool { return t.date }
+
+func (t Time) String() string {
+	if t.date {
+		return t.t.Format(time.DateOnly)
+	}
+	return t.t.Format(time.DateTime)
+}
+
+func (t Time) add(d time.Duration) Time {
+	return Time{t: t.t.Add(d), date: t.date && d%day == 0}
+}
+
+// Duration is a length of time.
+type Duration time.Duration
+
+const day = 24 * time.Hour
+
+// String returns whole days as a number of days and other durations like
+// time.Duration does, with the days separated: 1d2h30m0s.
+func (d Duration) String() string {
+	td := time.Duration(d)
+	if td != 0 && td%day == 0 {
+		days := int64(td / day)
+		if days == 1 || days == -1 {
+			return strconv.FormatInt(days, 10) + " day"
+		}
+		return strconv.FormatInt(days, 10) + " days"
+	}
+	if td >= day || td <= -day {
+		days := td / day
+		rest := td - days*day
+		if rest < 0 {
+			rest = -rest
+		}
+		return strconv.FormatInt(int64(days), 10) + "d" + rest.String()
+	}
+	return td.String()
+}
+
+// ClockScope is implemented by scopes that provide the time used by NOW and
+// TODAY. Programs evaluated with other scopes use time.Now.
+type ClockScope interface {
+	Now() time.Time
+}
+
+func isTemporal(v Value) bool {
+	switch v.(type) {
+	case Time, Duration:
+		return true
+	default:
+		return false
+	}
+}
+
+var errTimeRange = errors.New("the result is outside the supported range of times")
+
+// temporalOp implements the operators for times and durations. Numbers
+// added to or subtracted from a time are days. The boolean result reports
+// whether the operand kinds are supported.
+func temporalOp(x Value, op token.Token, y Value) (Value, bool, error) {
+	switch a := x.(type) {
+	case Time:
+		switch b := y.(type) {
+		case Time:
+			switch op {
+			case token.SUB:
+				d := a.t.Sub(b.t)
+				if !a.t.Add(-d).Equal(b.t) {
+					return nil, true, errTimeRange
+				}
+				return Duration(d), true, nil
+			case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+				return constant.MakeBool(compareInts(int64(a.t.Compare(b.t)), op)), true, nil
+			}
+		case Duration:
+			switch op {
+			case token.ADD:
+				return a.add(time.Duration(b)), true, nil
+			case token.SUB:
+				return a.add(-time.Duration(b)), true, nil
+			}
+		case constant.Value:
+			if !isNumber(b) || (op != token.ADD && op != token.SUB) {
+				break
+			}
+			d, err := scaleDuration(day, b)
+			if err != nil {
+				return nil, true, err
+			}
+			if op == token.SUB {
+				d = -d
+			}
+			return a.add(d), true, nil
+		}
+	case Duration:
+		switch b := y.(type) {
+		case Duration:
+			switch op {
+			case token.ADD:
+				return a + b, true, nil
+			case token.SUB:
+				return a - b, true, nil
+			case token.QUO:
+				if b == 0 {
+					return nil, true, ErrDivisionByZero
+				}
+				return constant.BinaryOp(constant.MakeInt64(int64(a)), token.QUO, constant.MakeInt64(int64(b))), true, nil
+			case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+				return constant.MakeBool(compareInts(int64(a)-int64(b), op)), true, nil
+			}
+		case Time:
+			if op == token.ADD {
+				return b.add(time.Duration(a)), true, nil
+			}
+		case constant.Value:
+			if !isNumber(b) {
+				break
+			}
+			switch op {
+			case token.MUL:
+				d, err := scaleDuration(time.Duration(a), b)
+				return Duration(d), true, err
+			case token.QUO:
+				if constant.Sign(b) == 0 {
+					return nil, true, ErrDivisionByZero
+				}
+				d, err := scaleDuration(time.Duration(a), constant.BinaryOp(constant.MakeInt64(1), token.QUO, b))
+				return Duration(d), true, err
+			}
+		}
+	case constant.Value:
+		if !isNumber(a) {
+			break
+		}
+		switch b := y.(type) {
+		case Time:
+			if op == token.ADD {
+				return temporalOp(b, op, a)
+			}
+		case Duration:
+			if op == token.MUL {
+				return temporalOp(b, op, a)
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+func compareInts(sign int64, op token.Token) bool {
+	return constant.Compare(constant.MakeInt64(sign), op, constant.MakeInt64(0))
+}
+
+// scaleDuration multiplies d by a number, rounding to the nearest
+// nanosecond.
+func scaleDuration(d time.Duration, n constant.Value) (time.Duration, error) {
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(d)), Rat(n))
+	ns, exact := constant.Int64Val(round(constant.Make(r), 0, RoundHalfUp))
+	if !exact {
+		return 0, errTimeRange
+	}
+	return time.Duration(ns), nil
+}
+
+func timeArg(args []Value, i int) (Time, error) {
+	t, ok := args[i].(Time)
+	if !ok {
+		return Time{}, fmt.Errorf("argument %d is %s, not a date", i+1, exactString(args[i]))
+	}
+	return t, nil
+}
+
+func integerArg(args []Value, i int) (int, error) {
+	if c, ok := args[i].(constant.Value); ok && isNumber(c) {
+		if n, ok := integer(c); ok && n >= -1<<31 && n < 1<<31 {
+			return int(n), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %d is %s, not a whole number", i+1, exactString(args[i]))
+}
+
+func integers(args []Value) ([]int, error) {
+	result := make([]int, len(args))
+	for i := range args {
+		var err error
+		if result[i], err = integerArg(args, i); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func date(args []Value) (Value, error) {
+	n, err := integers(args)
+	if err != nil {
+		return nil, err
+	}
+	return MakeDate(n[0], time.Month(n[1]), n[2]), nil
+}
+
+func timeOfDay(args []Value) (Value, error) {
+	n, err := integers(args)
+	if err != nil {
+		return nil, err
+	}
+	return Duration(time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute + time.Duration(n[2])*time.Second), nil
+}
+
+func dateValue(args []Value) (Value, error) {
+	if !isText(args[0]) {
+		return nil, fmt.Errorf("argument 1 is %s, not text", exactString(args[0]))
+	}
+	s := constant.StringVal(args[0].(constant.Value))
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return Time{t: t, date: true}, nil
+	}
+	t, err := time.Parse(time.DateTime, s)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a date in the form 2006-01-02 or 2006-01-02 15:04:05", s)
+	}
+	return Time{t: t}, nil
+}
+
+func compileNow(date bool) func([]evalFunc) evalFunc {
+	return func([]evalFunc) evalFunc {
+		return func(ev *evaluation) (Value, error) {
+			now := time.Now
+			if clock, ok := ev.scope.(ClockScope); ok {
+				now = clock.Now
+			}
+			t := MakeTime(now())
+			if date {
+				return MakeDate(t.t.Date()), nil
+			}
+			return t, nil
+		}
+	}
+}
+
+// timePart returns a function that extracts a number from a time.
+func timePart(part func(time.Time) int) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		t, err := timeArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeInt64(int64(part(t.t))), nil
+	}
+}
+
+// weekday numbers days like spreadsheets do. The optional second argument
+// selects the numbering: 1 counts Sunday as 1 through Saturday as 7, 2
+// counts Monday as 1 through Sunday as 7 and 3 counts Monday as 0 through
+// Sunday as 6.
+func weekday(args []Value) (Value, error) {
+	t, err := timeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	numbering := 1
+	if len(args) > 1 {
+		if numbering, err = integerArg(args, 1); err != nil {
+			return nil, err
+		}
+	}
+	d := int64(t.t.Weekday())
+	switch numbering {
+	case 1:
+		return constant.MakeInt64(d + 1), nil
+	case 2:
+		return constant.MakeInt64((d+6)%7 + 1), nil
+	case 3:
+		return constant.MakeInt64((d + 6) % 7), nil
+	default:
+		return nil, fmt.Errorf("the weekday numbering must be 1, 2 or 3, got %d", numbering)
+	}
+}
+
+// edate adds months to a date. Days past the end of the resulting month are
+// moved back to its last day, so one month after January 31 is the last day
+// of February.
+func edate(args []Value) (Value, error) {
+	t, err := timeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	months, err := integerArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	year, month, d := t.t.Date()
+	first := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	clock := t.t.Sub(time.Date(year, month, d, 0, 0, 0, 0, time.UTC))
+	return Time{t: first.AddDate(0, 0, min(d, last)-1).Add(clock), date: t.date}, nil
+}
+
+// networkDays counts the weekdays from the start date to the end date
+// including both. Dates after the first two arguments are holidays that are
+// not counted. The count is negative when the end is before the start.
+func networkDays(args []Value) (Value, error) {
+	start, err := timeArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := timeArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	holidays := make(map[time.Time]bool, len(args)-2)
+	for i := 2; i < len(args); i++ {
+		h, err := timeArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		holidays[truncateDay(h.t)] = true
+	}
+	from, to, sign := truncateDay(start.t), truncateDay(end.t), int64(1)
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	days := int64(to.Sub(from)/day) + 1
+	count := days / 7 * 5
+	for d := from.AddDate(0, 0, int(days/7*7)); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if isWorkday(d) {
+			count++
+		}
+	}
+	for h := range holidays {
+		if !h.Before(from) && !h.After(to) && isWorkday(h) {
+			count--
+		}
+	}
+	return constant.MakeInt64(sign * count), nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func isWorkday(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
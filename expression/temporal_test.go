@@ -0,0 +1,118 @@
+package expression_test
+
+import (
+	"errors"
+	"go/constant"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+type clockScope struct {
+	fakeScopeFunc
+	now time.Time
+}
+
+func (s clockScope) Now() time.Time { return s.now }
+
+func TestTemporal(t *testing.T) {
+	scope := clockScope{
+		fakeScopeFunc: func(string) (constant.Value, error) {
+			return constant.MakeInt64(0), nil
+		},
+		now: time.Date(2026, 10, 17, 14, 30, 0, 0, time.FixedZone("EDT", -4*60*60)),
+	}
+	for _, tt := range []struct {
+		Name       string
+		Dialect    expression.Dialect
+		Expression string
+		Result     string
+	}{
+		{Name: "date", Expression: "DATE(2026, 10, 17)", Result: "2026-10-17"},
+		{Name: "normalized date", Expression: "DATE(2026, 13, 1)", Result: "2027-01-01"},
+		{Name: "today uses the clock", Expression: "TODAY()", Result: "2026-10-17"},
+		{Name: "now is wall clock time", Expression: "NOW()", Result: "2026-10-17 14:30:00"},
+		{Name: "date value", Expression: `DATEVALUE("2026-02-28")`, Result: "2026-02-28"},
+		{Name: "date time value", Expression: `DATEVALUE("2026-02-28 09:15:00")`, Result: "2026-02-28 09:15:00"},
+		{Name: "add days", Expression: "DATE(2026, 10, 17) + 30", Result: "2026-11-16"},
+		{Name: "days before", Expression: "DATE(2026, 3, 1) - 1", Result: "2026-02-28"},
+		{Name: "days after", Expression: "14 + DATE(2026, 10, 17)", Result: "2026-10-31"},
+		{Name: "difference", Expression: "DATE(2026, 12, 25) - DATE(2026, 10, 17)", Result: "69 days"},
+		{Name: "one day", Expression: "DATE(2026, 10, 18) - DATE(2026, 10, 17)", Result: "1 day"},
+		{Name: "days in a duration", Expression: "(DATE(2026, 12, 25) - DATE(2026, 10, 17)) / (DATE(2026, 10, 18) - DATE(2026, 10, 17))", Result: "69"},
+		{Name: "time", Expression: "TIME(1, 30, 0)", Result: "1h30m0s"},
+		{Name: "date and time", Expression: "DATE(2026, 10, 17) + TIME(9, 0, 0)", Result: "2026-10-17 09:00:00"},
+		{Name: "half a day", Expression: "DATE(2026, 10, 17) + 0.5", Result: "2026-10-17 12:00:00"},
+		{Name: "scaled duration", Expression: "TIME(1, 0, 0) * 36", Result: "1d12h0m0s"},
+		{Name: "divided duration", Expression: "TIME(3, 0, 0) / 4", Result: "45m0s"},
+		{Name: "negated duration", Expression: "-TIME(0, 5, 0)", Result: "-5m0s"},
+		{Name: "compare dates", Expression: "DATE(2026, 1, 1) < TODAY()", Result: "true"},
+		{Name: "compare durations", Expression: "TIME(0, 90, 0) == TIME(1, 30, 0)", Result: "true"},
+		{Name: "year", Expression: "YEAR(DATE(2026, 10, 17))", Result: "2026"},
+		{Name: "month", Expression: "MONTH(DATE(2026, 10, 17))", Result: "10"},
+		{Name: "day", Expression: "DAY(DATE(2026, 10, 17))", Result: "17"},
+		{Name: "hour", Expression: "HOUR(NOW())", Result: "14"},
+		{Name: "minute", Expression: "MINUTE(NOW())", Result: "30"},
+		{Name: "weekday", Expression: "WEEKDAY(DATE(2026, 10, 17))", Result: "7"},
+		{Name: "weekday from monday", Expression: "WEEKDAY(DATE(2026, 10, 17), 2)", Result: "6"},
+		{Name: "weekday from zero", Expression: "WEEKDAY(DATE(2026, 10, 19), 3)", Result: "0"},
+		{Name: "edate", Expression: "EDATE(DATE(2026, 10, 17), 3)", Result: "2027-01-17"},
+		{Name: "edate month end", Expression: "EDATE(DATE(2026, 1, 31), 1)", Result: "2026-02-28"},
+		{Name: "edate backwards", Expression: "EDATE(DATE(2026, 3, 31), -1)", Result: "2026-02-28"},
+		{Name: "network days", Expression: "NETWORKDAYS(DATE(2026, 10, 1), DATE(2026, 10, 31))", Result: "22"},
+		{Name: "network days weekend", Expression: "NETWORKDAYS(DATE(2026, 10, 17), DATE(2026, 10, 18))", Result: "0"},
+		{Name: "network days holidays", Expression: "NETWORKDAYS(DATE(2026, 12, 21), DATE(2026, 12, 31), DATE(2026, 12, 25), DATE(2026, 12, 26))", Result: "8"},
+		{Name: "network days reversed", Expression: "NETWORKDAYS(DATE(2026, 10, 23), DATE(2026, 10, 19))", Result: "-5"},
+		{Name: "latest date", Expression: "MAX(DATE(2026, 1, 1), DATE(2026, 6, 1))", Result: "2026-06-01"},
+		{Name: "formula", Dialect: expression.FormulaDialect, Expression: "=EDATE(TODAY(),1)-TODAY()", Result: "31 days"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := tt.Dialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestTemporal_errors(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeInt64(0), nil
+	})
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: "DATE(2026, 10, 17) * 2", Error: "cannot apply * to 2026-10-17 (date) and 2 (number)"},
+		{Expression: "DATE(2026, 10, 17) < 5", Error: "cannot apply < to 2026-10-17 (date) and 5 (number)"},
+		{Expression: `DATE(2026, "10", 17)`, Error: `DATE: argument 2 is "10", not a whole number`},
+		{Expression: "YEAR(2026)", Error: "YEAR: argument 1 is 2026, not a date"},
+		{Expression: "WEEKDAY(DATE(2026, 10, 17), 4)", Error: "WEEKDAY: the weekday numbering must be 1, 2 or 3, got 4"},
+		{Expression: `DATEVALUE("17/10/2026")`, Error: `DATEVALUE: "17/10/2026" is not a date in the form 2006-01-02 or 2006-01-02 15:04:05`},
+		{Expression: "TIME(1, 0, 0) / (TIME(1, 0, 0) - TIME(1, 0, 0))", Error: "division by zero"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.New(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+			var d *expression.Diagnostic
+			assert.True(t, errors.As(err, &d))
+		})
+	}
+
+	t.Run("now defaults to the system clock", func(t *testing.T) {
+		node, err := expression.New("NOW()")
+		require.NoError(t, err)
+		v, err := expression.Evaluate(scope, node)
+		require.NoError(t, err)
+		now := v.(expression.Time).Time()
+		assert.WithinDuration(t, expression.MakeTime(time.Now()).Time(), now, time.Minute)
+	})
+}
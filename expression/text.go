@@ -0,0 +1,209 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatScope is implemented by scopes that display values with the format
+// patterns passed to TEXT. Other scopes only support the empty pattern, which
+// uses the number model.
+type FormatScope interface {
+	FormatValue(v Value, pattern string) (string, error)
+}
+
+// Text functions convert their arguments to text the same way CONCAT does.
+// Positions count characters, not bytes, and start at zero.
+
+func length(args []Value) (Value, error) {
+	return constant.MakeInt64(int64(utf8.RuneCountInString(text(args[0])))), nil
+}
+
+func upper(args []Value) (Value, error) {
+	return constant.MakeString(strings.ToUpper(text(args[0]))), nil
+}
+
+func lower(args []Value) (Value, error) {
+	return constant.MakeString(strings.ToLower(text(args[0]))), nil
+}
+
+// trim removes leading and trailing white space and replaces runs of white
+// space inside the text with a single space.
+func trim(args []Value) (Value, error) {
+	return constant.MakeString(strings.Join(strings.Fields(text(args[0])), " ")), nil
+}
+
+// substr returns the characters from start. Without a length it returns the
+// rest of the text. Ranges past the end of the text are shortened.
+func substr(args []Value) (Value, error) {
+	runes := []rune(text(args[0]))
+	start, err := integerArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("start must not be negative, got %d", start)
+	}
+	start = min(start, len(runes))
+	end := len(runes)
+	if len(args) > 2 {
+		n, err := integerArg(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("length must not be negative, got %d", n)
+		}
+		end = min(start+n, end)
+	}
+	return constant.MakeString(string(runes[start:end])), nil
+}
+
+// find returns the position of the first occurrence of the search text at or
+// after start, or -1 when it does not occur.
+func find(args []Value) (Value, error) {
+	search, s := text(args[0]), text(args[1])
+	start := 0
+	if len(args) > 2 {
+		var err error
+		if start, err = integerArg(args, 2); err != nil {
+			return nil, err
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("start must not be negative, got %d", start)
+		}
+	}
+	offset := 0
+	for range start {
+		if offset == len(s) {
+			return constant.MakeInt64(-1), nil
+		}
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	i := strings.Index(s[offset:], search)
+	if i < 0 {
+		return constant.MakeInt64(-1), nil
+	}
+	return constant.MakeInt64(int64(start + utf8.RuneCountInString(s[offset:offset+i]))), nil
+}
+
+// replace replaces occurrences of old with new. The optional fourth argument
+// limits the number of replacements.
+func replace(args []Value) (Value, error) {
+	n := -1
+	if len(args) > 3 {
+		var err error
+		if n, err = integerArg(args, 3); err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("count must not be negative, got %d", n)
+		}
+	}
+	return constant.MakeString(strings.Replace(text(args[0]), text(args[1]), text(args[2]), n)), nil
+}
+
+// split returns one field of the text separated by sep.
+func split(args []Value) (Value, error) {
+	sep := text(args[1])
+	if sep == "" {
+		return nil, errors.New("separator must not be empty")
+	}
+	fields := strings.Split(text(args[0]), sep)
+	i, err := integerArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(fields) {
+		return nil, fmt.Errorf("field %d is out of range, the text has %d %s", i, len(fields), plural(len(fields), "field"))
+	}
+	return constant.MakeString(fields[i]), nil
+}
+
+// value parses a number. Grouping commas, surrounding white space and a
+// trailing percent sign are allowed. Numbers are returned unchanged.
+func value(args []Value) (Value, error) {
+	if isNumber(args[0]) {
+		return args[0], nil
+	}
+	if !isText(args[0]) {
+		return nil, fmt.Errorf("argument 1 is %s, not text", exactString(args[0]))
+	}
+	s := constant.StringVal(args[0].(constant.Value))
+	n, ok := parseNumber(s)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+func parseNumber(s string) (constant.Value, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	s, percent := strings.CutSuffix(s, "%")
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	kind := token.INT
+	if strings.ContainsAny(s, ".eE") {
+		kind = token.FLOAT
+	}
+	if s == "" || strings.ContainsAny(s, "xXoObB_") {
+		return nil, false
+	}
+	if kind == token.INT {
+		// Leading zeros would make the literal octal.
+		if s = strings.TrimLeft(s, "0"); s == "" {
+			s = "0"
+		}
+	}
+	n := constant.MakeFromLiteral(s, kind, 0)
+	if n.Kind() == constant.Unknown {
+		return nil, false
+	}
+	if negative {
+		n = constant.UnaryOp(token.SUB, n, 0)
+	}
+	if percent {
+		n = constant.BinaryOp(n, token.QUO, constant.MakeInt64(100))
+	}
+	return n, true
+}
+
+// compileText formats a value with the pattern of the scope's number formats.
+func compileText(args []evalFunc) evalFunc {
+	return func(ev *evaluation) (Value, error) {
+		v, err := args[0](ev)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := args[1](ev)
+		if err != nil {
+			return nil, err
+		}
+		if !isText(pattern) {
+			return nil, fmt.Errorf("TEXT: argument 2 is %s, not text", exactString(pattern))
+		}
+		s, err := ev.format(v, constant.StringVal(pattern.(constant.Value)))
+		if err != nil {
+			return nil, fmt.Errorf("TEXT: %w", err)
+		}
+		return constant.MakeString(s), nil
+	}
+}
+
+func (ev *evaluation) format(v Value, pattern string) (string, error) {
+	if formats, ok := ev.scope.(FormatScope); ok {
+		return formats.FormatValue(v, pattern)
+	}
+	if pattern != "" {
+		return "", fmt.Errorf("format %q is not supported here", pattern)
+	}
+	if isText(v) {
+		return text(v), nil
+	}
+	return ev.numeric.Format(v), nil
+}
@@ -0,0 +1,88 @@
+package expression_test
+
+import (
+	"go/constant"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestTextFunctions(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeInt64(42), nil
+	})
+	for _, tt := range []struct {
+		Name       string
+		Dialect    expression.Dialect
+		Expression string
+		Result     string
+	}{
+		{Name: "len", Expression: `LEN("hello")`, Result: "5"},
+		{Name: "len counts characters", Expression: `LEN("héllo, 世界")`, Result: "9"},
+		{Name: "len of a number", Expression: `LEN(A0)`, Result: "2"},
+		{Name: "upper", Expression: `UPPER("crème brûlée")`, Result: `"CRÈME BRÛLÉE"`},
+		{Name: "lower", Expression: `LOWER("ÀBC")`, Result: `"àbc"`},
+		{Name: "trim", Expression: `TRIM("  a   b\tc ")`, Result: `"a b c"`},
+		{Name: "substr", Expression: `SUBSTR("hello", 1, 3)`, Result: `"ell"`},
+		{Name: "substr rest", Expression: `SUBSTR("hello", 2)`, Result: `"llo"`},
+		{Name: "substr characters", Expression: `SUBSTR("日本語テキスト", 3, 4)`, Result: `"テキスト"`},
+		{Name: "substr past the end", Expression: `SUBSTR("abc", 2, 10)`, Result: `"c"`},
+		{Name: "substr after the end", Expression: `SUBSTR("abc", 5)`, Result: `""`},
+		{Name: "find", Expression: `FIND("lo", "hello")`, Result: "3"},
+		{Name: "find characters", Expression: `FIND("界", "世界")`, Result: "1"},
+		{Name: "find from", Expression: `FIND("l", "hello", 3)`, Result: "3"},
+		{Name: "find missing", Expression: `FIND("z", "hello")`, Result: "-1"},
+		{Name: "find from after the end", Expression: `FIND("", "abc", 4)`, Result: "-1"},
+		{Name: "replace", Expression: `REPLACE("a-b-c", "-", "/")`, Result: `"a/b/c"`},
+		{Name: "replace count", Expression: `REPLACE("a-b-c", "-", "/", 1)`, Result: `"a/b-c"`},
+		{Name: "split", Expression: `SPLIT("2026-10-17", "-", 1)`, Result: `"10"`},
+		{Name: "split characters", Expression: `SPLIT("α→β→γ", "→", 2)`, Result: `"γ"`},
+		{Name: "key", Expression: `UPPER(CONCAT(SUBSTR("widget", 0, 3), "-", A0))`, Result: `"WID-42"`},
+		{Name: "value", Expression: `VALUE("1,234.5")`, Result: "2469/2"},
+		{Name: "value percent", Expression: `VALUE(" 15% ")`, Result: "3/20"},
+		{Name: "value negative", Expression: `VALUE("-007")`, Result: "-7"},
+		{Name: "value of a number", Expression: `VALUE(A0)`, Result: "42"},
+		{Name: "text without a format", Expression: `TEXT(1 / 4, "")`, Result: `"0.25"`},
+		{Name: "formula", Dialect: expression.FormulaDialect, Expression: `=LEN(TRIM(" a "))&UPPER("b")`, Result: `"1B"`},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := tt.Dialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.(constant.Value).ExactString())
+		})
+	}
+}
+
+func TestTextFunctions_errors(t *testing.T) {
+	scope := fakeScopeFunc(func(string) (constant.Value, error) {
+		return constant.MakeInt64(0), nil
+	})
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+	}{
+		{Expression: `SUBSTR("abc", -1)`, Error: "SUBSTR: start must not be negative, got -1"},
+		{Expression: `SUBSTR("abc", 0, -1)`, Error: "SUBSTR: length must not be negative, got -1"},
+		{Expression: `SUBSTR("abc", "1")`, Error: `SUBSTR: argument 2 is "1", not a whole number`},
+		{Expression: `SPLIT("a,b", ",", 2)`, Error: "SPLIT: field 2 is out of range, the text has 2 fields"},
+		{Expression: `SPLIT("a,b", "", 0)`, Error: "SPLIT: separator must not be empty"},
+		{Expression: `VALUE("12 apples")`, Error: `VALUE: "12 apples" is not a number`},
+		{Expression: `VALUE("0x10")`, Error: `VALUE: "0x10" is not a number`},
+		{Expression: `VALUE(true)`, Error: "VALUE: argument 1 is true, not text"},
+		{Expression: `TEXT(1, "0.00")`, Error: `TEXT: format "0.00" is not supported here`},
+		{Expression: `TEXT(1, 2)`, Error: "TEXT: argument 2 is 2, not text"},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.New(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Quantity is a number with a unit of measure. Names of units, such as km,
+// evaluate to a quantity of one, so 5 * km is five kilometres; the formula
+// dialect also accepts 5 km. Quantities of the same dimension can be added,
+// subtracted and compared. Multiplying and dividing combines their units and
+// gives a number when the units cancel.
+type Quantity struct {
+	number constant.Value
+	unit   Unit
+}
+
+// Number returns the number of units.
+func (q Quantity) Number() constant.Value { return q.number }
+
+// Unit returns the unit of measure.
+func (q Quantity) Unit() Unit { return q.unit }
+
+func (q Quantity) String() string {
+	return q.number.String() + " " + q.unit.String()
+}
+
+func isQuantity(v Value) bool {
+	_, ok := v.(Quantity)
+	return ok
+}
+
+// quantity returns a number in a unit or the number when the unit has no
+// terms.
+func quantity(n constant.Value, u Unit) Value {
+	if len(u.terms) == 0 {
+		return n
+	}
+	return Quantity{number: n, unit: u}
+}
+
+// DimensionError is returned when an operator combines values that measure
+// different things, such as metres and seconds or metres and a number.
+type DimensionError struct {
+	Op   token.Token
+	X, Y Value
+}
+
+func (e *DimensionError) Error() string {
+	if isMoney(e.X) && isMoney(e.Y) {
+		return fmt.Sprintf("cannot apply %s to %s and %s, which are in different currencies; convert one of them with FX", e.Op, e.X, e.Y)
+	}
+	return fmt.Sprintf("cannot apply %s to %s and %s, which have different dimensions", e.Op, e.X, e.Y)
+}
+
+// Unit is a product of units of measure raised to whole powers, such as
+// km/h or kg*m/s^2.
+type Unit struct {
+	terms []unitTerm
+}
+
+type unitTerm struct {
+	symbol string
+	power  int
+}
+
+// String writes the terms with positive powers separated by * followed by
+// the others each after a /, for example W/m^2/K.
+func (u Unit) String() string {
+	var numerator, denominator strings.Builder
+	for _, t := range u.terms {
+		sb, power := &numerator, t.power
+		if power < 0 {
+			sb, power = &denominator, -power
+		} else if sb.Len() > 0 {
+			sb.WriteByte('*')
+		}
+		if sb == &denominator {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(t.symbol)
+		if power != 1 {
+			sb.WriteString("^" + strconv.Itoa(power))
+		}
+	}
+	if numerator.Len() == 0 && denominator.Len() > 0 {
+		numerator.WriteByte('1')
+	}
+	return numerator.String() + denominator.String()
+}
+
+// dimension is the product of base units, and currencies, that a unit
+// measures; {"m": 1, "s": -1} is a speed.
+type dimension map[string]int
+
+func (u Unit) dimension() dimension {
+	result := dimension{}
+	for _, t := range u.terms {
+		for base, power := range units[t.symbol].dimension {
+			result[base] += power * t.power
+			if result[base] == 0 {
+				delete(result, base)
+			}
+		}
+	}
+	return result
+}
+
+func (u Unit) sameDimension(v Unit) bool {
+	return maps.Equal(u.dimension(), v.dimension())
+}
+
+// scale returns the size of the unit in the base units of its dimension.
+func (u Unit) scale() constant.Value {
+	result := constant.MakeInt64(1)
+	for _, t := range u.terms {
+		result = constant.BinaryOp(result, token.MUL, powerOf(units[t.symbol].scale, t.power))
+	}
+	return result
+}
+
+// conversion returns the factor that converts a number in u to v.
+func (u Unit) conversion(v Unit) constant.Value {
+	return constant.BinaryOp(u.scale(), token.QUO, v.scale())
+}
+
+func (u Unit) pow(n int) Unit {
+	result := Unit{}
+	if n == 0 {
+		return result
+	}
+	for _, t := range u.terms {
+		result.terms = append(result.terms, unitTerm{symbol: t.symbol, power: t.power * n})
+	}
+	return result
+}
+
+// times multiplies u by v raised to sign, which is 1 or -1. A term of v that
+// measures the same thing as a term of u under another name is converted to
+// it, so km * m is km^2. The number in the result is multiplied by factor.
+func (u Unit) times(v Unit, sign int) (Unit, constant.Value) {
+	factor := constant.MakeInt64(1)
+	for _, t := range v.terms {
+		t.power *= sign
+		for _, r := range u.terms {
+			if r.symbol != t.symbol && maps.Equal(units[r.symbol].dimension, units[t.symbol].dimension) {
+				ratio := constant.BinaryOp(units[t.symbol].scale, token.QUO, units[r.symbol].scale)
+				factor = constant.BinaryOp(factor, token.MUL, powerOf(ratio, t.power))
+				t.symbol = r.symbol
+				break
+			}
+		}
+		u = u.with(t)
+	}
+	return u, factor
+}
+
+// powerOf raises an exact number to a whole power.
+func powerOf(x constant.Value, n int) constant.Value {
+	result := constant.MakeInt64(1)
+	for range max(n, -n) {
+		result = constant.BinaryOp(result, token.MUL, x)
+	}
+	if n < 0 {
+		return constant.BinaryOp(constant.MakeInt64(1), token.QUO, result)
+	}
+	return result
+}
+
+// ParseUnit parses units in the form written by Unit.String. Terms are
+// separated by * or /, may be raised to a whole power with ^ and the
+// numerator may be 1, as in 1/s.
+func ParseUnit(s string) (Unit, error) {
+	var u Unit
+	rest, sign := strings.TrimSpace(s), 1
+	for first := true; ; first = false {
+		end := strings.IndexAny(rest, "*/")
+		if end < 0 {
+			end = len(rest)
+		}
+		term := strings.TrimSpace(rest[:end])
+		if !first || term != "1" || end == len(rest) || rest[end] != '/' {
+			t, err := parseUnitTerm(term, s)
+			if err != nil {
+				return Unit{}, err
+			}
+			t.power *= sign
+			u = u.with(t)
+		}
+		if end == len(rest) {
+			break
+		}
+		sign = 1
+		if rest[end] == '/' {
+			sign = -1
+		}
+		rest = rest[end+1:]
+	}
+	if len(u.terms) == 0 {
+		return Unit{}, fmt.Errorf("%q is not a unit", s)
+	}
+	return u, nil
+}
+
+// with multiplies u by a term, adding its power to a term with the same
+// symbol.
+func (u Unit) with(t unitTerm) Unit {
+	terms := slices.Clone(u.terms)
+	i := slices.IndexFunc(terms, func(r unitTerm) bool { return r.symbol == t.symbol })
+	switch {
+	case i < 0:
+		terms = append(terms, t)
+	case terms[i].power+t.power == 0:
+		terms = slices.Delete(terms, i, i+1)
+	default:
+		terms[i].power += t.power
+	}
+	return Unit{terms: terms}
+}
+
+func parseUnitTerm(term, unit string) (unitTerm, error) {
+	symbol, exponent, hasExponent := strings.Cut(term, "^")
+	symbol = strings.TrimSpace(symbol)
+	power := 1
+	if hasExponent {
+		n, err := strconv.Atoi(strings.TrimSpace(exponent))
+		if err != nil || n == 0 {
+			return unitTerm{}, fmt.Errorf("%q is not a unit", unit)
+		}
+		power = n
+	}
+	if _, ok := units[symbol]; !ok {
+		if symbol == "" {
+			return unitTerm{}, fmt.Errorf("%q is not a unit", unit)
+		}
+		return unitTerm{}, fmt.Errorf("unknown unit %s", symbol)
+	}
+	return unitTerm{symbol: symbol, power: power}, nil
+}
+
+// namedUnit returns the unit with a symbol such as km.
+func namedUnit(symbol string) (Unit, bool) {
+	_, ok := units[symbol]
+	return Unit{terms: []unitTerm{{symbol: symbol, power: 1}}}, ok
+}
+
+// quantityOp applies op to operands where at least one is a Quantity.
+// Numbers are quantities without a unit.
+func quantityOp(x Value, op token.Token, y Value) (Value, error) {
+	a, aok := toQuantity(x)
+	b, bok := toQuantity(y)
+	if !aok || !bok {
+		return nil, &TypeError{Op: op, X: x, Y: y}
+	}
+	switch op {
+	case token.ADD, token.SUB, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if !a.unit.sameDimension(b.unit) {
+			return nil, &DimensionError{Op: op, X: x, Y: y}
+		}
+		n := constant.BinaryOp(b.number, token.MUL, b.unit.conversion(a.unit))
+		v, err := constantOp(a.number, op, n)
+		if err != nil || op != token.ADD && op != token.SUB {
+			return v, err
+		}
+		return quantity(v.(constant.Value), a.unit), nil
+	case token.MUL, token.QUO:
+		sign := 1
+		if op == token.QUO {
+			sign = -1
+		}
+		unit, factor := a.unit.times(b.unit, sign)
+		v, err := constantOp(a.number, op, b.number)
+		if err != nil {
+			return nil, err
+		}
+		return quantity(constant.BinaryOp(v.(constant.Value), token.MUL, factor), unit), nil
+	}
+	return nil, &TypeError{Op: op, X: x, Y: y}
+}
+
+func toQuantity(x Value) (Quantity, bool) {
+	if q, ok := x.(Quantity); ok {
+		return q, true
+	}
+	n, ok := toNumber(x)
+	return Quantity{number: n}, ok
+}
+
+// convert converts a quantity to another unit of the same dimension:
+// CONVERT(quantity, unit). A number is given the unit instead.
+func convert(args []Value) (Value, error) {
+	if !isText(args[1]) {
+		return nil, fmt.Errorf("argument 2 is %s, not text", exactString(args[1]))
+	}
+	to, err := ParseUnit(constant.StringVal(args[1].(constant.Value)))
+	if err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case Quantity:
+		if !x.unit.sameDimension(to) {
+			return nil, fmt.Errorf("cannot convert %s to %s", x, to)
+		}
+		return Quantity{number: constant.BinaryOp(x.number, token.MUL, x.unit.conversion(to)), unit: to}, nil
+	default:
+		if !isNumber(x) {
+			return nil, fmt.Errorf("argument 1 is %s, not a number", exactString(x))
+		}
+		return Quantity{number: x.(constant.Value), unit: to}, nil
+	}
+}
+
+// powerQuantity raises a quantity to a whole power.
+func powerQuantity(q Quantity, exponent Value) (Value, error) {
+	n, ok := wholeNumber(exponent)
+	p, exact := constant.Int64Val(n)
+	if !ok || !exact || p < -maxExactExponent || p > maxExactExponent {
+		return nil, errors.New("a quantity can only be raised to a whole number power")
+	}
+	v, err := power([]Value{q.number, n})
+	if err != nil {
+		return nil, err
+	}
+	return quantity(v.(constant.Value), q.unit.pow(int(p))), nil
+}
+
+type unitDefinition struct {
+	dimension dimension
+	scale     constant.Value // in the base units of the dimension
+}
+
+// units are the units of measure by symbol. Each is a multiple of the SI
+// base units of its dimension. Bytes and currencies are base units of
+// their own; currencies can not be converted into each other.
+var units = map[string]unitDefinition{}
+
+func init() {
+	var (
+		length      = dimension{"m": 1}
+		mass        = dimension{"kg": 1}
+		duration    = dimension{"s": 1}
+		area        = dimension{"m": 2}
+		volume      = dimension{"m": 3}
+		force       = dimension{"kg": 1, "m": 1, "s": -2}
+		energy      = dimension{"kg": 1, "m": 2, "s": -2}
+		power       = dimension{"kg": 1, "m": 2, "s": -3}
+		pressure    = dimension{"kg": 1, "m": -1, "s": -2}
+		information = dimension{"B": 1}
+	)
+	for _, u := range []struct {
+		symbol, scale string
+		dimension     dimension
+	}{
+		{"m", "1", length}, {"km", "1000", length}, {"cm", "0.01", length}, {"mm", "0.001", length},
+		{"in", "0.0254", length}, {"ft", "0.3048", length}, {"yd", "0.9144", length}, {"mi", "1609.344", length}, {"nmi", "1852", length},
+		{"kg", "1", mass}, {"g", "0.001", mass}, {"mg", "0.000001", mass}, {"t", "1000", mass},
+		{"lb", "0.45359237", mass}, {"oz", "0.028349523125", mass},
+		{"s", "1", duration}, {"ms", "0.001", duration}, {"min", "60", duration}, {"h", "3600", duration},
+		{"d", "86400", duration}, {"wk", "604800", duration}, {"yr", "31557600", duration},
+		{"A", "1", dimension{"A": 1}}, {"K", "1", dimension{"K": 1}}, {"mol", "1", dimension{"mol": 1}},
+		{"ha", "10000", area}, {"L", "0.001", volume}, {"mL", "0.000001", volume},
+		{"Hz", "1", dimension{"s": -1}}, {"N", "1", force}, {"kN", "1000", force},
+		{"J", "1", energy}, {"kJ", "1000", energy}, {"MJ", "1000000", energy}, {"cal", "4.184", energy}, {"kcal", "4184", energy},
+		{"Wh", "3600", energy}, {"kWh", "3600000", energy},
+		{"W", "1", power}, {"kW", "1000", power}, {"MW", "1000000", power},
+		{"Pa", "1", pressure}, {"kPa", "1000", pressure}, {"bar", "100000", pressure}, {"psi", "6894.757293168", pressure},
+		{"V", "1", dimension{"kg": 1, "m": 2, "s": -3, "A": -1}},
+		{"B", "1", information}, {"kB", "1000", information}, {"MB", "1e6", information}, {"GB", "1e9", information}, {"TB", "1e12", information},
+		{"KiB", "1024", information}, {"MiB", "1048576", information}, {"GiB", "1073741824", information}, {"bit", "0.125", information},
+	} {
+		units[u.symbol] = unitDefinition{dimension: u.dimension, scale: constant.MakeFromLiteral(u.scale, token.FLOAT, 0)}
+	}
+	for _, code := range currencies {
+		units[code] = unitDefinition{dimension: dimension{code: 1}, scale: constant.MakeInt64(1)}
+	}
+}
+
+// currencies are the ISO 4217 codes that can be used as units.
+var currencies = []string{
+	"AUD", "BRL", "CAD", "CHF", "CNY", "DKK", "EUR", "GBP", "HKD", "INR",
+	"JPY", "KRW", "MXN", "NOK", "NZD", "SEK", "SGD", "USD", "ZAR",
+}
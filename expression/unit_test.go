@@ -0,0 +1,136 @@
+package expression_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice/expression"
+)
+
+func TestQuantity(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Name       string
+		Dialect    expression.Dialect
+		Expression string
+		Result     string
+	}{
+		{Name: "go dialect", Dialect: expression.GoDialect, Expression: "B1 * m + 30 * cm", Result: "7.3 m"},
+		{Name: "unit name", Dialect: expression.FormulaDialect, Expression: "=km", Result: "1 km"},
+		{Name: "multiplied", Dialect: expression.FormulaDialect, Expression: "=5 * km", Result: "5 km"},
+		{Name: "written after", Dialect: expression.FormulaDialect, Expression: "=5 km", Result: "5 km"},
+		{Name: "converted to the left unit", Dialect: expression.FormulaDialect, Expression: "=5 km + 300 m", Result: "5.3 km"},
+		{Name: "subtraction", Dialect: expression.FormulaDialect, Expression: "=1 h - 15 min", Result: "0.75 h"},
+		{Name: "speed", Dialect: expression.FormulaDialect, Expression: "=100 m / 20 s", Result: "5 m/s"},
+		{Name: "area", Dialect: expression.FormulaDialect, Expression: "=2 km * 500 m", Result: "1 km^2"},
+		{Name: "units cancel", Dialect: expression.FormulaDialect, Expression: "=2 km / 500 m", Result: "4"},
+		{Name: "power of a unit", Dialect: expression.FormulaDialect, Expression: "=5 m^2", Result: "5 m^2"},
+		{Name: "power of a quantity", Dialect: expression.FormulaDialect, Expression: "=(3 m)^2", Result: "9 m^2"},
+		{Name: "number times quantity", Dialect: expression.FormulaDialect, Expression: "=B0 * 2 kg", Result: "6 kg"},
+		{Name: "negated", Dialect: expression.FormulaDialect, Expression: "=-(3 m)", Result: "-3 m"},
+		{Name: "compound", Dialect: expression.FormulaDialect, Expression: "=10 kg * 9.81 m/s^2", Result: "98.1 kg*m/s^2"},
+		{Name: "inverse", Dialect: expression.FormulaDialect, Expression: "=1 / 4 s", Result: "0.25 1/s"},
+		{Name: "comparison", Dialect: expression.FormulaDialect, Expression: "=1 km > 900 m", Result: "true"},
+		{Name: "equal in other units", Dialect: expression.FormulaDialect, Expression: "=1 ft = 12 in", Result: "true"},
+		{Name: "currency", Dialect: expression.FormulaDialect, Expression: "=3 USD + 2 USD", Result: "5 USD"},
+		{Name: "sum", Dialect: expression.FormulaDialect, Expression: "=SUM(1 m, 2 m, 50 cm)", Result: "3.5 m"},
+		{Name: "average", Dialect: expression.FormulaDialect, Expression: `=AVERAGE(CONVERT(1, "m"), CONVERT(3, "m"))`, Result: "2 m"},
+		{Name: "average in other units", Dialect: expression.FormulaDialect, Expression: "=AVERAGE(1 km, 500 m)", Result: "0.75 km"},
+		{Name: "convert", Dialect: expression.FormulaDialect, Expression: `=CONVERT(36 km/h, "m/s")`, Result: "10 m/s"},
+		{Name: "convert derived", Dialect: expression.FormulaDialect, Expression: `=CONVERT(10 kg * 9.81 m/s^2, "N")`, Result: "98.1 N"},
+		{Name: "convert energy", Dialect: expression.FormulaDialect, Expression: `=CONVERT(1 kWh, "MJ")`, Result: "3.6 MJ"},
+		{Name: "convert number", Dialect: expression.FormulaDialect, Expression: `=CONVERT(B1, "kg")`, Result: "7 kg"},
+		{Name: "divide by a unit", Dialect: expression.FormulaDialect, Expression: "=2500 m / km", Result: "2.5"},
+		{Name: "bound name", Dialect: expression.FormulaDialect, Expression: "=LET(m, 2, m * 3)", Result: "6"},
+		{Name: "concatenation", Dialect: expression.FormulaDialect, Expression: `="about " & 5 km`, Result: `"about 5 km"`},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			node, err := tt.Dialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			v, err := expression.Evaluate(scope, node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Result, v.String())
+		})
+	}
+}
+
+func TestQuantity_errors(t *testing.T) {
+	scope := fruit()
+	for _, tt := range []struct {
+		Expression string
+		Error      string
+		Span       string
+		Dimension  bool
+	}{
+		{Expression: "=1 m + 1 s", Error: "cannot apply + to 1 m and 1 s, which have different dimensions", Span: "1 m + 1 s", Dimension: true},
+		{Expression: "=B1 + 1 m", Error: "cannot apply + to 7 and 1 m, which have different dimensions", Span: "B1 + 1 m", Dimension: true},
+		{Expression: "=3 USD < 2 EUR", Error: "cannot apply < to 3 USD and 2 EUR, which are in different currencies; convert one of them with FX", Span: "3 USD < 2 EUR", Dimension: true},
+		{Expression: "=(1 m)^0.5", Error: "POWER: a quantity can only be raised to a whole number power", Span: "(1 m)^0.5"},
+		{Expression: "=(1 m)^-9223372036854775808", Error: "POWER: a quantity can only be raised to a whole number power", Span: "(1 m)^-9223372036854775808"},
+		{Expression: `=CONVERT(1 m, "s")`, Error: "CONVERT: cannot convert 1 m to s", Span: `CONVERT(1 m, "s")`},
+		{Expression: `=CONVERT(1, "furlong")`, Error: "CONVERT: unknown unit furlong", Span: `CONVERT(1, "furlong")`},
+		{Expression: `=CONVERT(1, "m/")`, Error: `CONVERT: "m/" is not a unit`, Span: `CONVERT(1, "m/")`},
+		{Expression: `=SUM(1 m, "a")`, Error: `SUM: argument 2 is "a", not a number`, Span: `SUM(1 m, "a")`},
+		{Expression: "=AVERAGE(1 m, 1 s)", Error: "AVERAGE: cannot apply + to 1 m and 1 s, which have different dimensions", Span: "AVERAGE(1 m, 1 s)", Dimension: true},
+	} {
+		t.Run(tt.Expression, func(t *testing.T) {
+			node, err := expression.FormulaDialect.Parse(tt.Expression)
+			require.NoError(t, err)
+			_, err = expression.Evaluate(scope, node)
+			require.Error(t, err)
+			assert.Equal(t, tt.Error, err.Error())
+			var d *expression.Diagnostic
+			require.ErrorAs(t, err, &d)
+			assert.Equal(t, tt.Span, tt.Expression[d.Start:d.End])
+			var dimensionErr *expression.DimensionError
+			assert.Equal(t, tt.Dimension, errors.As(err, &dimensionErr))
+		})
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	for _, tt := range []struct {
+		Unit, String string
+	}{
+		{Unit: "km", String: "km"},
+		{Unit: " kg * m / s^2 ", String: "kg*m/s^2"},
+		{Unit: "1/s", String: "1/s"},
+		{Unit: "W/m^2/K", String: "W/m^2/K"},
+		{Unit: "m*m", String: "m^2"},
+		{Unit: "s^-1", String: "1/s"},
+	} {
+		t.Run(tt.Unit, func(t *testing.T) {
+			u, err := expression.ParseUnit(tt.Unit)
+			require.NoError(t, err)
+			assert.Equal(t, tt.String, u.String())
+		})
+	}
+	for _, tt := range []struct {
+		Unit, Error string
+	}{
+		{Unit: "", Error: `"" is not a unit`},
+		{Unit: "m/m", Error: `"m/m" is not a unit`},
+		{Unit: "m^x", Error: `"m^x" is not a unit`},
+		{Unit: "parsec", Error: "unknown unit parsec"},
+	} {
+		t.Run(tt.Unit, func(t *testing.T) {
+			_, err := expression.ParseUnit(tt.Unit)
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
+
+func TestQuantity_format(t *testing.T) {
+	node, err := expression.FormulaDialect.Parse("=5 km^2+3 USD*2")
+	require.NoError(t, err)
+	s, err := expression.FormulaDialect.Format(node)
+	require.NoError(t, err)
+	assert.Equal(t, "=5 km ^ 2 + 3 USD * 2", s)
+
+	node, err = expression.FormulaDialect.Parse("=3 A1")
+	require.Error(t, err)
+	assert.Nil(t, node)
+}
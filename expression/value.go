@@ -0,0 +1,77 @@
+package expression
+
+import (
+	"fmt"
+	"go/constant"
+	"slices"
+)
+
+// Value is the result of evaluating an expression. Numbers, text and
+// booleans are constant.Value, points in time are Time, lengths of time are
+// Duration and numbers with units of measure are Quantity.
+type Value interface {
+	String() string
+}
+
+// Blank is the value of a cell without an expression. A Lookup may return it
+// from ResolveCell. Functions such as AVERAGE and COUNT skip blank cells in
+// ranges; everywhere else a blank cell is zero.
+type Blank struct{}
+
+func (Blank) String() string { return "" }
+
+func isBlank(v Value) bool {
+	_, ok := v.(Blank)
+	return ok
+}
+
+func zeroIfBlank(v Value) Value {
+	if isBlank(v) {
+		return constant.MakeInt64(0)
+	}
+	return v
+}
+
+// skipBlanks removes blank values in place.
+func skipBlanks(args []Value) []Value {
+	return slices.DeleteFunc(args, isBlank)
+}
+
+func isBool(v Value) bool {
+	c, ok := v.(constant.Value)
+	return ok && c.Kind() == constant.Bool
+}
+
+func isText(v Value) bool {
+	c, ok := v.(constant.Value)
+	return ok && c.Kind() == constant.String
+}
+
+func describe(v Value) string {
+	return fmt.Sprintf("%s (%s)", v.String(), kindName(v))
+}
+
+func kindName(v Value) string {
+	switch v := v.(type) {
+	case constant.Value:
+		switch v.Kind() {
+		case constant.Bool:
+			return "boolean"
+		case constant.String:
+			return "text"
+		case constant.Int, constant.Float:
+			return "number"
+		}
+	case Time:
+		return "date"
+	case Duration:
+		return "duration"
+	case Blank:
+		return "blank"
+	case Lambda:
+		return "function"
+	case Quantity:
+		return "quantity"
+	}
+	return "unknown"
+}
@@ -0,0 +1,376 @@
+package clice
+
+import (
+	"fmt"
+	"go/constant"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// NumberFormat is a display pattern for numbers using a subset of the
+// spreadsheet format syntax:
+//
+//	#,##0.00      grouping separators and two decimals
+//	$#,##0.00     a currency symbol; any text before or after the digits is kept
+//	0.0%          a percentage, the number is multiplied by 100
+//	0.00E+00      scientific notation
+//	#,##0;(#,##0) a second section for negative numbers, shown without a minus sign
+//
+// A 0 is a required digit and # an optional one. Patterns without digit
+// placeholders display dates:
+//
+//	yyyy-mm-dd        2026-10-17
+//	dddd, mmmm d, yy  Saturday, October 17, 26
+//	h:mm AM/PM        3:04 PM
+//
+// where m is a minute when it follows an hour or comes before a second. The
+// zero value displays numbers using the table's number model.
+type NumberFormat struct {
+	pattern  string
+	positive numberSection
+	negative *numberSection
+	date     []datePart
+}
+
+type numberSection struct {
+	prefix, suffix    string
+	integerDigits     int // required digits before the decimal point
+	decimals          int // required digits after the decimal point
+	optionalDecimals  int
+	grouping, percent bool
+	exponentDigits    int // greater than zero for scientific notation
+}
+
+func ParseNumberFormat(pattern string) (NumberFormat, error) {
+	if pattern == "" {
+		return NumberFormat{}, nil
+	}
+	if !strings.ContainsAny(pattern, "0#") {
+		date, err := parseDateFormat(pattern)
+		if err != nil {
+			return NumberFormat{}, fmt.Errorf("number format %q: %w", pattern, err)
+		}
+		return NumberFormat{pattern: pattern, date: date}, nil
+	}
+	sections := strings.Split(pattern, ";")
+	if len(sections) > 2 {
+		return NumberFormat{}, fmt.Errorf("number format %q has more than two sections", pattern)
+	}
+	f := NumberFormat{pattern: pattern}
+	var err error
+	f.positive, err = parseNumberSection(sections[0])
+	if err != nil {
+		return NumberFormat{}, fmt.Errorf("number format %q: %w", pattern, err)
+	}
+	if len(sections) == 2 {
+		negative, err := parseNumberSection(sections[1])
+		if err != nil {
+			return NumberFormat{}, fmt.Errorf("number format %q: %w", pattern, err)
+		}
+		f.negative = &negative
+	}
+	return f, nil
+}
+
+func parseNumberSection(s string) (numberSection, error) {
+	start := strings.IndexAny(s, "0#")
+	if start < 0 {
+		return numberSection{}, fmt.Errorf("section %q has no digit placeholder 0 or #", s)
+	}
+	if i := strings.IndexByte(s[:start], '.'); i >= 0 {
+		start = i
+	}
+	section := numberSection{prefix: unquote(s[:start])}
+	end := start
+	inDecimals := false
+digits:
+	for ; end < len(s); end++ {
+		switch c := s[end]; {
+		case c == '.' && !inDecimals:
+			inDecimals = true
+		case c == ',' && !inDecimals:
+			section.grouping = true
+		case c == '0' && inDecimals:
+			if section.optionalDecimals > 0 {
+				return numberSection{}, fmt.Errorf("section %q has a 0 after a # in the decimals", s)
+			}
+			section.decimals++
+		case c == '#' && inDecimals:
+			section.optionalDecimals++
+		case c == '0':
+			section.integerDigits++
+		case c == '#':
+		default:
+			break digits
+		}
+	}
+	rest := s[end:]
+	if len(rest) >= 2 && (rest[0] == 'E' || rest[0] == 'e') && (rest[1] == '+' || rest[1] == '-') {
+		n := 2
+		for n < len(rest) && rest[n] == '0' {
+			n++
+		}
+		if n == 2 {
+			return numberSection{}, fmt.Errorf("section %q needs at least one 0 after %s", s, rest[:2])
+		}
+		section.exponentDigits = n - 2
+		rest = rest[n:]
+	}
+	section.suffix = unquote(rest)
+	section.percent = strings.Contains(section.suffix, "%")
+	return section, nil
+}
+
+// unquote removes the double quotes used to mark literal text.
+func unquote(s string) string {
+	return strings.ReplaceAll(s, `"`, "")
+}
+
+// String returns the pattern passed to ParseNumberFormat.
+func (f NumberFormat) String() string {
+	return f.pattern
+}
+
+func (f NumberFormat) IsZero() bool {
+	return f.pattern == ""
+}
+
+// Format displays a number, or a date when the pattern is a date format.
+// The number of a quantity is followed by its unit. Other values are
+// returned using their String method.
+func (f NumberFormat) Format(value expression.Value) string {
+	if q, ok := value.(expression.Quantity); ok && f.date == nil && !f.IsZero() {
+		return f.Format(q.Number()) + " " + q.Unit().String()
+	}
+	if t, ok := value.(expression.Time); ok && f.date != nil {
+		return formatDate(f.date, t.Time())
+	}
+	v, ok := value.(constant.Value)
+	if f.IsZero() || f.date != nil || !ok || (v.Kind() != constant.Int && v.Kind() != constant.Float) {
+		return value.String()
+	}
+	r := expression.Rat(v)
+	section := f.positive
+	negative := r.Sign() < 0
+	if negative {
+		r.Neg(r)
+	}
+	digits := section.format(r)
+	if negative && strings.Trim(digits, "0.,") == "" && section.exponentDigits == 0 {
+		negative = false
+	}
+	switch {
+	case negative && f.negative != nil:
+		return f.negative.prefix + f.negative.format(r) + f.negative.suffix
+	case negative:
+		return "-" + section.prefix + digits + section.suffix
+	default:
+		return section.prefix + digits + section.suffix
+	}
+}
+
+// format returns the digits of the non-negative number r.
+func (section numberSection) format(r *big.Rat) string {
+	if section.percent {
+		r = new(big.Rat).Mul(r, big.NewRat(100, 1))
+	}
+	decimals := section.decimals + section.optionalDecimals
+	if section.exponentDigits > 0 {
+		text := new(big.Float).SetPrec(256).SetRat(r).Text('e', decimals)
+		mantissa, exponent, _ := strings.Cut(text, "e")
+		n, _ := strconv.Atoi(exponent)
+		sign := "+"
+		if n < 0 {
+			sign, n = "-", -n
+		}
+		exp := strconv.Itoa(n)
+		if len(exp) < section.exponentDigits {
+			exp = strings.Repeat("0", section.exponentDigits-len(exp)) + exp
+		}
+		return section.trimDecimals(mantissa) + "E" + sign + exp
+	}
+	integer, fraction, _ := strings.Cut(r.FloatString(decimals), ".")
+	if integer == "0" && section.integerDigits == 0 {
+		integer = ""
+	}
+	if len(integer) < section.integerDigits {
+		integer = strings.Repeat("0", section.integerDigits-len(integer)) + integer
+	}
+	if section.grouping {
+		integer = group(integer)
+	}
+	if decimals == 0 {
+		return integer
+	}
+	return section.trimDecimals(integer + "." + fraction)
+}
+
+// trimDecimals removes trailing zeros from optional decimals.
+func (section numberSection) trimDecimals(s string) string {
+	integer, fraction, ok := strings.Cut(s, ".")
+	if !ok {
+		return s
+	}
+	for len(fraction) > section.decimals && strings.HasSuffix(fraction, "0") {
+		fraction = fraction[:len(fraction)-1]
+	}
+	if fraction == "" {
+		return integer
+	}
+	return integer + "." + fraction
+}
+
+func group(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var sb strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		sb.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(digits[i : i+3])
+	}
+	return sb.String()
+}
+
+// datePart is a run of one date letter, such as yyyy, or literal text when
+// code is zero.
+type datePart struct {
+	code  byte // y, m, d, h, s, M for minutes or A for AM/PM
+	count int
+	text  string
+}
+
+func parseDateFormat(pattern string) ([]datePart, error) {
+	var parts []datePart
+	for i := 0; i < len(pattern); {
+		switch c := pattern[i]; {
+		case c == '"':
+			end := strings.IndexByte(pattern[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing quote")
+			}
+			parts = append(parts, datePart{text: pattern[i+1 : i+1+end]})
+			i += end + 2
+		case strings.HasPrefix(strings.ToUpper(pattern[i:]), "AM/PM"):
+			parts = append(parts, datePart{code: 'A'})
+			i += len("AM/PM")
+		case strings.IndexByte("ymdhs", c) >= 0:
+			n := 1
+			for i+n < len(pattern) && pattern[i+n] == c {
+				n++
+			}
+			parts = append(parts, datePart{code: c, count: n})
+			i += n
+		case unicode.IsLetter(rune(c)):
+			return nil, fmt.Errorf("pattern has no digit placeholder 0 or # and %q is not a date field", c)
+		default:
+			parts = append(parts, datePart{text: string(c)})
+			i++
+		}
+	}
+	hasDate := false
+	for i, part := range parts {
+		if part.code == 'm' && (part.count <= 2 && (previousCode(parts, i) == 'h' || nextCode(parts, i) == 's')) {
+			parts[i].code = 'M'
+		}
+		longest := map[byte]int{'y': 4, 'm': 4, 'd': 4, 'h': 2, 's': 2}[part.code]
+		if part.count > longest || (part.code == 'y' && part.count != 2 && part.count != 4) {
+			return nil, fmt.Errorf("%s is not a date field", strings.Repeat(string(part.code), part.count))
+		}
+		hasDate = hasDate || part.code != 0
+	}
+	if !hasDate {
+		return nil, fmt.Errorf("pattern has no digit placeholder 0 or # and no date field")
+	}
+	return parts, nil
+}
+
+func previousCode(parts []datePart, i int) byte {
+	for i--; i >= 0; i-- {
+		if parts[i].code != 0 {
+			return parts[i].code
+		}
+	}
+	return 0
+}
+
+func nextCode(parts []datePart, i int) byte {
+	for i++; i < len(parts); i++ {
+		if parts[i].code != 0 {
+			return parts[i].code
+		}
+	}
+	return 0
+}
+
+func formatDate(parts []datePart, t time.Time) string {
+	twelveHour := slices.ContainsFunc(parts, func(part datePart) bool { return part.code == 'A' })
+	var sb strings.Builder
+	for _, part := range parts {
+		switch part.code {
+		case 0:
+			sb.WriteString(part.text)
+		case 'y':
+			if part.count == 2 {
+				sb.WriteString(padNumber(t.Year()%100, 2))
+			} else {
+				sb.WriteString(strconv.Itoa(t.Year()))
+			}
+		case 'm':
+			switch part.count {
+			case 3:
+				sb.WriteString(t.Month().String()[:3])
+			case 4:
+				sb.WriteString(t.Month().String())
+			default:
+				sb.WriteString(padNumber(int(t.Month()), part.count))
+			}
+		case 'd':
+			switch part.count {
+			case 3:
+				sb.WriteString(t.Weekday().String()[:3])
+			case 4:
+				sb.WriteString(t.Weekday().String())
+			default:
+				sb.WriteString(padNumber(t.Day(), part.count))
+			}
+		case 'h':
+			hour := t.Hour()
+			if twelveHour {
+				hour = (hour+11)%12 + 1
+			}
+			sb.WriteString(padNumber(hour, part.count))
+		case 'M':
+			sb.WriteString(padNumber(t.Minute(), part.count))
+		case 's':
+			sb.WriteString(padNumber(t.Second(), part.count))
+		case 'A':
+			if t.Hour() < 12 {
+				sb.WriteString("AM")
+			} else {
+				sb.WriteString("PM")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func padNumber(n, width int) string {
+	s := strconv.Itoa(n)
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package clice_test
+
+import (
+	"encoding/json"
+	"go/constant"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice"
+	"github.com/crhntr/clice/expression"
+)
+
+func TestNumberFormat(t *testing.T) {
+	for _, tt := range []struct {
+		Pattern string
+		Value   string
+		Result  string
+	}{
+		{Pattern: "0.00", Value: "3.14159", Result: "3.14"},
+		{Pattern: "0.00", Value: "2.005", Result: "2.01"},
+		{Pattern: "0", Value: "2.5", Result: "3"},
+		{Pattern: "#,##0", Value: "1234567", Result: "1,234,567"},
+		{Pattern: "#,##0.00", Value: "-1234.5", Result: "-1,234.50"},
+		{Pattern: "#,##0", Value: "999", Result: "999"},
+		{Pattern: "$#,##0.00", Value: "1234.5", Result: "$1,234.50"},
+		{Pattern: "$#,##0.00", Value: "-5", Result: "-$5.00"},
+		{Pattern: `"€"#,##0.00`, Value: "12.3", Result: "€12.30"},
+		{Pattern: "#,##0.00 USD", Value: "12", Result: "12.00 USD"},
+		{Pattern: "0%", Value: "0.25", Result: "25%"},
+		{Pattern: "0.0%", Value: "1/3", Result: "33.3%"},
+		{Pattern: "0.00E+00", Value: "12345", Result: "1.23E+04"},
+		{Pattern: "0.00E+00", Value: "0.00012345", Result: "1.23E-04"},
+		{Pattern: "0.0##", Value: "1.5", Result: "1.5"},
+		{Pattern: "0.0##", Value: "1.23456", Result: "1.235"},
+		{Pattern: "0.0##", Value: "2", Result: "2.0"},
+		{Pattern: "#.00", Value: "0.5", Result: ".50"},
+		{Pattern: "000", Value: "7", Result: "007"},
+		{Pattern: "#,##0;(#,##0)", Value: "-1234", Result: "(1,234)"},
+		{Pattern: "$#,##0.00;($#,##0.00)", Value: "-0.5", Result: "($0.50)"},
+		{Pattern: "$#,##0.00;($#,##0.00)", Value: "12", Result: "$12.00"},
+		{Pattern: "0.00;(0.00)", Value: "-0.001", Result: "0.00"},
+	} {
+		t.Run(tt.Pattern+" "+tt.Value, func(t *testing.T) {
+			f, err := clice.ParseNumberFormat(tt.Pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Pattern, f.String())
+			assert.Equal(t, tt.Result, f.Format(parseNumber(t, tt.Value)))
+		})
+	}
+
+	t.Run("other values are not changed", func(t *testing.T) {
+		f, err := clice.ParseNumberFormat("0.00")
+		require.NoError(t, err)
+		assert.Equal(t, `"abc"`, f.Format(constant.MakeString("abc")))
+		assert.Equal(t, "true", f.Format(constant.MakeBool(true)))
+	})
+
+	t.Run("dates", func(t *testing.T) {
+		d := expression.MakeTime(time.Date(2026, 10, 17, 15, 4, 5, 0, time.UTC))
+		for _, tt := range []struct {
+			Pattern string
+			Result  string
+		}{
+			{Pattern: "yyyy-mm-dd", Result: "2026-10-17"},
+			{Pattern: "m/d/yy", Result: "10/17/26"},
+			{Pattern: "dddd, mmmm d, yyyy", Result: "Saturday, October 17, 2026"},
+			{Pattern: "ddd d mmm", Result: "Sat 17 Oct"},
+			{Pattern: "hh:mm:ss", Result: "15:04:05"},
+			{Pattern: "h:mm AM/PM", Result: "3:04 PM"},
+			{Pattern: `yyyy "week" d`, Result: "2026 week 17"},
+		} {
+			f, err := clice.ParseNumberFormat(tt.Pattern)
+			require.NoError(t, err, tt.Pattern)
+			assert.Equal(t, tt.Result, f.Format(d), tt.Pattern)
+		}
+		f, err := clice.ParseNumberFormat("yyyy-mm-dd")
+		require.NoError(t, err)
+		assert.Equal(t, "12", f.Format(constant.MakeInt64(12)))
+		n, err := clice.ParseNumberFormat("0.00")
+		require.NoError(t, err)
+		assert.Equal(t, "2026-10-17 15:04:05", n.Format(d))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, pattern := range []string{"abc", "0;0;0", "0.#0", "0E+", "yyy", "-", `yyyy "week`} {
+			_, err := clice.ParseNumberFormat(pattern)
+			assert.Error(t, err, pattern)
+		}
+	})
+}
+
+func parseNumber(t *testing.T, s string) constant.Value {
+	t.Helper()
+	if numerator, denominator, ok := strings.Cut(s, "/"); ok {
+		return constant.BinaryOp(parseNumber(t, numerator), token.QUO, parseNumber(t, denominator))
+	}
+	kind := token.INT
+	if strings.Contains(s, ".") {
+		kind = token.FLOAT
+	}
+	v := constant.MakeFromLiteral(strings.TrimPrefix(s, "-"), kind, 0)
+	require.NotEqual(t, constant.Unknown, v.Kind(), s)
+	if strings.HasPrefix(s, "-") {
+		v = constant.UnaryOp(token.SUB, v, 0)
+	}
+	return v
+}
+
+func TestTable_formats(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 2,
+  "rows": 3,
+  "formats": {"B": "$#,##0.00;($#,##0.00)"},
+  "cells": [
+    {"id": "A0", "ex": "\"Revenue\""},
+    {"id": "A1", "ex": "\"Growth\""},
+    {"id": "A2", "ex": "\"Note, with comma\""},
+    {"id": "B0", "ex": "1234.5"},
+    {"id": "B1", "ex": "B0/10000 - 1", "format": "0.0%"},
+    {"id": "B2", "ex": "0 - B0"}
+  ]
+}`
+
+	var table clice.Table
+	require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+	assert.Equal(t, "$1,234.50", table.Cell(1, 0).String())
+	assert.Equal(t, "-87.7%", table.Cell(1, 1).String())
+	assert.Equal(t, "($1,234.50)", table.Cell(1, 2).String())
+	assert.Equal(t, "0.0%", table.Cell(1, 1).NumberFormat().String())
+
+	out, err := json.Marshal(&table)
+	require.NoError(t, err)
+	assert.JSONEq(t, tableJSON, string(out))
+
+	var csv strings.Builder
+	require.NoError(t, table.WriteCSV(&csv))
+	assert.Equal(t, "Revenue,\"$1,234.50\"\nGrowth,-87.7%\n\"Note, with comma\",\"($1,234.50)\"\n", csv.String())
+
+	t.Run("column format", func(t *testing.T) {
+		table := table.Clone()
+		table.SetColumnFormat(1, clice.NumberFormat{})
+		assert.Equal(t, "1234.5", table.Cell(1, 0).String())
+		assert.Equal(t, "-87.7%", table.Cell(1, 1).String())
+
+		f, err := clice.ParseNumberFormat("0")
+		require.NoError(t, err)
+		table.SetColumnFormat(1, f)
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "B0", Expression: "99.5"}))
+		assert.Equal(t, "100", table.Cell(1, 0).String())
+	})
+
+	t.Run("cell format on an empty cell is encoded", func(t *testing.T) {
+		table := clice.NewTable(1, 1)
+		f, err := clice.ParseNumberFormat("0.00")
+		require.NoError(t, err)
+		table.SetCellFormat(0, 0, f)
+		out, err := json.Marshal(&table)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"columns": 1, "rows": 1, "cells": [{"id": "A0", "ex": "", "format": "0.00"}]}`, string(out))
+	})
+}
+
+func TestTable_dates(t *testing.T) {
+	table := clice.NewTable(2, 3)
+	table.Dialect = expression.FormulaDialect
+	table.Clock = func() time.Time {
+		return time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	}
+	f, err := clice.ParseNumberFormat("mmm d, yyyy")
+	require.NoError(t, err)
+	table.SetColumnFormat(1, f)
+	require.NoError(t, table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "=TODAY()"},
+		clice.Assignment{Identifier: "A1", Expression: "=EDATE(A0,1)"},
+		clice.Assignment{Identifier: "A2", Expression: "=NETWORKDAYS(A0,A1)"},
+		clice.Assignment{Identifier: "B0", Expression: "=A1-A0"},
+		clice.Assignment{Identifier: "B1", Expression: "=A1+14"},
+	))
+	assert.Equal(t, "2026-10-17", table.Cell(0, 0).String())
+	assert.Equal(t, "2026-11-17", table.Cell(0, 1).String())
+	assert.Equal(t, "22", table.Cell(0, 2).String())
+	assert.Equal(t, "31 days", table.Cell(1, 0).String())
+	assert.Equal(t, "Dec 1, 2026", table.Cell(1, 1).String())
+}
+
+func TestTable_text(t *testing.T) {
+	table := clice.NewTable(1, 4)
+	err := table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "1234.5"},
+		clice.Assignment{Identifier: "A1", Expression: `CONCAT("Total: ", TEXT(A0, "$#,##0.00"))`},
+		clice.Assignment{Identifier: "A2", Expression: `TEXT(DATE(2026, 10, 17), "mmm d") + " invoice"`},
+		clice.Assignment{Identifier: "A3", Expression: `TEXT(A0, "abc")`},
+	)
+	require.Error(t, err)
+	assert.Equal(t, `"Total: $1,234.50"`, table.Cell(0, 1).String())
+	assert.Equal(t, `"Oct 17 invoice"`, table.Cell(0, 2).String())
+	assert.Contains(t, table.Cell(0, 3).Error(), `TEXT: number format "abc"`)
+}
@@ -0,0 +1,92 @@
+package clice
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// Function is a LAMBDA that the cells of a table call by name like a
+// built-in function.
+type Function struct {
+	Name       string `json:"name"`
+	Expression string `json:"ex"`
+}
+
+type definition struct {
+	name    string
+	input   string
+	formula formula
+}
+
+var (
+	functionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	cellNamePattern     = regexp.MustCompile(`^[A-Z]+[0-9]+$`)
+)
+
+// Define names a LAMBDA so that cells can call it, for example
+// Define("DOUBLE", "=LAMBDA(x, x * 2)") in the formula dialect. Names are not
+// case-sensitive and an empty expression removes the function. Like
+// SetColumnFormat it does not evaluate the table.
+func (table *Table) Define(name, input string) error {
+	key := strings.ToUpper(name)
+	switch {
+	case !functionNamePattern.MatchString(name) || cellNamePattern.MatchString(key) || key == "TRUE" || key == "FALSE":
+		return fmt.Errorf("%q can not be used as a function name", name)
+	case expression.IsBuiltin(name):
+		return fmt.Errorf("%s is a built-in function", name)
+	}
+	if strings.TrimSpace(input) == "" {
+		delete(table.functions, key)
+		return nil
+	}
+	// Functions may call functions that are defined later.
+	f, err := parseExpression(table.Dialect, input, func(string) bool { return true })
+	if err != nil {
+		return fmt.Errorf("function %s: %w", name, err)
+	}
+	if !expression.IsLambda(f.expression) {
+		return fmt.Errorf("function %s must be defined with LAMBDA", name)
+	}
+	if table.functions == nil {
+		table.functions = make(map[string]definition)
+	}
+	table.functions[key] = definition{name: name, input: input, formula: f}
+	return nil
+}
+
+func (table *Table) defined(name string) bool {
+	_, ok := table.functions[strings.ToUpper(name)]
+	return ok
+}
+
+// Functions returns the functions defined with Define ordered by name.
+func (table *Table) Functions() []Function {
+	result := make([]Function, 0, len(table.functions))
+	for _, def := range table.functions {
+		s, err := def.formula.dialect.Format(def.formula.expression)
+		if err != nil {
+			s = def.input
+		}
+		result = append(result, Function{Name: def.name, Expression: s})
+	}
+	slices.SortFunc(result, func(a, b Function) int {
+		return cmp.Compare(strings.ToUpper(a.Name), strings.ToUpper(b.Name))
+	})
+	return result
+}
+
+// Function returns a function defined with Define.
+func (s *Scope) Function(name string) (expression.Lambda, bool) {
+	def, ok := s.Table.functions[strings.ToUpper(name)]
+	if !ok {
+		return expression.Lambda{}, false
+	}
+	v, err := def.formula.program.Evaluate(s)
+	lambda, ok := v.(expression.Lambda)
+	return lambda, ok && err == nil
+}
@@ -0,0 +1,200 @@
+package clice
+
+import (
+	"iter"
+	"slices"
+	"sync"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// evaluationPlan groups cells so that every cell in a level only depends on
+// cells in earlier levels. Cells in a level can be evaluated concurrently.
+type evaluationPlan struct {
+	levels [][]*Cell
+
+	// serial holds cells that are part of, or depend on, a reference cycle
+	// or a dynamic reference such as OFFSET. Their dependencies are only
+	// found while evaluating them, so they must be evaluated serially after
+	// the levels.
+	serial []*Cell
+}
+
+func (table *Table) plan(cells []*Cell) evaluationPlan {
+	index := make(map[*Cell]int, len(cells))
+	for i, cell := range cells {
+		index[cell] = i
+	}
+	inDegree := make([]int, len(cells))
+	dependents := make([][]int, len(cells))
+	for i, cell := range cells {
+		for _, dep := range table.dependencies(cell) {
+			j := index[dep]
+			inDegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+		if slices.ContainsFunc(cell.references, isDynamic) {
+			// The degree never reaches zero, so the cell is evaluated
+			// serially.
+			inDegree[i]++
+		}
+	}
+
+	var plan evaluationPlan
+	var level []*Cell
+	for i, cell := range cells {
+		if inDegree[i] == 0 {
+			level = append(level, cell)
+		}
+	}
+	planned := 0
+	for len(level) > 0 {
+		plan.levels = append(plan.levels, level)
+		planned += len(level)
+		var next []*Cell
+		for _, cell := range level {
+			for _, j := range dependents[index[cell]] {
+				inDegree[j]--
+				if inDegree[j] == 0 {
+					next = append(next, cells[j])
+				}
+			}
+		}
+		level = next
+	}
+	if planned < len(cells) {
+		for i, cell := range cells {
+			if inDegree[i] > 0 {
+				plan.serial = append(plan.serial, cell)
+			}
+		}
+	}
+	return plan
+}
+
+func isDynamic(ref expression.Reference) bool {
+	return ref.Kind == expression.DynamicReference
+}
+
+// dependencies returns the assigned cells referenced by the cell's
+// expression, including the cells at the offsets of relative references. A
+// cell referenced more than once is returned once.
+func (table *Table) dependencies(cell *Cell) []*Cell {
+	var result []*Cell
+	seen := make(map[*Cell]struct{})
+	add := func(dep *Cell) {
+		if dep.expression == nil {
+			return
+		}
+		if _, ok := seen[dep]; !ok {
+			seen[dep] = struct{}{}
+			result = append(result, dep)
+		}
+	}
+	// A cell without an expression may be filled by a spill from a cell
+	// above or to the left of it.
+	addCell := func(column, row int) {
+		if dep, ok := table.Lookup(column, row); ok && dep.expression != nil {
+			add(dep)
+			return
+		}
+		for _, dep := range table.spillersBefore(column, row) {
+			if dep != cell {
+				add(dep)
+			}
+		}
+	}
+	addRange := func(ref expression.Reference) {
+		for dep := range table.cellsIn(ref) {
+			add(dep)
+		}
+		for _, dep := range table.spillersBefore(ref.EndColumn, ref.EndRow) {
+			if dep != cell {
+				add(dep)
+			}
+		}
+	}
+	// A spill is blocked by the spills of the cells before it.
+	if cell.spills {
+		for _, dep := range table.spillers {
+			if dep == cell {
+				break
+			}
+			add(dep)
+		}
+	}
+	for _, ref := range cell.references {
+		switch ref.Kind {
+		case expression.CellReference:
+			addCell(ref.Column, ref.Row)
+		case expression.RangeReference:
+			addRange(ref)
+		case expression.RelativeReference:
+			ref.Kind = expression.RangeReference
+			ref.Column, ref.EndColumn = cell.column+ref.Column, cell.column+ref.EndColumn
+			ref.Row, ref.EndRow = cell.row+ref.Row, cell.row+ref.EndRow
+			addRange(ref)
+		case expression.NameReference:
+			if !cellNamePattern.MatchString(ref.Name) {
+				continue
+			}
+			if column, row, err := CellID(ref.Name); err == nil {
+				addCell(column, row)
+			}
+		}
+	}
+	return result
+}
+
+// cellsIn iterates over the assigned cells in a range. Large ranges over a
+// sparse table are filtered from the assigned cells rather than visiting
+// every position.
+func (table *Table) cellsIn(ref expression.Reference) iter.Seq[*Cell] {
+	return func(yield func(*Cell) bool) {
+		area := (ref.EndColumn - ref.Column + 1) * (ref.EndRow - ref.Row + 1)
+		if area > len(table.Cells) {
+			for i := range table.Cells {
+				cell := &table.Cells[i]
+				if ref.Contains(cell.column, cell.row) && !yield(cell) {
+					return
+				}
+			}
+			return
+		}
+		for column := ref.Column; column <= ref.EndColumn; column++ {
+			for row := ref.Row; row <= ref.EndRow; row++ {
+				if cell, ok := table.Lookup(column, row); ok && !yield(cell) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// minConcurrentLevel is the number of cells a level needs before starting
+// goroutines for it costs less than evaluating it serially.
+const minConcurrentLevel = 64
+
+// evaluateConcurrently evaluates the cells using at most workers goroutines,
+// each taking an equal share. The dependencies of the cells must already be
+// evaluated so that each goroutine only writes to the cells it is
+// evaluating.
+func (table *Table) evaluateConcurrently(cells []*Cell, workers int) {
+	if len(cells) < minConcurrentLevel || workers <= 1 {
+		for _, cell := range cells {
+			cell.evaluate(table)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for chunk := range slices.Chunk(cells, (len(cells)+workers-1)/workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, cell := range chunk {
+				cell.evaluate(table)
+			}
+		}()
+	}
+	wg.Wait()
+}
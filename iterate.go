@@ -0,0 +1,84 @@
+package clice
+
+import (
+	"go/constant"
+	"go/token"
+	"math"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// previousValue returns the value a cell had after the previous iteration,
+// or zero in the first one, for a reference back to a cell being evaluated.
+func (table *Table) previousValue(cell *Cell) expression.Value {
+	table.circular = true
+	if cell.value == nil {
+		return constant.MakeInt64(0)
+	}
+	return cell.value
+}
+
+// iterate recalculates cells until no value changes by more than the
+// tolerance. Evaluate has done the first iteration.
+func (table *Table) iterate(cells []*Cell) {
+	tolerance := table.Tolerance
+	if tolerance <= 0 {
+		tolerance = expression.DefaultTolerance
+	}
+	iterations := table.MaxIterations
+	if iterations <= 0 {
+		iterations = expression.DefaultMaxIterations
+	}
+	previous := make([]expression.Value, len(cells))
+	for range iterations - 1 {
+		for i, cell := range cells {
+			previous[i] = cell.value
+			cell.state = unevaluated
+		}
+		for _, cell := range cells {
+			cell.evaluate(table)
+		}
+		if table.settled(cells, previous, tolerance) {
+			return
+		}
+	}
+	for i, cell := range cells {
+		if !settled(previous[i], cell.value, tolerance) {
+			cell.value, cell.err = nil, &expression.ConvergenceError{Iterations: iterations, Tolerance: tolerance}
+		}
+	}
+}
+
+func (table *Table) settled(cells []*Cell, previous []expression.Value, tolerance float64) bool {
+	for i, cell := range cells {
+		if !settled(previous[i], cell.value, tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// settled reports whether a value changed by no more than tolerance. Values
+// that are not numbers, or quantities in the same unit, must be equal.
+func settled(previous, current expression.Value, tolerance float64) bool {
+	if previous == nil || current == nil {
+		return previous == nil && current == nil
+	}
+	x, y := previous, current
+	if a, ok := x.(expression.Quantity); ok {
+		if b, ok := y.(expression.Quantity); ok && a.Unit().String() == b.Unit().String() {
+			x, y = a.Number(), b.Number()
+		}
+	}
+	if a, ok := x.(constant.Value); ok && isNumber(a) {
+		if b, ok := y.(constant.Value); ok && isNumber(b) {
+			d, _ := constant.Float64Val(constant.BinaryOp(a, token.SUB, b))
+			return math.Abs(d) <= tolerance
+		}
+	}
+	return previous.String() == current.String()
+}
+
+func isNumber(v constant.Value) bool {
+	return v.Kind() == constant.Int || v.Kind() == constant.Float
+}
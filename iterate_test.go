@@ -0,0 +1,124 @@
+package clice_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice"
+	"github.com/crhntr/clice/expression"
+)
+
+func TestTable_iterative(t *testing.T) {
+	// Interest is paid on the average of the opening and closing balance,
+	// and the closing balance includes the interest.
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 2,
+  "rows": 5,
+  "dialect": "formula",
+  "iterative": true,
+  "tolerance": 1e-12,
+  "maxIterations": 50,
+  "cells": [
+    {"id": "A0", "ex": "=1000"},
+    {"id": "A1", "ex": "=ROUND(0.1 * (A0 + A2) / 2, 2)"},
+    {"id": "A2", "ex": "=A0 + A1"},
+    {"id": "A3", "ex": "=A2 * 2"},
+    {"id": "B0", "ex": "=IF(B0 = 0, 1, (B0 + 2 / B0) / 2)"}
+  ]
+}`
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var table clice.Table
+			table.Workers = workers
+			require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+			assert.True(t, table.Iterative)
+			assert.Equal(t, 1e-12, table.Tolerance)
+			assert.Equal(t, 50, table.MaxIterations)
+			assert.Equal(t, "105.26", table.Cell(0, 1).String())
+			assert.Equal(t, "1105.26", table.Cell(0, 2).String())
+			assert.Equal(t, "2210.52", table.Cell(0, 3).String())
+			assert.Equal(t, "1.4142135624", table.Cell(1, 0).String())
+
+			out, err := json.Marshal(&table)
+			require.NoError(t, err)
+			assert.JSONEq(t, tableJSON, string(out))
+
+			require.NoError(t, table.Apply(clice.Assignment{Identifier: "A0", Expression: "=2000"}))
+			assert.Equal(t, "210.53", table.Cell(0, 1).String())
+			assert.Equal(t, "2210.53", table.Cell(0, 2).String())
+		})
+	}
+}
+
+func TestTable_iterative_notConverging(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(3, 3)
+			table.Workers = workers
+			table.Dialect = expression.FormulaDialect
+			table.Iterative = true
+			table.MaxIterations = 20
+			err := table.Apply(
+				clice.Assignment{Identifier: "A0", Expression: "=B0 + 1"},
+				clice.Assignment{Identifier: "B0", Expression: "=A0 + 1"},
+				clice.Assignment{Identifier: "C0", Expression: "=1 + 2"},
+				clice.Assignment{Identifier: "A1", Expression: "=C0 * 2"},
+			)
+			var convergence *expression.ConvergenceError
+			require.True(t, errors.As(err, &convergence))
+			assert.Equal(t, 20, convergence.Iterations)
+			assert.Equal(t, expression.DefaultTolerance, convergence.Tolerance)
+			assert.Equal(t, "did not converge to within 1e-10 in 20 iterations", table.Cell(0, 0).Error())
+			assert.Equal(t, "did not converge to within 1e-10 in 20 iterations", table.Cell(1, 0).Error())
+			assert.Equal(t, "3", table.Cell(2, 0).String())
+			assert.Equal(t, "6", table.Cell(0, 1).String())
+
+			table.Tolerance = 0.5
+			require.NoError(t, table.Apply(
+				clice.Assignment{Identifier: "A0", Expression: "=B0 / 2 + 1"},
+			))
+			assert.Equal(t, "2.8125", table.Cell(0, 0).String())
+			assert.Equal(t, "3.625", table.Cell(1, 0).String())
+		})
+	}
+}
+
+func TestTable_iterative_evaluations(t *testing.T) {
+	table := clice.NewTable(1, 1)
+	table.Dialect = expression.FormulaDialect
+	table.Iterative = true
+	table.MaxIterations = 3
+	calls := 0
+	table.Clock = func() time.Time {
+		calls++
+		return time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	}
+	err := table.Apply(clice.Assignment{Identifier: "A0", Expression: "=YEAR(NOW())*0 + A0 + 1"})
+	var convergence *expression.ConvergenceError
+	require.True(t, errors.As(err, &convergence))
+	assert.Equal(t, 3, calls, "the cell is evaluated once per iteration")
+}
+
+func TestTable_iterative_disabled(t *testing.T) {
+	table := clice.NewTable(2, 2)
+	table.Dialect = expression.FormulaDialect
+	err := table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "=B0 + 1"},
+		clice.Assignment{Identifier: "B0", Expression: "=A0 / 2"},
+	)
+	require.Error(t, err)
+	assert.Contains(t, table.Cell(0, 0).Error(), "recursive reference to")
+
+	table.Iterative = true
+	require.NoError(t, table.Evaluate())
+	assert.Equal(t, "1.9999999999", table.Cell(0, 0).String())
+	assert.Equal(t, "0.9999999999", table.Cell(1, 0).String())
+}
@@ -0,0 +1,188 @@
+package clice
+
+import (
+	"fmt"
+
+	"github.com/crhntr/clice/expression"
+)
+
+// SpillError is recorded on a cell whose array can not spill into the cells
+// below and to the right of it, because one of them has an expression or is
+// filled by the spill of a cell before it in Cells, or the array does not
+// fit in the table. It is written as #SPILL! in CSV.
+type SpillError struct {
+	// Range is the area the array needs, such as B0:B9.
+	Range string
+
+	// Blocker is the cell in the way. It is empty when the array does not
+	// fit in the table.
+	Blocker string
+}
+
+func (e *SpillError) Error() string {
+	if e.Blocker == "" {
+		return fmt.Sprintf("#SPILL! %s does not fit in the table", e.Range)
+	}
+	return fmt.Sprintf("#SPILL! %s is in the way of %s", e.Blocker, e.Range)
+}
+
+// spill checks that the array computed by an anchor cell can fill the cells
+// it needs and returns the value of the anchor.
+func (table *Table) spill(anchor *Cell, array expression.Array) (expression.Value, error) {
+	columns, rows := array.Columns(), array.Rows()
+	if columns == 1 && rows == 1 {
+		return array.At(0, 0), nil
+	}
+	area, name := spillArea(anchor, array)
+	if area.EndColumn >= table.ColumnLen || area.EndRow >= table.RowLen {
+		return nil, &SpillError{Range: name}
+	}
+	blocked := false
+	var blocker cellKey
+	block := func(column, row int) {
+		// Blockers are not found in order.
+		if !blocked || row < blocker.row || row == blocker.row && column < blocker.column {
+			blocked, blocker = true, cellKey{column: column, row: row}
+		}
+	}
+	for cell := range table.cellsIn(area) {
+		if cell != anchor && cell.expression != nil {
+			block(cell.column, cell.row)
+		}
+	}
+	for _, other := range table.spillers {
+		if other == anchor {
+			break
+		}
+		switch other.state {
+		case evaluating:
+			continue
+		case unevaluated:
+			other.evaluate(table)
+		}
+		if column, row, ok := overlap(area, other); ok {
+			block(column, row)
+		}
+	}
+	if blocked {
+		return nil, &SpillError{Range: name, Blocker: expression.CellName(blocker.column, blocker.row)}
+	}
+	anchor.spill = &array
+	return array.At(0, 0), nil
+}
+
+// spillArea returns the range an array spills into from its anchor and the
+// name of the range.
+func spillArea(anchor *Cell, array expression.Array) (expression.Reference, string) {
+	area := expression.Reference{
+		Kind:      expression.RangeReference,
+		Column:    anchor.column,
+		Row:       anchor.row,
+		EndColumn: anchor.column + array.Columns() - 1,
+		EndRow:    anchor.row + array.Rows() - 1,
+	}
+	return area, expression.CellName(area.Column, area.Row) + ":" + expression.CellName(area.EndColumn, area.EndRow)
+}
+
+// overlap returns the top left cell that the spill of other fills in area.
+func overlap(area expression.Reference, other *Cell) (column, row int, ok bool) {
+	if other.spill == nil || other.err != nil {
+		return 0, 0, false
+	}
+	column, row = max(area.Column, other.column), max(area.Row, other.row)
+	endColumn := min(area.EndColumn, other.column+other.spill.Columns()-1)
+	endRow := min(area.EndRow, other.row+other.spill.Rows()-1)
+	return column, row, column <= endColumn && row <= endRow
+}
+
+// spillersBefore returns the cells that may spill into a cell in the rectangle
+// from the top left of the table to column and row.
+func (table *Table) spillersBefore(column, row int) []*Cell {
+	var result []*Cell
+	for _, cell := range table.spillers {
+		if cell.column <= column && cell.row <= row {
+			result = append(result, cell)
+		}
+	}
+	return result
+}
+
+// spilledValue returns the value a spill puts in an empty cell. Cells that
+// may spill are evaluated first; the cell being evaluated, and the cells it
+// depends on, are skipped since they can not spill into the cells their own
+// values depend on.
+func (s *Scope) spilledValue(column, row int) expression.Value {
+	for _, anchor := range s.Table.spillersBefore(column, row) {
+		if anchor == s.cell {
+			continue
+		}
+		switch anchor.state {
+		case evaluating:
+			continue
+		case unevaluated:
+			anchor.evaluate(s.Table)
+		}
+		if value, ok := spilledAt(anchor, column, row); ok {
+			return value
+		}
+	}
+	return expression.Blank{}
+}
+
+func spilledAt(anchor *Cell, column, row int) (expression.Value, bool) {
+	if anchor.spill == nil || anchor.err != nil {
+		return nil, false
+	}
+	c, r := column-anchor.column, row-anchor.row
+	if c < 0 || r < 0 || c >= anchor.spill.Columns() || r >= anchor.spill.Rows() {
+		return nil, false
+	}
+	return anchor.spill.At(c, r), true
+}
+
+// fillSpills creates the cells Cell returns for the positions filled by
+// spills. A spilled cell keeps the format of a cell assigned there without
+// an expression. A spill that overlaps one before it, which spill only misses
+// when the two cells depend on each other, gets a SpillError.
+func (table *Table) fillSpills() {
+	table.spilled = nil
+	for i, anchor := range table.spillers {
+		if anchor.spill == nil || anchor.err != nil {
+			continue
+		}
+		area, name := spillArea(anchor, *anchor.spill)
+		for _, other := range table.spillers[:i] {
+			if column, row, ok := overlap(area, other); ok {
+				anchor.value, anchor.err = nil, &SpillError{Range: name, Blocker: expression.CellName(column, row)}
+				break
+			}
+		}
+		if anchor.err != nil {
+			continue
+		}
+		for r := range anchor.spill.Rows() {
+			for c := range anchor.spill.Columns() {
+				key := cellKey{column: anchor.column + c, row: anchor.row + r}
+				if c == 0 && r == 0 {
+					continue
+				}
+				if table.spilled == nil {
+					table.spilled = make(map[cellKey]*Cell)
+				}
+				cell := &Cell{
+					column:       key.column,
+					row:          key.row,
+					value:        anchor.spill.At(c, r),
+					numeric:      table.Numeric,
+					columnFormat: table.formats[key.column],
+					anchor:       anchor,
+					state:        evaluated,
+				}
+				if assigned, ok := table.Lookup(key.column, key.row); ok {
+					cell.format = assigned.format
+				}
+				table.spilled[key] = cell
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package clice
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// SyncTable is safe for concurrent use. Readers get immutable snapshots
+// without blocking, while writers are serialized: each edit is applied to a
+// copy of the current table which then replaces it.
+type SyncTable struct {
+	mut     sync.Mutex
+	current atomic.Pointer[Table]
+}
+
+// NewSyncTable returns a SyncTable holding a copy of table, so later
+// changes to table do not affect it.
+func NewSyncTable(table Table) *SyncTable {
+	st := new(SyncTable)
+	clone := table.Clone()
+	st.current.Store(&clone)
+	return st
+}
+
+// Snapshot returns the current table. The snapshot must not be modified; it
+// remains valid and unchanged after later edits.
+func (st *SyncTable) Snapshot() *Table {
+	return st.current.Load()
+}
+
+// Store replaces the current table with a copy of table and returns the
+// published snapshot.
+func (st *SyncTable) Store(table Table) *Table {
+	st.mut.Lock()
+	defer st.mut.Unlock()
+	clone := table.Clone()
+	st.current.Store(&clone)
+	return &clone
+}
+
+// DiscardError wraps an error returned by the function passed to Update so
+// that the copy is discarded and the current table is left unchanged.
+type DiscardError struct {
+	Err error
+}
+
+func (e *DiscardError) Error() string { return e.Err.Error() }
+
+func (e *DiscardError) Unwrap() error { return e.Err }
+
+// Update calls fn with a copy of the current table and publishes the copy.
+// The copy is published even when fn returns an error so that errors
+// recorded on cells are visible to readers, unless the error is a
+// DiscardError. It returns the published snapshot and the error from fn
+// without the DiscardError.
+func (st *SyncTable) Update(fn func(*Table) error) (*Table, error) {
+	st.mut.Lock()
+	defer st.mut.Unlock()
+	table := st.current.Load().Clone()
+	err := fn(&table)
+	var discard *DiscardError
+	if errors.As(err, &discard) {
+		return st.current.Load(), discard.Err
+	}
+	st.current.Store(&table)
+	return &table, err
+}
+
+// Apply is like Table.Apply. It returns the published snapshot.
+func (st *SyncTable) Apply(assignments ...Assignment) (*Table, error) {
+	return st.Update(func(table *Table) error {
+		return table.Apply(assignments...)
+	})
+}
@@ -0,0 +1,109 @@
+package clice_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice"
+)
+
+func TestSyncTable(t *testing.T) {
+	t.Run("snapshots do not change", func(t *testing.T) {
+		st := clice.NewSyncTable(clice.NewTable(1, 2))
+		_, err := st.Apply(clice.Assignment{Identifier: "A0", Expression: "1"})
+		require.NoError(t, err)
+		before := st.Snapshot()
+
+		after, err := st.Apply(clice.Assignment{Identifier: "A0", Expression: "2"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "1", before.Cell(0, 0).String())
+		assert.Equal(t, "2", after.Cell(0, 0).String())
+		assert.Same(t, after, st.Snapshot())
+	})
+
+	t.Run("stored tables are copied", func(t *testing.T) {
+		table := clice.NewTable(1, 1)
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "A0", Expression: "1"}))
+		st := clice.NewSyncTable(table)
+		stored := st.Store(table)
+		assert.Same(t, stored, st.Snapshot())
+
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "A0", Expression: "2"}))
+		assert.Equal(t, "1", stored.Cell(0, 0).String())
+		assert.Equal(t, "2", table.Cell(0, 0).String())
+	})
+
+	t.Run("evaluation errors are published", func(t *testing.T) {
+		st := clice.NewSyncTable(clice.NewTable(1, 1))
+		_, err := st.Apply(clice.Assignment{Identifier: "A0", Expression: "A0"})
+		require.Error(t, err)
+
+		assert.Contains(t, st.Snapshot().Cell(0, 0).Error(), "recursive reference to A0")
+	})
+
+	t.Run("parse errors leave the table unchanged", func(t *testing.T) {
+		st := clice.NewSyncTable(clice.NewTable(1, 2))
+		_, err := st.Apply(
+			clice.Assignment{Identifier: "A0", Expression: "1"},
+			clice.Assignment{Identifier: "A1", Expression: "1 +"},
+		)
+		require.Error(t, err)
+
+		_, ok := st.Snapshot().Lookup(0, 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("discarded updates are not published", func(t *testing.T) {
+		st := clice.NewSyncTable(clice.NewTable(1, 1))
+		before := st.Snapshot()
+		errBad := errors.New("bad")
+		after, err := st.Update(func(table *clice.Table) error {
+			if err := table.Define("DOUBLE", "LAMBDA(x, x * 2)"); err != nil {
+				return err
+			}
+			return &clice.DiscardError{Err: errBad}
+		})
+		assert.Same(t, errBad, err)
+		assert.Same(t, before, after)
+		assert.Same(t, before, st.Snapshot())
+		assert.Empty(t, st.Snapshot().Functions())
+	})
+
+	t.Run("concurrent readers and writers", func(t *testing.T) {
+		const rows = 50
+		st := clice.NewSyncTable(clice.NewTable(2, rows))
+
+		var wg sync.WaitGroup
+		for row := range rows {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_, err := st.Apply(
+					clice.Assignment{Identifier: fmt.Sprintf("A%d", row), Expression: fmt.Sprint(row)},
+					clice.Assignment{Identifier: fmt.Sprintf("B%d", row), Expression: fmt.Sprintf("A%d * 2", row)},
+				)
+				assert.NoError(t, err)
+			}()
+			go func() {
+				defer wg.Done()
+				table := st.Snapshot()
+				for _, cell := range table.Cells {
+					_ = cell.String()
+				}
+				_ = table.Cell(1, row).String()
+			}()
+		}
+		wg.Wait()
+
+		table := st.Snapshot()
+		for row := range rows {
+			assert.Equal(t, fmt.Sprint(row*2), table.Cell(1, row).String())
+		}
+	})
+}
@@ -1,14 +1,19 @@
 package clice
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/constant"
+	"maps"
 	"regexp"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/crhntr/clice/expression"
 )
@@ -17,8 +22,22 @@ type Cell struct {
 	row    int
 	column int
 
-	expression ast.Expr
-	value      fmt.Stringer
+	formula
+	value   expression.Value
+	numeric expression.Numeric
+	state   evaluationState
+
+	// spill is the array computed by the cell when it fills the cells below
+	// and to its right. value is its first element.
+	spill *expression.Array
+
+	// anchor is the cell whose spill fills this position. It is only set on
+	// the cells Table.Cell returns for spilled positions.
+	anchor *Cell
+
+	// format is set on the cell and columnFormat is copied from the table
+	// when the cell is inserted or the column format changes.
+	format, columnFormat NumberFormat
 
 	expressionInput string
 
@@ -35,7 +54,7 @@ func (cell *Cell) Row() int {
 
 func (cell *Cell) Expression() string {
 	if cell.expression != nil && cell.err == nil {
-		s, err := expression.String(cell.expression)
+		s, err := cell.dialect.Format(cell.expression)
 		if err != nil {
 			return cell.expressionInput
 		}
@@ -45,10 +64,21 @@ func (cell *Cell) Expression() string {
 }
 
 func (cell *Cell) String() string {
-	if cell.value == nil {
+	switch {
+	case cell.value == nil:
 		return ""
+	case !cell.format.IsZero():
+		return cell.format.Format(cell.value)
+	case !cell.columnFormat.IsZero():
+		return cell.columnFormat.Format(cell.value)
+	default:
+		return cell.numeric.Format(cell.value)
 	}
-	return cell.value.String()
+}
+
+// Spilled reports whether the value comes from the array of another cell.
+func (cell *Cell) Spilled() bool {
+	return cell.anchor != nil
 }
 
 func (cell *Cell) Error() string {
@@ -58,6 +88,37 @@ func (cell *Cell) Error() string {
 	return cell.err.Error()
 }
 
+// Highlight splits an expression's source around the span of an error.
+type Highlight struct {
+	Before, Marked, After string
+}
+
+// ErrorHighlight returns the part of the expression the cell's error refers
+// to or nil when the error has no position.
+func (cell *Cell) ErrorHighlight() *Highlight {
+	return highlight(cell.expressionInput, cell.err)
+}
+
+func highlight(source string, err error) *Highlight {
+	var d *expression.Diagnostic
+	if !errors.As(err, &d) {
+		return nil
+	}
+	end := min(max(d.End, 0), len(source))
+	start := min(max(d.Start, 0), end)
+	return &Highlight{
+		Before: source[:start],
+		Marked: source[start:end],
+		After:  source[end:],
+	}
+}
+
+// NumberFormat returns the format set on the cell. It is the zero value when
+// the cell uses the format of its column.
+func (cell *Cell) NumberFormat() NumberFormat {
+	return cell.format
+}
+
 func (cell *Cell) HasExpression() bool {
 	return cell.expression != nil
 }
@@ -65,23 +126,37 @@ func (cell *Cell) HasExpression() bool {
 type EncodedCell struct {
 	ID         string `json:"id"`
 	Expression string `json:"ex"`
+	Format     string `json:"format,omitempty"`
 }
 
 func (cell *Cell) MarshalJSON() ([]byte, error) {
-	s, err := expression.String(cell.expression)
+	return json.Marshal(cell.encode())
+}
+
+func (cell *Cell) encode() EncodedCell {
+	s, err := cell.dialect.Format(cell.expression)
 	if err != nil {
 		s = cell.expressionInput
 	}
-	return json.Marshal(EncodedCell{
+	return EncodedCell{
 		ID:         strings.TrimPrefix(cell.ID(), "cell-"),
 		Expression: s,
-	})
+		Format:     cell.format.String(),
+	}
 }
 
 type EncodedTable struct {
-	ColumnCount int           `json:"columns"`
-	RowCount    int           `json:"rows"`
-	Cells       []EncodedCell `json:"cells"`
+	ColumnCount   int                 `json:"columns"`
+	RowCount      int                 `json:"rows"`
+	Dialect       expression.Dialect  `json:"dialect,omitempty"`
+	Numeric       *expression.Numeric `json:"numeric,omitempty"`
+	Formats       map[string]string   `json:"formats,omitempty"`
+	Functions     []Function          `json:"functions,omitempty"`
+	Rates         string              `json:"rates,omitempty"`
+	Iterative     bool                `json:"iterative,omitempty"`
+	Tolerance     float64             `json:"tolerance,omitempty"`
+	MaxIterations int                 `json:"maxIterations,omitempty"`
+	Cells         []EncodedCell       `json:"cells"`
 }
 
 func (table *Table) UnmarshalJSON(in []byte) error {
@@ -92,33 +167,163 @@ func (table *Table) UnmarshalJSON(in []byte) error {
 	}
 	table.RowLen = encoded.RowCount
 	table.ColumnLen = encoded.ColumnCount
+	table.Dialect = encoded.Dialect
+	table.Iterative = encoded.Iterative
+	table.Tolerance = encoded.Tolerance
+	table.MaxIterations = encoded.MaxIterations
+	table.Numeric = expression.Numeric{}
+	if encoded.Numeric != nil {
+		if scale := encoded.Numeric.Scale; scale < 0 || scale > expression.MaxScale {
+			return fmt.Errorf("scale must be between 0 and %d, got %d", expression.MaxScale, scale)
+		}
+		table.Numeric = *encoded.Numeric
+	}
+	table.formats = nil
+	for label, pattern := range encoded.Formats {
+		if !columnLabelPattern.MatchString(label) {
+			return fmt.Errorf("unexpected column label %q expected something like B", label)
+		}
+		f, err := ParseNumberFormat(pattern)
+		if err != nil {
+			return err
+		}
+		table.SetColumnFormat(columnNumber(label), f)
+	}
+	table.functions = nil
+	for _, f := range encoded.Functions {
+		if err := table.Define(f.Name, f.Expression); err != nil {
+			return err
+		}
+	}
+	if err := table.SetExchangeRates(encoded.Rates); err != nil {
+		return err
+	}
+	table.Cells = make([]Cell, 0, len(encoded.Cells))
+	table.index = nil
+	table.planned = nil
 	for _, cell := range encoded.Cells {
 		column, row, err := CellID(cell.ID)
 		if err != nil {
 			return err
 		}
-		exp, err := expression.New(cell.Expression)
+		f, err := parseExpression(table.Dialect, cell.Expression, table.defined)
 		if err != nil {
 			return err
 		}
-		table.Cells = append(table.Cells, Cell{
-			column:     column,
-			row:        row,
-			expression: exp,
-		})
+		format, err := ParseNumberFormat(cell.Format)
+		if err != nil {
+			return err
+		}
+		c := table.insert(column, row)
+		c.formula = f
+		c.expressionInput = cell.Expression
+		c.format = format
 	}
+	table.sortCells()
 
 	return table.Evaluate()
 }
 
+// MarshalJSON encodes the table as an EncodedTable. Only cells with an
+// expression or a format are included, ordered the same way as Cells.
+func (table Table) MarshalJSON() ([]byte, error) {
+	encoded := EncodedTable{
+		ColumnCount:   table.ColumnLen,
+		RowCount:      table.RowLen,
+		Dialect:       table.Dialect,
+		Rates:         table.ExchangeRates(),
+		Iterative:     table.Iterative,
+		Tolerance:     table.Tolerance,
+		MaxIterations: table.MaxIterations,
+		Cells:         make([]EncodedCell, 0, len(table.Cells)),
+	}
+	if table.Numeric != (expression.Numeric{}) {
+		encoded.Numeric = &table.Numeric
+	}
+	for column, f := range table.formats {
+		if encoded.Formats == nil {
+			encoded.Formats = make(map[string]string, len(table.formats))
+		}
+		encoded.Formats[columnLabel(column)] = f.String()
+	}
+	if len(table.functions) > 0 {
+		encoded.Functions = table.Functions()
+	}
+	for i := range table.Cells {
+		cell := &table.Cells[i]
+		if !cell.HasExpression() && cell.format.IsZero() {
+			continue
+		}
+		encoded.Cells = append(encoded.Cells, cell.encode())
+	}
+	return json.Marshal(encoded)
+}
+
 func (cell *Cell) ID() string {
 	return fmt.Sprintf("%s%d", columnLabel(cell.column), cell.row)
 }
 
 type Table struct {
-	ColumnLen int    `json:"columns"`
-	RowLen    int    `json:"rows"`
-	Cells     []Cell `json:"cells"`
+	ColumnLen int `json:"columns"`
+	RowLen    int `json:"rows"`
+
+	// Cells holds the assigned cells ordered by column and then by row. It
+	// is changed with Apply and SetCellFormat.
+	Cells []Cell `json:"cells"`
+
+	// Workers is the number of goroutines Evaluate may use. Values less than
+	// two evaluate serially, as do tables evaluated with GOMAXPROCS set to
+	// one.
+	Workers int `json:"-"`
+
+	// Dialect is the syntax used to parse and print cell expressions.
+	Dialect expression.Dialect `json:"dialect,omitempty"`
+
+	// Numeric is the number model used to evaluate and display cells.
+	Numeric expression.Numeric
+
+	// Clock returns the time used by NOW and TODAY. When it is nil they use
+	// time.Now.
+	Clock func() time.Time `json:"-"`
+
+	// Iterative allows circular references. A cell that refers back to
+	// itself reads the value it had after the previous iteration, starting
+	// from zero, and the cells are recalculated until no value changes by
+	// more than Tolerance. Cells that are still changing after
+	// MaxIterations get an *expression.ConvergenceError. When it is false
+	// circular references are errors.
+	Iterative bool `json:"iterative,omitempty"`
+
+	// Tolerance and MaxIterations are used by Iterative. Zero uses
+	// expression.DefaultTolerance and expression.DefaultMaxIterations.
+	Tolerance     float64 `json:"tolerance,omitempty"`
+	MaxIterations int     `json:"maxIterations,omitempty"`
+
+	// index holds the position in Cells of each assigned cell. Cells is
+	// kept ordered by column and then by row.
+	index     map[cellKey]int
+	formats   map[int]NumberFormat
+	functions map[string]definition
+	rates     *expression.Reference
+
+	// spillers are the cells whose expression may return an array, ordered
+	// like Cells. When two spills overlap the first one fills the cells.
+	spillers []*Cell
+
+	// spilled holds the cells Cell returns for positions filled by a spill.
+	spilled map[cellKey]*Cell
+
+	// circular is set when an iterative evaluation reads the previous value
+	// of a cell.
+	circular bool
+
+	// planned is the evaluation plan for concurrent evaluation. It is kept
+	// until a cell is assigned, since the cells it holds may move.
+	planned *evaluationPlan
+}
+
+type cellKey struct {
+	column, row int
 }
 
 func NewTable(columns, rows int) Table {
@@ -145,122 +350,357 @@ func (table *Table) Columns() []Column {
 	return result
 }
 
+// Evaluate recalculates every cell in the table. Each cell records its own
+// error; the returned error is the first one in Cells order.
+//
+// When Workers is greater than one, cells that do not depend on each other
+// are evaluated concurrently. The results and the returned error are the
+// same as for serial evaluation.
 func (table *Table) Evaluate() error {
-	cells := slices.Clone(table.Cells)
-	for i := range cells {
-		visited := make(visitSet)
-		cell := &cells[i]
-		err := cell.evaluate(table, visited)
-		if err != nil {
-			cell.err = err
-			return err
+	table.sortCells()
+	cells := make([]*Cell, len(table.Cells))
+	for i := range table.Cells {
+		cells[i] = &table.Cells[i]
+	}
+	table.spillers = table.spillers[:0]
+	table.circular = false
+	for _, cell := range cells {
+		cell.state = unevaluated
+		if table.Iterative {
+			cell.value = nil
+		}
+		if cell.spills {
+			table.spillers = append(table.spillers, cell)
 		}
-		cell.err = nil
 	}
-	slices.SortFunc(cells, func(c1, c2 Cell) int {
-		if c1.column == c2.column {
-			return c1.row - c2.row
+	serial := cells
+	if workers := min(table.Workers, runtime.GOMAXPROCS(0)); workers > 1 {
+		if table.planned == nil {
+			plan := table.plan(cells)
+			table.planned = &plan
 		}
-		return c1.column - c2.column
-	})
-	table.Cells = cells
+		for _, level := range table.planned.levels {
+			table.evaluateConcurrently(level, workers)
+		}
+		serial = table.planned.serial
+	}
+	for _, cell := range serial {
+		cell.evaluate(table)
+	}
+	if table.circular {
+		table.iterate(serial)
+	}
+	table.fillSpills()
+	for _, cell := range cells {
+		if cell.err != nil {
+			return cell.err
+		}
+	}
 	return nil
 }
 
+// Cell returns the cell at column and row. When nothing has been assigned
+// there, or the cell has no expression and another cell's array spills into
+// it, a cell that is not added to the table is returned.
 func (table *Table) Cell(column, row int) *Cell {
-	for i, cell := range table.Cells {
-		if cell.row == row && cell.column == column {
-			return &table.Cells[i]
-		}
+	cell, ok := table.Lookup(column, row)
+	if ok && cell.expression != nil {
+		return cell
 	}
-	table.Cells = append(table.Cells, Cell{
+	if spilled, ok := table.spilled[cellKey{column: column, row: row}]; ok {
+		return spilled
+	}
+	if ok {
+		return cell
+	}
+	return &Cell{
 		row:    row,
 		column: column,
+	}
+}
+
+// Lookup returns the cell at column and row if one has been assigned. It
+// does not allocate.
+func (table *Table) Lookup(column, row int) (*Cell, bool) {
+	i, ok := table.index[cellKey{column: column, row: row}]
+	if !ok || i >= len(table.Cells) {
+		return nil, false
+	}
+	cell := &table.Cells[i]
+	return cell, cell.column == column && cell.row == row
+}
+
+// Clone returns a copy of the table that shares no cells with the original.
+func (table *Table) Clone() Table {
+	clone := *table
+	clone.formats = maps.Clone(table.formats)
+	clone.functions = maps.Clone(table.functions)
+	clone.Cells = slices.Clone(table.Cells)
+	clone.index = maps.Clone(table.index)
+	clone.planned = nil
+	clone.spillers = make([]*Cell, len(table.spillers))
+	for i, cell := range table.spillers {
+		clone.spillers[i], _ = clone.Lookup(cell.column, cell.row)
+	}
+	clone.spilled = make(map[cellKey]*Cell, len(table.spilled))
+	for key, cell := range table.spilled {
+		c := *cell
+		c.anchor, _ = clone.Lookup(cell.anchor.column, cell.anchor.row)
+		clone.spilled[key] = &c
+	}
+	return clone
+}
+
+// insert returns the cell at column and row, appending it to Cells when it
+// has not been assigned. The cell is only valid until the next insert;
+// callers restore the order of Cells with sortCells when they are done.
+func (table *Table) insert(column, row int) *Cell {
+	if cell, ok := table.Lookup(column, row); ok {
+		return cell
+	}
+	if table.index == nil {
+		table.index = make(map[cellKey]int)
+	}
+	table.planned = nil
+	table.index[cellKey{column: column, row: row}] = len(table.Cells)
+	table.Cells = append(table.Cells, Cell{
+		row:          row,
+		column:       column,
+		columnFormat: table.formats[column],
 	})
 	return &table.Cells[len(table.Cells)-1]
 }
 
-type visit struct {
-	colum, row int
+// sortCells orders Cells by column and then by row and rebuilds the index.
+func (table *Table) sortCells() {
+	if slices.IsSortedFunc(table.Cells, compareCells) && len(table.index) == len(table.Cells) {
+		return
+	}
+	slices.SortFunc(table.Cells, compareCells)
+	table.planned = nil
+	table.index = make(map[cellKey]int, len(table.Cells))
+	for i := range table.Cells {
+		table.index[cellKey{column: table.Cells[i].column, row: table.Cells[i].row}] = i
+	}
 }
 
-type visitSet map[visit]struct{}
+func compareCells(c1, c2 Cell) int {
+	if c1.column == c2.column {
+		return cmp.Compare(c1.row, c2.row)
+	}
+	return cmp.Compare(c1.column, c2.column)
+}
 
-func (set visitSet) check(v visit) bool {
-	_, visited := set[v]
-	set[v] = struct{}{}
-	return visited
+// SetCellFormat sets the number format of a cell. The zero NumberFormat
+// makes the cell use the format of its column.
+func (table *Table) SetCellFormat(column, row int, format NumberFormat) {
+	table.insert(column, row).format = format
+	table.sortCells()
 }
 
-func (cell *Cell) evaluate(table *Table, visited visitSet) error {
-	v := visit{
-		colum: cell.column,
-		row:   cell.row,
+// SetColumnFormat sets the number format used by the cells in column that
+// do not have their own format.
+func (table *Table) SetColumnFormat(column int, format NumberFormat) {
+	if format.IsZero() {
+		delete(table.formats, column)
+	} else {
+		if table.formats == nil {
+			table.formats = make(map[int]NumberFormat)
+		}
+		table.formats[column] = format
 	}
-	_, alreadyVisited := visited[v]
-	if alreadyVisited {
-		return fmt.Errorf("recursive reference to %s", cell.ID())
+	for i := range table.Cells {
+		if table.Cells[i].column == column {
+			table.Cells[i].columnFormat = format
+		}
+	}
+}
+
+func (table *Table) ColumnFormat(column int) NumberFormat {
+	return table.formats[column]
+}
+
+// evaluationState tracks a cell's progress through an evaluation pass. Every
+// pass starts with all cells unevaluated, so values memoized by an earlier
+// pass are never reused after Apply changes an expression.
+type evaluationState uint8
+
+const (
+	unevaluated evaluationState = iota
+	evaluating
+	evaluated
+)
+
+func (cell *Cell) evaluate(table *Table) {
+	if cell.state == evaluated {
+		return
 	}
-	visited[v] = struct{}{}
+	// References back to the cell see that it is being evaluated instead
+	// of evaluating it again.
+	cell.state = evaluating
+	defer func() {
+		cell.state = evaluated
+	}()
+	cell.numeric = table.Numeric
+	cell.spill = nil
 	if cell.expression == nil {
-		cell.value = constant.MakeInt64(0)
-		return nil
+		cell.value, cell.err = constant.MakeInt64(0), nil
+		return
+	}
+	result, err := cell.program.Evaluate(newScope(table, cell))
+	if array, ok := result.(expression.Array); ok && err == nil {
+		result, err = table.spill(cell, array)
 	}
-	result, err := expression.Evaluate(newScope(table, cell), cell.expression)
 	if err != nil {
-		return err
+		cell.value, cell.err = nil, err
+		return
 	}
-	cell.value = result
-	return nil
+	cell.value, cell.err = result, nil
 }
 
 type Scope struct {
-	Table   *Table
-	cell    *Cell
-	visited visitSet
+	Table *Table
+	cell  *Cell
 }
 
 func newScope(table *Table, cell *Cell) *Scope {
 	return &Scope{
-		Table:   table,
-		cell:    cell,
-		visited: make(visitSet),
+		Table: table,
+		cell:  cell,
+	}
+}
+
+func (s *Scope) Numeric() expression.Numeric {
+	return s.Table.Numeric
+}
+
+// FormatValue displays v with a number format for TEXT. Text is returned
+// unchanged.
+func (s *Scope) FormatValue(v expression.Value, pattern string) (string, error) {
+	f, err := ParseNumberFormat(pattern)
+	if err != nil {
+		return "", err
+	}
+	switch c, ok := v.(constant.Value); {
+	case ok && c.Kind() == constant.String:
+		return constant.StringVal(c), nil
+	case f.IsZero():
+		return s.Table.Numeric.Format(v), nil
+	default:
+		return f.Format(v), nil
+	}
+}
+
+func (s *Scope) Now() time.Time {
+	if s.Table.Clock != nil {
+		return s.Table.Clock()
 	}
+	return time.Now()
+}
+
+// Size returns the number of columns and rows of the table, which ranges
+// must fit in.
+func (s *Scope) Size() (columns, rows int) {
+	return s.Table.ColumnLen, s.Table.RowLen
+}
+
+// Position returns the column and row of the cell being evaluated. It is
+// used by ROW, COLUMN and REL.
+func (s *Scope) Position() (column, row int) {
+	return s.cell.column, s.cell.row
 }
 
+// Resolve resolves cell names by their ID. iota is the row of the cell being
+// evaluated, the same as ROW().
 func (s *Scope) Resolve(ident string) (constant.Value, error) {
 	switch ident {
 	case "iota":
 		return constant.MakeInt64(int64(s.cell.row)), nil
 	default:
-		if !identifierPattern.MatchString(ident) {
+		if !cellNamePattern.MatchString(ident) {
 			return nil, fmt.Errorf("unknown variable %s", ident)
 		}
 		column, row, err := CellID(ident)
 		if err != nil {
 			return nil, err
 		}
-		if row < 0 || row >= s.Table.RowLen {
-			return nil, fmt.Errorf("row index %d out of bounds [0, %d)", row, s.Table.RowLen)
+		v, err := s.ResolveCell(column, row)
+		if err != nil {
+			return nil, err
 		}
-		if column < 0 || column >= s.Table.ColumnLen {
-			return nil, fmt.Errorf("column index %d out of bounds [0, %d)", column, s.Table.ColumnLen)
+		if _, ok := v.(expression.Blank); ok {
+			return constant.MakeInt64(0), nil
 		}
-		if s.visited.check(visit{row: row, colum: column}) {
-			return nil, fmt.Errorf("recursive reference to %s", ident)
+		value, ok := v.(constant.Value)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number, text or boolean", ident)
 		}
-		cell := s.Table.Cell(column, row)
-		if cell.expression == nil {
-			return constant.MakeInt64(0), nil
+		return value, nil
+	}
+}
+
+func (s *Scope) ResolveCell(column, row int) (expression.Value, error) {
+	if row < 0 || row >= s.Table.RowLen {
+		return nil, fmt.Errorf("unknown cell %s: row index %d out of bounds [0, %d)", expression.CellName(column, row), row, s.Table.RowLen)
+	}
+	if column < 0 || column >= s.Table.ColumnLen {
+		return nil, fmt.Errorf("unknown cell %s: column index %d out of bounds [0, %d)", expression.CellName(column, row), column, s.Table.ColumnLen)
+	}
+	cell, ok := s.Table.Lookup(column, row)
+	if !ok || cell.expression == nil {
+		return s.spilledValue(column, row), nil
+	}
+	switch cell.state {
+	case evaluating:
+		if s.Table.Iterative {
+			return s.Table.previousValue(cell), nil
 		}
-		return expression.Evaluate(&Scope{
-			cell:    cell,
-			Table:   s.Table,
-			visited: s.visited,
-		}, cell.expression)
+		return nil, fmt.Errorf("recursive reference to %s", expression.CellName(column, row))
+	case unevaluated:
+		cell.evaluate(s.Table)
+	}
+	if cell.err != nil {
+		return nil, cell.err
+	}
+	return cell.value, nil
+}
+
+// formula is the parsed form of a cell's expression.
+type formula struct {
+	dialect    expression.Dialect
+	expression ast.Expr
+	program    expression.Program
+	references []expression.Reference
+
+	// spills is set when the expression may return an array.
+	spills bool
+}
+
+// parseExpression parses and compiles in. Calls to functions that are not
+// built in are reported unless defined reports that they exist.
+func parseExpression(dialect expression.Dialect, in string, defined func(name string) bool) (formula, error) {
+	exp, err := dialect.Parse(in)
+	if err != nil || exp == nil {
+		return formula{}, err
+	}
+	if diagnostics := expression.Check(exp, defined); len(diagnostics) > 0 {
+		return formula{}, diagnostics[0]
 	}
+	program, err := expression.Compile(exp)
+	if err != nil {
+		return formula{}, err
+	}
+	return formula{
+		dialect:    dialect,
+		expression: exp,
+		program:    program,
+		references: expression.References(exp),
+		spills:     expression.ReturnsArray(exp),
+	}, nil
 }
 
+var columnLabelPattern = regexp.MustCompile("^[A-Z]+$")
+
 var identifierPattern = regexp.MustCompile("(?P<column>[A-Z]+)(?P<row>[0-9]+)")
 
 func CellID(in string) (int, int, error) {
@@ -317,21 +757,60 @@ type Assignment struct {
 	Expression string
 }
 
+// ExpressionError is returned by Apply when an assignment's expression can not
+// be parsed or compiled.
+type ExpressionError struct {
+	Assignment
+	Err error
+
+	column, row int
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("failed to parse %s expression %s: %s", e.Identifier, e.Expression, e.Err)
+}
+
+func (e *ExpressionError) Unwrap() error { return e.Err }
+
+// Cell returns a cell that is not part of any table holding the rejected
+// expression and the error so it can be shown for editing.
+func (e *ExpressionError) Cell() *Cell {
+	return &Cell{
+		column:          e.column,
+		row:             e.row,
+		expressionInput: e.Expression,
+		err:             e.Err,
+	}
+}
+
+// Apply parses every assignment before changing the table, so a parse error
+// leaves the table untouched. Evaluation errors are recorded on the cells.
 func (table *Table) Apply(assignments ...Assignment) error {
+	type parsed struct {
+		column, row int
+		input       string
+		formula     formula
+	}
+	updates := make([]parsed, 0, len(assignments))
 	for _, assignment := range assignments {
 		column, row, err := CellID(assignment.Identifier)
 		if err != nil {
 			return err
 		}
-		cell := table.Cell(column, row)
-		exp, err := expression.New(assignment.Expression)
+		f, err := parseExpression(table.Dialect, assignment.Expression, table.defined)
 		if err != nil {
-			return fmt.Errorf("failed to parse %s expression %s: %w", assignment.Identifier, assignment.Expression, err)
+			return &ExpressionError{column: column, row: row, Assignment: assignment, Err: err}
 		}
-		cell.expressionInput = assignment.Expression
-		cell.expression = exp
+		updates = append(updates, parsed{column: column, row: row, input: assignment.Expression, formula: f})
+	}
+	for _, update := range updates {
+		cell := table.insert(update.column, update.row)
+		cell.expressionInput = update.input
+		cell.formula = update.formula
 		cell.value = nil
 		cell.err = nil
 	}
+	table.planned = nil
+	table.sortCells()
 	return table.Evaluate()
 }
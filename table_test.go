@@ -0,0 +1,668 @@
+package clice_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crhntr/clice"
+	"github.com/crhntr/clice/expression"
+)
+
+func TestTable_Cell(t *testing.T) {
+	t.Run("empty cells are not stored", func(t *testing.T) {
+		table := clice.NewTable(1000, 1000)
+
+		cell := table.Cell(999, 999)
+		assert.Equal(t, "ALL999", cell.ID())
+		assert.False(t, cell.HasExpression())
+
+		_, ok := table.Lookup(999, 999)
+		assert.False(t, ok)
+		assert.Empty(t, collectIDs(&table))
+	})
+
+	t.Run("lookup does not allocate", func(t *testing.T) {
+		table := clice.NewTable(1000, 1000)
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "B7", Expression: "1"}))
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = table.Lookup(1, 7)
+			_, _ = table.Lookup(500, 500)
+		})
+		assert.Zero(t, allocs)
+	})
+
+	t.Run("cells are ordered by column then row", func(t *testing.T) {
+		table := clice.NewTable(3, 3)
+		require.NoError(t, table.Apply(
+			clice.Assignment{Identifier: "B0", Expression: "1"},
+			clice.Assignment{Identifier: "A2", Expression: "2"},
+			clice.Assignment{Identifier: "C1", Expression: "3"},
+			clice.Assignment{Identifier: "A0", Expression: "4"},
+		))
+
+		assert.Equal(t, []string{"A0", "A2", "B0", "C1"}, collectIDs(&table))
+	})
+
+	t.Run("formatted cells keep the order", func(t *testing.T) {
+		table := clice.NewTable(3, 3)
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "B0", Expression: "1"}))
+		format, err := clice.ParseNumberFormat("0.00")
+		require.NoError(t, err)
+		table.SetCellFormat(0, 2, format)
+
+		assert.Equal(t, []string{"A2", "B0"}, collectIDs(&table))
+		cell, ok := table.Lookup(1, 0)
+		require.True(t, ok)
+		assert.Equal(t, "1", cell.String())
+	})
+}
+
+func TestTable_JSON(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 2,
+  "rows": 3,
+  "cells": [
+    {"id": "A0", "ex": "100"},
+    {"id": "A1", "ex": "80"},
+    {"id": "B2", "ex": "A0 + A1"}
+  ]
+}`
+
+	var table clice.Table
+	require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+	assert.Equal(t, "180", table.Cell(1, 2).String())
+
+	_ = table.Cell(1, 1) // reading an empty cell must not change the encoding
+
+	out, err := json.Marshal(&table)
+	require.NoError(t, err)
+	assert.JSONEq(t, tableJSON, string(out))
+
+	out, err = json.Marshal(table)
+	require.NoError(t, err)
+	assert.JSONEq(t, tableJSON, string(out), "tables are encoded the same way by value")
+}
+
+func TestTable_JSON_formulaDialect(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 2,
+  "rows": 3,
+  "dialect": "formula",
+  "cells": [
+    {"id": "A0", "ex": "=100"},
+    {"id": "A1", "ex": "=80"},
+    {"id": "B2", "ex": "=SUM(A0:A1) & \" total\""}
+  ]
+}`
+
+	var table clice.Table
+	require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+	assert.Equal(t, expression.FormulaDialect, table.Dialect)
+	assert.Equal(t, `"180 total"`, table.Cell(1, 2).String())
+
+	out, err := json.Marshal(&table)
+	require.NoError(t, err)
+	assert.JSONEq(t, tableJSON, string(out))
+
+	require.NoError(t, table.Apply(clice.Assignment{Identifier: "B0", Expression: "SUM(a0:a1)/2"}))
+	assert.Equal(t, "=SUM(A0:A1) / 2", table.Cell(1, 0).Expression())
+	assert.Equal(t, "90", table.Cell(1, 0).String())
+}
+
+func TestTable_Numeric(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 1,
+  "rows": 4,
+  "numeric": {"mode": "decimal", "scale": 2},
+  "cells": [
+    {"id": "A0", "ex": "10 / 3"},
+    {"id": "A1", "ex": "A0 * 3"},
+    {"id": "A2", "ex": "7"},
+    {"id": "A3", "ex": "10 / 3 * 3"}
+  ]
+}`
+
+	var table clice.Table
+	require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+	assert.Equal(t, "3.33", table.Cell(0, 0).String())
+	assert.Equal(t, "9.99", table.Cell(0, 1).String())
+	assert.Equal(t, "7.00", table.Cell(0, 2).String())
+	assert.Equal(t, "10.00", table.Cell(0, 3).String())
+
+	out, err := json.Marshal(&table)
+	require.NoError(t, err)
+	assert.JSONEq(t, tableJSON, string(out))
+
+	table.Numeric = expression.Numeric{}
+	require.NoError(t, table.Evaluate())
+	assert.Equal(t, "3.3333333333", table.Cell(0, 0).String())
+	assert.Equal(t, "10", table.Cell(0, 1).String())
+
+	t.Run("scale too large", func(t *testing.T) {
+		var table clice.Table
+		err := json.Unmarshal([]byte(`{"columns": 1, "rows": 1, "numeric": {"mode": "decimal", "scale": 1000000000}}`), &table)
+		assert.EqualError(t, err, "scale must be between 0 and 100, got 1000000000")
+	})
+}
+
+func collectIDs(table *clice.Table) []string {
+	var ids []string
+	for _, cell := range table.Cells {
+		ids = append(ids, cell.ID())
+	}
+	return ids
+}
+
+func TestTable_Evaluate_workers(t *testing.T) {
+	assignments := []clice.Assignment{
+		{Identifier: "A0", Expression: "1"},
+		{Identifier: "A1", Expression: "A0 + 1"},
+		{Identifier: "A2", Expression: "A1 * A0 + iota"},
+		{Identifier: "B0", Expression: "C0"},
+		{Identifier: "C0", Expression: "B0"},
+		{Identifier: "B1", Expression: "B0 + 1"},
+		{Identifier: "B2", Expression: "A2 / 2"},
+		{Identifier: "C1", Expression: "Z99"},
+		{Identifier: "C2", Expression: "A2 + B2"},
+	}
+
+	serial := clice.NewTable(3, 3)
+	serialErr := serial.Apply(assignments...)
+	require.Error(t, serialErr)
+
+	for _, workers := range []int{2, 4, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			parallel := clice.NewTable(3, 3)
+			parallel.Workers = workers
+			parallelErr := parallel.Apply(assignments...)
+
+			assert.Equal(t, serialErr, parallelErr)
+			for _, cell := range serial.Cells {
+				other := parallel.Cell(cell.Column(), cell.Row())
+				assert.Equal(t, cell.String(), other.String(), cell.ID())
+				assert.Equal(t, cell.Error(), other.Error(), cell.ID())
+			}
+		})
+	}
+}
+
+func TestTable_Evaluate_workers_wide(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// Each row is a level of independent cells that is large enough to be
+	// evaluated concurrently.
+	const columns, rows = 100, 4
+	var assignments []clice.Assignment
+	for column := range columns {
+		label := clice.Column{Number: column}.Label()
+		assignments = append(assignments, clice.Assignment{Identifier: label + "0", Expression: strconv.Itoa(column)})
+		for row := 1; row < rows; row++ {
+			assignments = append(assignments, clice.Assignment{
+				Identifier: fmt.Sprintf("%s%d", label, row),
+				Expression: fmt.Sprintf("%s%d * 2 + iota", label, row-1),
+			})
+		}
+	}
+	serial := clice.NewTable(columns, rows)
+	require.NoError(t, serial.Apply(assignments...))
+	parallel := clice.NewTable(columns, rows)
+	parallel.Workers = 4
+	require.NoError(t, parallel.Apply(assignments...))
+	assert.Equal(t, "19", parallel.Cell(1, 3).String())
+
+	require.NoError(t, parallel.Evaluate())
+	for _, cell := range serial.Cells {
+		assert.Equal(t, cell.String(), parallel.Cell(cell.Column(), cell.Row()).String(), cell.ID())
+	}
+
+	// The plan is rebuilt when cells are assigned.
+	require.NoError(t, parallel.Apply(clice.Assignment{Identifier: "B2", Expression: "A3 + 1"}))
+	assert.Equal(t, "12", parallel.Cell(1, 2).String())
+	assert.Equal(t, "27", parallel.Cell(1, 3).String())
+}
+
+func TestTable_Evaluate_names(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(3, 3)
+			table.Workers = workers
+			err := table.Apply(
+				clice.Assignment{Identifier: "B2", Expression: "1"},
+				clice.Assignment{Identifier: "A0", Expression: "fooB2"},
+			)
+			require.Error(t, err)
+			assert.Equal(t, "unknown variable fooB2", table.Cell(0, 0).Error())
+		})
+	}
+}
+
+func TestTable_lookups(t *testing.T) {
+	assignments := []clice.Assignment{
+		{Identifier: "A0", Expression: `="apple"`},
+		{Identifier: "A1", Expression: `="banana"`},
+		{Identifier: "A2", Expression: `="cherry"`},
+		{Identifier: "B0", Expression: "=1.25"},
+		{Identifier: "B1", Expression: "=C1*2"},
+		{Identifier: "B2", Expression: "=4"},
+		{Identifier: "C0", Expression: `=VLOOKUP("banana",A0:B2,1)`},
+		{Identifier: "C1", Expression: "=0.25"},
+		{Identifier: "C2", Expression: `=SUM(OFFSET(B0,1,0,2,1))+INDIRECT("C"&1)`},
+		{Identifier: "D0", Expression: "=C2+1"},
+		{Identifier: "D1", Expression: `=MATCH("kiwi",A0:A2)`},
+	}
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(4, 3)
+			table.Dialect = expression.FormulaDialect
+			table.Workers = workers
+			err := table.Apply(assignments...)
+			var notFound *expression.NotFoundError
+			require.ErrorAs(t, err, &notFound)
+
+			assert.Equal(t, "0.5", table.Cell(2, 0).String())
+			assert.Equal(t, "4.75", table.Cell(2, 2).String())
+			assert.Equal(t, "5.75", table.Cell(3, 0).String())
+
+			var csv strings.Builder
+			require.NoError(t, table.WriteCSV(&csv))
+			assert.Equal(t, "apple,1.25,0.5,5.75\nbanana,0.5,0.25,#N/A\ncherry,4,4.75,\n", csv.String())
+		})
+	}
+}
+
+func TestTable_goDialectRanges(t *testing.T) {
+	table := clice.NewTable(2, 2)
+	require.NoError(t, table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "1"},
+		clice.Assignment{Identifier: "A1", Expression: "2"},
+		clice.Assignment{Identifier: "B0", Expression: `SUM(INDIRECT("A0:A1"))`},
+	))
+	assert.Equal(t, "3", table.Cell(1, 0).String())
+
+	err := table.Apply(clice.Assignment{Identifier: "B1", Expression: "SUM(A0:A1)"})
+	assert.ErrorContains(t, err, "ranges such as A0:B1 need the formula dialect")
+}
+
+func TestTable_rangeOutsideTable(t *testing.T) {
+	for _, tt := range []struct {
+		Name       string
+		Expression string
+		Error      string
+	}{
+		{Name: "sum", Expression: "=SUM(A0:ZZZ999999)", Error: "#REF! A0:ZZZ999999 is outside the table"},
+		{Name: "array", Expression: "=A0:A999999999*2", Error: "#REF! A0:A999999999 is outside the table"},
+		{Name: "criteria", Expression: `=COUNTIF(A0:A999999999,">0")`, Error: "COUNTIF: #REF! A0:A999999999 is outside the table"},
+		{Name: "offset", Expression: "=SUM(OFFSET(A0,0,0,2000000000,2000000000))", Error: "OFFSET: #REF! A0:FLHOMVX1999999999 is outside the table"},
+		{Name: "offset criteria", Expression: `=COUNTIF(OFFSET(A0,0,0,2000000000,1),">0")`, Error: "OFFSET: #REF! A0:A1999999999 is outside the table"},
+		{Name: "offset size", Expression: "=ROWS(OFFSET(A0,1,0,2,1))", Error: "OFFSET: #REF! A1:A2 is outside the table"},
+		{Name: "indirect", Expression: `=SUM(INDIRECT("A0:C1"))`, Error: "INDIRECT: #REF! A0:C1 is outside the table"},
+		{Name: "relative", Expression: "=SUM(REL(0,0,1,2))", Error: "REL: #REF! B1:C1 is outside the table"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			table := clice.NewTable(2, 2)
+			table.Dialect = expression.FormulaDialect
+			err := table.Apply(clice.Assignment{Identifier: "B1", Expression: tt.Expression})
+			var outside *expression.RangeError
+			require.ErrorAs(t, err, &outside)
+			assert.Contains(t, table.Cell(1, 1).Error(), tt.Error)
+
+			var csv strings.Builder
+			require.NoError(t, table.WriteCSV(&csv))
+			assert.Equal(t, ",\n,#REF!\n", csv.String())
+		})
+	}
+}
+
+func TestTable_statistics(t *testing.T) {
+	table := clice.NewTable(2, 5)
+	table.Dialect = expression.FormulaDialect
+	require.NoError(t, table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "=2"},
+		clice.Assignment{Identifier: "A1", Expression: "=4"},
+		clice.Assignment{Identifier: "A3", Expression: "=9"},
+		clice.Assignment{Identifier: "B0", Expression: "=AVERAGE(A0:A4)"},
+		clice.Assignment{Identifier: "B1", Expression: "=COUNT(A0:A4)"},
+		clice.Assignment{Identifier: "B2", Expression: "=MEDIAN(A0:A4)"},
+		clice.Assignment{Identifier: "B3", Expression: "=STDEVP(A0:A1)"},
+		clice.Assignment{Identifier: "B4", Expression: "=A2+1"},
+	))
+	assert.Equal(t, "5", table.Cell(1, 0).String())
+	assert.Equal(t, "3", table.Cell(1, 1).String())
+	assert.Equal(t, "4", table.Cell(1, 2).String())
+	assert.Equal(t, "1", table.Cell(1, 3).String())
+	assert.Equal(t, "1", table.Cell(1, 4).String())
+}
+
+func TestTable_conditionalAggregation(t *testing.T) {
+	table := clice.NewTable(4, 4)
+	table.Dialect = expression.FormulaDialect
+	require.NoError(t, table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: `="Open"`},
+		clice.Assignment{Identifier: "A1", Expression: `="Closed"`},
+		clice.Assignment{Identifier: "A2", Expression: `="Open"`},
+		clice.Assignment{Identifier: "B0", Expression: "=120"},
+		clice.Assignment{Identifier: "B1", Expression: "=B0/2"},
+		clice.Assignment{Identifier: "B2", Expression: "=30"},
+		clice.Assignment{Identifier: "C0", Expression: `=SUMIF(A0:A3, "=Open", B0:B3)`},
+		clice.Assignment{Identifier: "C1", Expression: `=COUNTIF(B0:B3, ">"&D0)`},
+		clice.Assignment{Identifier: "C2", Expression: `=SUMIFS(B0:B3, A0:A3, "open", B0:B3, "<100")`},
+		clice.Assignment{Identifier: "C3", Expression: `=COUNTIF(A0:A3, "")`},
+		clice.Assignment{Identifier: "D0", Expression: "=50"},
+	))
+	assert.Equal(t, "150", table.Cell(2, 0).String())
+	assert.Equal(t, "2", table.Cell(2, 1).String())
+	assert.Equal(t, "30", table.Cell(2, 2).String())
+	assert.Equal(t, "1", table.Cell(2, 3).String())
+}
+
+func TestTable_spill(t *testing.T) {
+	assignments := []clice.Assignment{
+		{Identifier: "A0", Expression: "=SEQUENCE(3, 2, 1)"},
+		{Identifier: "C0", Expression: "=SUM(A0:B2)"},
+		{Identifier: "C1", Expression: "=B2*10"},
+		{Identifier: "C2", Expression: "=SORT(A0:A1, 0, -1)"},
+		{Identifier: "D0", Expression: "=SEQUENCE(2)"},
+		{Identifier: "D1", Expression: "=1"},
+		{Identifier: "E0", Expression: "=SEQUENCE(5)"},
+	}
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(5, 4)
+			table.Dialect = expression.FormulaDialect
+			table.Workers = workers
+			err := table.Apply(assignments...)
+			var spill *clice.SpillError
+			require.ErrorAs(t, err, &spill)
+
+			assert.Equal(t, "1", table.Cell(0, 0).String())
+			assert.False(t, table.Cell(0, 0).Spilled())
+			assert.Equal(t, "6", table.Cell(1, 2).String())
+			assert.True(t, table.Cell(1, 2).Spilled())
+			assert.Equal(t, "21", table.Cell(2, 0).String())
+			assert.Equal(t, "60", table.Cell(2, 1).String())
+			assert.Equal(t, "1", table.Cell(2, 3).String())
+			assert.Equal(t, "#SPILL! D1 is in the way of D0:D1", table.Cell(3, 0).Error())
+			assert.Equal(t, "#SPILL! E0:E4 does not fit in the table", table.Cell(4, 0).Error())
+
+			var csv strings.Builder
+			require.NoError(t, table.WriteCSV(&csv))
+			assert.Equal(t, "1,2,21,#SPILL!,#SPILL!\n3,4,60,1,\n5,6,3,,\n,,1,,\n", csv.String())
+		})
+	}
+}
+
+func TestTable_spill_overlap(t *testing.T) {
+	// A1 comes before B0 in Cells, so its spill fills B1 and B0 can not
+	// spill.
+	assignments := []clice.Assignment{
+		{Identifier: "A1", Expression: "=SEQUENCE(1, 2, 10)"},
+		{Identifier: "B0", Expression: "=SEQUENCE(2, 1, 20)"},
+		{Identifier: "C0", Expression: "=B1 + 1"},
+		{Identifier: "C2", Expression: "=SEQUENCE(2, 1, 1)"},
+		{Identifier: "D1", Expression: "=SEQUENCE(1, 1, 5) + C3"},
+	}
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(4, 4)
+			table.Dialect = expression.FormulaDialect
+			table.Workers = workers
+			err := table.Apply(assignments...)
+			var spill *clice.SpillError
+			require.ErrorAs(t, err, &spill)
+
+			assert.Equal(t, "10", table.Cell(0, 1).String())
+			assert.Equal(t, "11", table.Cell(1, 1).String())
+			assert.True(t, table.Cell(1, 1).Spilled())
+			assert.Equal(t, "#SPILL! B1 is in the way of B0:B1", table.Cell(1, 0).Error())
+			assert.Equal(t, "12", table.Cell(2, 0).String())
+			assert.Equal(t, "7", table.Cell(3, 1).String())
+
+			var csv strings.Builder
+			require.NoError(t, table.WriteCSV(&csv))
+			assert.Equal(t, ",#SPILL!,12,\n10,11,,7\n,,1,\n,,2,\n", csv.String())
+		})
+	}
+}
+
+func TestTable_functions(t *testing.T) {
+	const tableJSON =
+	/* language=json */ `{
+  "columns": 2,
+  "rows": 3,
+  "dialect": "formula",
+  "functions": [
+    {"name": "FACT", "ex": "=LAMBDA(n, IF(n <= 1, 1, n * FACT(n - 1)))"},
+    {"name": "Markup", "ex": "=LAMBDA(price, price * (1 + B0))"}
+  ],
+  "cells": [
+    {"id": "A0", "ex": "=FACT(5)"},
+    {"id": "A1", "ex": "=markup(A0)"},
+    {"id": "A2", "ex": "=LET(x, A1 / 2, x + x)"},
+    {"id": "B0", "ex": "=1 / 10"}
+  ]
+}`
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var table clice.Table
+			table.Workers = workers
+			require.NoError(t, json.Unmarshal([]byte(tableJSON), &table))
+			assert.Equal(t, "120", table.Cell(0, 0).String())
+			assert.Equal(t, "132", table.Cell(0, 1).String())
+			assert.Equal(t, "132", table.Cell(0, 2).String())
+
+			out, err := json.Marshal(&table)
+			require.NoError(t, err)
+			assert.JSONEq(t, tableJSON, string(out))
+
+			require.NoError(t, table.Define("MARKUP", "=LAMBDA(price, price * 2)"))
+			require.NoError(t, table.Evaluate())
+			assert.Equal(t, "240", table.Cell(0, 1).String())
+			assert.Equal(t, []clice.Function{
+				{Name: "FACT", Expression: "=LAMBDA(n, IF(n <= 1, 1, n * FACT(n - 1)))"},
+				{Name: "MARKUP", Expression: "=LAMBDA(price, price * 2)"},
+			}, table.Functions())
+
+			require.NoError(t, table.Define("FACT", ""))
+			require.Error(t, table.Evaluate())
+			assert.Equal(t, "unknown function FACT", table.Cell(0, 0).Error())
+		})
+	}
+
+	table := clice.NewTable(1, 1)
+	assert.EqualError(t, table.Define("A1", "LAMBDA(x, x)"), `"A1" can not be used as a function name`)
+	assert.EqualError(t, table.Define("two words", "LAMBDA(x, x)"), `"two words" can not be used as a function name`)
+	assert.EqualError(t, table.Define("sum", "LAMBDA(x, x)"), "sum is a built-in function")
+	assert.EqualError(t, table.Define("ONE", "1"), "function ONE must be defined with LAMBDA")
+	assert.EqualError(t, table.Define("ONE", "LAMBDA(1, 2)"), "function ONE: expected a name")
+
+	err := table.Apply(clice.Assignment{Identifier: "A0", Expression: "MODD(1, 2) + SUMM(A0)"})
+	var d *expression.Diagnostic
+	require.True(t, errors.As(err, &d))
+	assert.EqualError(t, d, "unknown function MODD")
+	assert.Equal(t, 0, d.Start)
+	assert.Equal(t, 4, d.End)
+	assert.Empty(t, table.Cell(0, 0).String())
+}
+
+func TestTable_relativeReferences(t *testing.T) {
+	// The same running total formula is pasted down column B.
+	assignments := []clice.Assignment{
+		{Identifier: "A0", Expression: "=5"},
+		{Identifier: "A1", Expression: "=7"},
+		{Identifier: "A2", Expression: "=B0 * 0 + 1"},
+		{Identifier: "A3", Expression: "=2"},
+		{Identifier: "B0", Expression: "=REL(0, -1)"},
+		{Identifier: "C0", Expression: `=ADDRESS(ROW(), COLUMN()) & ":" & ROWS(A0:A3)`},
+	}
+	for row := 1; row < 4; row++ {
+		assignments = append(assignments, clice.Assignment{
+			Identifier: fmt.Sprintf("B%d", row),
+			Expression: "=REL(-1, 0) + REL(0, -1)",
+		})
+	}
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			table := clice.NewTable(3, 4)
+			table.Dialect = expression.FormulaDialect
+			table.Workers = workers
+			require.NoError(t, table.Apply(assignments...))
+			assert.Equal(t, "5", table.Cell(1, 0).String())
+			assert.Equal(t, "12", table.Cell(1, 1).String())
+			assert.Equal(t, "13", table.Cell(1, 2).String())
+			assert.Equal(t, "15", table.Cell(1, 3).String())
+			assert.Equal(t, `"C0:4"`, table.Cell(2, 0).String())
+
+			require.Error(t, table.Apply(clice.Assignment{Identifier: "A3", Expression: "=REL(0, -1)"}))
+			assert.Equal(t, "REL: moving A3 by 0 rows and -1 columns leaves the table", table.Cell(0, 3).Error())
+		})
+	}
+}
+
+func TestTable_units(t *testing.T) {
+	table := clice.NewTable(2, 3)
+	table.Dialect = expression.FormulaDialect
+	require.NoError(t, table.Apply(
+		clice.Assignment{Identifier: "A0", Expression: "=42 km"},
+		clice.Assignment{Identifier: "A1", Expression: "=3.5 h"},
+		clice.Assignment{Identifier: "A2", Expression: "=A0 / A1"},
+		clice.Assignment{Identifier: "B0", Expression: `=CONVERT(A0, "mi")`},
+		clice.Assignment{Identifier: "B1", Expression: "=A2 * 30 min"},
+	))
+	assert.Equal(t, "42 km", table.Cell(0, 0).String())
+	assert.Equal(t, "12 km/h", table.Cell(0, 2).String())
+	assert.Equal(t, "6 km", table.Cell(1, 1).String())
+	assert.Equal(t, "=42 km", table.Cell(0, 0).Expression())
+
+	f, err := clice.ParseNumberFormat("0.00")
+	require.NoError(t, err)
+	table.SetColumnFormat(1, f)
+	assert.Equal(t, "26.10 mi", table.Cell(1, 0).String())
+
+	require.Error(t, table.Apply(clice.Assignment{Identifier: "B2", Expression: "=A0 + A1"}))
+	assert.Equal(t, "cannot apply + to 42 km and 3.5 h, which have different dimensions", table.Cell(1, 2).Error())
+}
+
+func BenchmarkTable_Evaluate(b *testing.B) {
+	const columns, rows = 64, 64
+	table := clice.NewTable(columns, rows)
+	var assignments []clice.Assignment
+	for column := range columns {
+		label := clice.Column{Number: column}.Label()
+		assignments = append(assignments, clice.Assignment{Identifier: label + "0", Expression: strconv.Itoa(column)})
+		for row := 1; row < rows; row++ {
+			assignments = append(assignments, clice.Assignment{
+				Identifier: fmt.Sprintf("%s%d", label, row),
+				Expression: fmt.Sprintf("(%s%d * 7 + iota) %% 1009", label, row-1),
+			})
+		}
+	}
+	require.NoError(b, table.Apply(assignments...))
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			table.Workers = workers
+			for b.Loop() {
+				if err := table.Evaluate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTable_Evaluate_memoized(t *testing.T) {
+	t.Run("diamond", func(t *testing.T) {
+		table := clice.NewTable(1, 4)
+		require.NoError(t, table.Apply(
+			clice.Assignment{Identifier: "A0", Expression: "2"},
+			clice.Assignment{Identifier: "A1", Expression: "A0 * 3"},
+			clice.Assignment{Identifier: "A2", Expression: "A0 + A0"},
+			clice.Assignment{Identifier: "A3", Expression: "A1 + A2"},
+		))
+		assert.Equal(t, "10", table.Cell(0, 3).String())
+
+		require.NoError(t, table.Apply(clice.Assignment{Identifier: "A0", Expression: "5"}))
+		assert.Equal(t, "25", table.Cell(0, 3).String())
+	})
+
+	t.Run("long chain", func(t *testing.T) {
+		const rows = 2000
+		table := clice.NewTable(1, rows)
+		assignments := []clice.Assignment{{Identifier: "A0", Expression: "1"}}
+		for row := 1; row < rows; row++ {
+			assignments = append(assignments, clice.Assignment{
+				Identifier: fmt.Sprintf("A%d", row),
+				Expression: fmt.Sprintf("A%d + A%d", row-1, row-1),
+			})
+		}
+		// reverse the order so references are resolved before the loop reaches them
+		slices.Reverse(assignments)
+		require.NoError(t, table.Apply(assignments...))
+
+		n := new(big.Int).Lsh(big.NewInt(1), rows-1)
+		assert.Equal(t, n.String(), table.Cell(0, rows-1).String())
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		for _, tt := range []struct {
+			Name        string
+			Assignments []clice.Assignment
+		}{
+			{Name: "self reference", Assignments: []clice.Assignment{
+				{Identifier: "A0", Expression: "=YEAR(NOW())*0 + A0"},
+			}},
+			{Name: "loop", Assignments: []clice.Assignment{
+				{Identifier: "A0", Expression: "=YEAR(NOW())*0 + A1"},
+				{Identifier: "A1", Expression: "=A0"},
+			}},
+		} {
+			t.Run(tt.Name, func(t *testing.T) {
+				table := clice.NewTable(1, 2)
+				table.Dialect = expression.FormulaDialect
+				calls := 0
+				table.Clock = func() time.Time {
+					calls++
+					return time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+				}
+				err := table.Apply(tt.Assignments...)
+				require.ErrorContains(t, err, "recursive reference to A0")
+				assert.Equal(t, 1, calls, "A0 is evaluated once")
+			})
+		}
+	})
+}
+
+func BenchmarkTable_Evaluate_chain(b *testing.B) {
+	const rows = 1000
+	table := clice.NewTable(1, rows)
+	assignments := []clice.Assignment{{Identifier: "A0", Expression: "1"}}
+	for row := 1; row < rows; row++ {
+		assignments = append(assignments, clice.Assignment{
+			Identifier: fmt.Sprintf("A%d", row),
+			Expression: fmt.Sprintf("A%d + 1", row-1),
+		})
+	}
+	require.NoError(b, table.Apply(assignments...))
+
+	for b.Loop() {
+		if err := table.Evaluate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}